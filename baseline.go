@@ -0,0 +1,67 @@
+package leaktest
+
+import "sync"
+
+// exempt holds the IDs of the goroutines exempted from every check by
+// SetBaseline. Goroutine IDs aren't reused, so they stay exempt for good.
+var exempt struct {
+	sync.RWMutex
+	ids map[uint64]bool
+}
+
+// SetBaseline exempts every goroutine running at the time from all the
+// checks in the process, for goroutines that packages start in their init
+// functions and keep running, such as connection pools and metric
+// exporters. It's meant to be called from TestMain, before the tests run:
+//
+//	func TestMain(m *testing.M) {
+//		leaktest.SetBaseline()
+//		os.Exit(m.Run())
+//	}
+//
+// This is simpler than ignoring each such goroutine by its stack. Calling it
+// again replaces the goroutines exempted before.
+func SetBaseline() {
+	gs, _ := interestingGoroutines()
+	ids := make(map[uint64]bool, len(gs))
+	for _, g := range gs {
+		ids[g.id] = true
+	}
+	exempt.Lock()
+	exempt.ids = ids
+	exempt.Unlock()
+}
+
+// exempted reports whether g was running when SetBaseline was called.
+func exempted(g *goroutine) bool {
+	exempt.RLock()
+	defer exempt.RUnlock()
+	return exempt.ids[g.id]
+}
+
+// initGoroutines holds the IDs of the goroutines running when the first
+// check using WithExemptInitGoroutines started.
+var initGoroutines struct {
+	once sync.Once
+	ids  map[uint64]bool
+}
+
+// recordInitGoroutines records the goroutines running at its first call,
+// made by the first check using WithExemptInitGoroutines, which is usually
+// right after the imported packages' init functions ran.
+func recordInitGoroutines() {
+	initGoroutines.once.Do(func() {
+		gs, _ := interestingGoroutines()
+		initGoroutines.ids = make(map[uint64]bool, len(gs))
+		for _, g := range gs {
+			initGoroutines.ids[g.id] = true
+		}
+	})
+}
+
+// startedByInit reports whether g was running when the first check using
+// WithExemptInitGoroutines started.
+func startedByInit(g *goroutine) bool {
+	recordInitGoroutines()
+	return initGoroutines.ids[g.id]
+}
@@ -0,0 +1,70 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetBaseline(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	// started before the check, as an init function would, but after
+	// SetBaseline
+	notExempt := make(chan struct{})
+	exemptStarted := make(chan struct{})
+	go blockedGoroutine(exemptStarted, block)
+	<-exemptStarted
+	SetBaseline()
+	defer func() {
+		exempt.Lock()
+		exempt.ids = nil
+		exempt.Unlock()
+	}()
+	go blockedGoroutine(notExempt, block)
+	<-notExempt
+
+	checker := &testReporter{}
+	c := NewChecker(checker)
+	// forget the baseline, as if both goroutines had started during the
+	// test
+	c.orig = map[uint64]bool{}
+	c.CheckTimeout(100 * time.Millisecond)
+	var leaks int
+	for _, msg := range checker.msgs {
+		if strings.Contains(msg, "leaktest.blockedGoroutine") {
+			leaks++
+		}
+	}
+	if leaks != 1 {
+		t.Errorf("want the goroutine started after SetBaseline reported alone, got %q", checker.msgs)
+	}
+}
+
+func TestWithExemptInitGoroutines(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+
+	checker := &testReporter{}
+	c := NewChecker(checker, WithExemptInitGoroutines())
+	// pretend the goroutine was started by an init function, and during
+	// the test
+	var id uint64
+	for _, g := range c.snapshot() {
+		if strings.Contains(g.stack, "leaktest.blockedGoroutine") {
+			id = g.id
+		}
+	}
+	initGoroutines.ids[id] = true
+	defer delete(initGoroutines.ids, id)
+	delete(c.orig, id)
+	c.CheckTimeout(100 * time.Millisecond)
+	if checker.failed {
+		t.Errorf("goroutine started by init reported: %q", checker.msgs)
+	}
+}
@@ -0,0 +1,170 @@
+package leaktest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// blockedOn describes what g is blocked on, such as "on the same sync.Mutex
+// at 0xc000012345", as far as the arguments shown in its stack tell, and
+// returns the addresses it's based on, or returns "" if they don't tell.
+// Goroutines blocked on the same object share the same description.
+//
+// Stacks show the address of the sync.Mutex, RWMutex or WaitGroup passed to
+// its methods, and of the notify list of a sync.Cond. They don't show the
+// runtime frames that receive channels though, so for a goroutine blocked
+// on a channel the arguments of the innermost function that are still in
+// use are, which usually include the channel or the value holding it.
+func blockedOn(g *goroutine) (string, []string) {
+	if !g.state.blocked() || g.state == StateSelect {
+		return "", nil
+	}
+	lines := strings.Split(g.stack, "\n")
+	for _, line := range lines[1:] {
+		if line == "" || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "...") {
+			continue
+		}
+		if strings.HasPrefix(line, "created by ") {
+			break
+		}
+		fn, addrs := addresses(line)
+		var addr string
+		if len(addrs) > 0 && strings.HasPrefix(line, fn+"("+addrs[0]) {
+			addr = addrs[0]
+		}
+		switch {
+		case fn == "sync.runtime_notifyListWait":
+			if addr != "" {
+				return "on the same sync.Cond, with notify list " + addr, []string{addr}
+			}
+		case strings.HasPrefix(fn, "sync.(*") || strings.HasPrefix(fn, "internal/sync.(*"):
+			typ := fn[strings.Index(fn, "(*")+2:]
+			typ = typ[:strings.Index(typ, ")")]
+			if addr != "" {
+				return "on the same sync." + typ + " at " + addr, []string{addr}
+			}
+		case strings.HasPrefix(fn, "sync.") || strings.HasPrefix(fn, "internal/sync.") || strings.HasPrefix(fn, "runtime."):
+		default:
+			if len(addrs) > 0 && (g.state == StateChanReceive || g.state == StateChanSend) {
+				return fmt.Sprintf("on %s in %s with %s, likely the same channel", g.state, fn, strings.Join(addrs, ", ")), addrs
+			}
+			return "", nil
+		}
+	}
+	return "", nil
+}
+
+// addresses splits a function line of a stack, such as
+// "main.recv(0x0?, 0xc000020120)", into the function and the arguments that
+// are exact addresses, leaving out guesses such as "0x0?", which the runtime
+// prints for arguments no longer in use, and elided ones, as in
+// "main.recv(...)".
+func addresses(line string) (fn string, addrs []string) {
+	paren := strings.LastIndex(line, "(")
+	if paren < 0 {
+		return line, nil
+	}
+	fn = line[:paren]
+	for _, arg := range strings.Split(strings.TrimSuffix(line[paren+1:], ")"), ", ") {
+		if !strings.HasPrefix(arg, "0x") {
+			continue
+		}
+		if n, err := strconv.ParseUint(arg[2:], 16, 64); err == nil && n != 0 {
+			addrs = append(addrs, arg)
+		}
+	}
+	return fn, addrs
+}
+
+// blockingGroups describes each group of two or more goroutines in leaked
+// blocked on the same object, in the order the groups first appear.
+func blockingGroups(leaked []*goroutine) []string {
+	var keys []string
+	groups := map[string][]*goroutine{}
+	for _, g := range leaked {
+		key, _ := blockedOn(g)
+		if key == "" {
+			continue
+		}
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], g)
+	}
+	var descs []string
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+		ids := make([]string, len(group))
+		creator := group[0].createdBy.function
+		for i, g := range group {
+			ids[i] = strconv.FormatUint(g.id, 10)
+			if g.createdBy.function != creator {
+				creator = ""
+			}
+		}
+		desc := fmt.Sprintf("%d goroutines are blocked %s", len(group), key)
+		if creator != "" {
+			desc += ", created by " + creator
+		}
+		descs = append(descs, desc+": goroutines "+strings.Join(ids, ", "))
+	}
+	return descs
+}
+
+// waitGraph describes which of the leaked goroutines may be waiting on
+// which others, one "A waits on B" line each. A goroutine blocked on an
+// object, as told by blockedOn, may be waiting on the other goroutines that
+// aren't blocked on the same object but have its address in their stacks:
+// for a mutex, likely the goroutine holding it, and for a channel, those
+// meant to send to or receive from it. Arguments no longer in use aren't
+// shown though, so the holder of a mutex that's unlocked by a deferred call
+// usually isn't found.
+func waitGraph(leaked []*goroutine) []string {
+	type blocking struct {
+		desc  string
+		addrs []string
+	}
+	blocked := make([]blocking, len(leaked))
+	for i, g := range leaked {
+		blocked[i].desc, blocked[i].addrs = blockedOn(g)
+	}
+	var edges []string
+	for i, w := range leaked {
+		if blocked[i].desc == "" {
+			continue
+		}
+		for j, h := range leaked {
+			if i == j || blocked[j].desc == blocked[i].desc {
+				continue
+			}
+			if addr, fn := holds(h, blocked[i].addrs); fn != "" {
+				edges = append(edges, fmt.Sprintf("goroutine %d, blocked %s, waits on goroutine %d, which has %s in %s", w.id, blocked[i].desc, h.id, addr, fn))
+			}
+		}
+	}
+	return edges
+}
+
+// holds returns the first of addrs that's an exact argument of a function
+// in g's stack, and that function, or returns "", "" if there's none.
+func holds(g *goroutine, addrs []string) (addr, fn string) {
+	lines := strings.Split(g.stack, "\n")
+	for _, line := range lines[1:] {
+		if line == "" || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "created by ") {
+			continue
+		}
+		fn, args := addresses(line)
+		for _, arg := range args {
+			for _, addr := range addrs {
+				if arg == addr {
+					return addr, fn
+				}
+			}
+		}
+	}
+	return "", ""
+}
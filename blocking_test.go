@@ -0,0 +1,91 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//go:noinline
+func receiveFrom(started chan<- struct{}, ch chan struct{}) {
+	started <- struct{}{}
+	<-ch
+}
+
+//go:noinline
+func lockMutex(started chan<- struct{}, mu *sync.Mutex) {
+	started <- struct{}{}
+	mu.Lock()
+	mu.Unlock()
+}
+
+func TestBlockingGroups(t *testing.T) {
+	var mu sync.Mutex
+	mu.Lock()
+	defer mu.Unlock()
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := &testReporter{}
+	check := CheckTimeout(checker, 100*time.Millisecond)
+	started := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go lockMutex(started, &mu)
+		<-started
+	}
+	for i := 0; i < 2; i++ {
+		go receiveFrom(started, block)
+		<-started
+	}
+	check()
+
+	var groups []string
+	for _, msg := range checker.msgs {
+		if strings.Contains(msg, "goroutines are blocked") {
+			groups = append(groups, msg)
+		}
+	}
+	if len(groups) != 2 ||
+		!strings.Contains(groups[0], "3 goroutines are blocked on the same sync.Mutex at 0x") ||
+		!strings.Contains(groups[0], "created by github.com/fortytw2/leaktest.TestBlockingGroups") ||
+		!strings.Contains(groups[1], "2 goroutines are blocked on chan receive in github.com/fortytw2/leaktest.receiveFrom with 0x") {
+		t.Errorf("want the goroutines locking the mutex and receiving from the channel grouped, got %q", groups)
+	}
+}
+
+//go:noinline
+func holdMutex(started chan<- struct{}, mu *sync.Mutex, block chan struct{}) {
+	mu.Lock()
+	started <- struct{}{}
+	<-block
+	mu.Unlock()
+}
+
+func TestWaitGraph(t *testing.T) {
+	var mu sync.Mutex
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := &testReporter{}
+	check := CheckTimeout(checker, 100*time.Millisecond)
+	started := make(chan struct{})
+	go holdMutex(started, &mu, block)
+	<-started
+	go lockMutex(started, &mu)
+	<-started
+	check()
+
+	var graph string
+	for _, msg := range checker.msgs {
+		if strings.HasPrefix(msg, "leaktest: among the leaked goroutines:") {
+			graph = msg
+		}
+	}
+	if !strings.Contains(graph, "blocked on the same sync.Mutex at 0x") ||
+		!strings.Contains(graph, "in github.com/fortytw2/leaktest.holdMutex") {
+		t.Errorf("want the goroutine locking the mutex shown waiting on the one holding it, got %q", checker.msgs)
+	}
+}
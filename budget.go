@@ -0,0 +1,58 @@
+package leaktest
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errBudget is the reason given when a check stops waiting because the time
+// budget set with WithTimeBudget ran out.
+var errBudget = errors.New("the suite's time budget for waiting in leak checks is used up")
+
+// budget is the time left for checks to spend waiting, see WithTimeBudget.
+type budget struct {
+	mu        sync.Mutex
+	enabled   bool
+	remaining time.Duration
+}
+
+// waitBudget is the process-wide budget set by CheckMain.
+var waitBudget budget
+
+func (b *budget) set(d time.Duration) {
+	b.mu.Lock()
+	b.enabled, b.remaining = true, d
+	b.mu.Unlock()
+}
+
+func (b *budget) clear() {
+	b.mu.Lock()
+	b.enabled, b.remaining = false, 0
+	b.mu.Unlock()
+}
+
+// start is called as a check starts waiting. It returns a channel that
+// fires when the budget runs out, and a func that charges the time spent
+// waiting to the budget. It returns ok false if the budget's already used
+// up.
+func (b *budget) start() (exhausted <-chan time.Time, done func(), ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.enabled {
+		return nil, func() {}, true
+	}
+	if b.remaining <= 0 {
+		return nil, func() {}, false
+	}
+	begin := time.Now()
+	timer := time.NewTimer(b.remaining)
+	return timer.C, func() {
+		timer.Stop()
+		b.mu.Lock()
+		if b.enabled {
+			b.remaining -= time.Since(begin)
+		}
+		b.mu.Unlock()
+	}, true
+}
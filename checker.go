@@ -0,0 +1,583 @@
+package leaktest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime/metrics"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checker holds a snapshot of the goroutines running when it was created,
+// and checks for goroutines that leaked since then. The package level
+// Check* functions are shorthands for creating a Checker and checking it at
+// the end of the test.
+type Checker struct {
+	t   ErrorReporter
+	cfg *config
+
+	// orig is the set of goroutine IDs in the baseline snapshot
+	orig map[uint64]bool
+	// baseCreators counts the goroutines in the baseline snapshot by the go
+	// statement that started them
+	baseCreators map[frame]int
+	// origStacks are the goroutines in the baseline snapshot by ID, kept
+	// with WithStrictBaseline
+	origStacks map[uint64]*goroutine
+	// scope, if set, is the value of the scope label that leaked goroutines
+	// must carry, see WithLabelScope
+	scope string
+	// sampler records the goroutine count during the test, see WithSampling
+	sampler *sampler
+	// baseHeap is the heap profile taken with the baseline, see
+	// WithHeapProfiles
+	baseHeap    []byte
+	baseHeapErr error
+	// baseHandles are the handles open at the baseline, see WithHandles
+	baseHandles    handleSet
+	baseHandlesErr error
+	// baseSites are the goroutine counts by entry function at the
+	// baseline, see WithProfilePolling
+	baseSites map[string]int
+	// baseMetrics are the runtime metrics read with the baseline, see
+	// WithMetrics
+	baseMetrics []metrics.Sample
+	// timeline, if set, records the tests running as goroutines appear, see
+	// CheckMain
+	timeline *timeline
+	// testsFailed is set by CheckMain when the tests it ran failed
+	testsFailed bool
+
+	mu          sync.Mutex
+	checkpoints []checkpoint
+	// expectExit are the patterns passed to ExpectExit
+	expectExit []string
+	// paused, while the Checker is paused, are the goroutine IDs at Pause
+	paused map[uint64]bool
+	// excluded are the IDs of the goroutines started while paused
+	excluded map[uint64]bool
+	// nesting is what nested checks found, see CheckFunc
+	nesting nesting
+	// subtests holds the subtest run by RunSubtest each goroutine started
+	// during and outlived, by ID
+	subtests map[uint64]string
+}
+
+// checkpoint is a named snapshot of goroutine IDs taken during a test.
+type checkpoint struct {
+	name string
+	ids  map[uint64]bool
+}
+
+// NewChecker snapshots the currently-running goroutines and returns a
+// Checker that reports leaks relative to that snapshot to t.
+func NewChecker(t ErrorReporter, opts ...Option) *Checker {
+	t = orStderr(t)
+	if disabled {
+		return &Checker{t: t, cfg: &config{}, orig: map[uint64]bool{}}
+	}
+	c := &Checker{
+		t:   t,
+		cfg: newConfig(opts),
+	}
+	noteTest(testName(t))
+	if baseline := c.takeBaseline(); baseline != nil {
+		c.warnDirtyBaseline(baseline)
+	}
+	return c
+}
+
+// Reset takes a new baseline snapshot, so that the next check reports the
+// goroutines started since rather than since NewChecker, keeping the
+// Checker's options. It suits tests that run many iterations and check for
+// leaks after each one:
+//
+//	c := leaktest.NewChecker(t)
+//	for i := 0; i < 100; i++ {
+//		c.Reset()
+//		runIteration()
+//		if err := c.Verify(ctx); err != nil {
+//			t.Fatalf("iteration %d: %v", i, err)
+//		}
+//	}
+//
+// Checkpoints, Pause, subtests run by RunSubtest and what nested checks
+// found are forgotten, while the patterns passed to ExpectExit are kept.
+func (c *Checker) Reset() {
+	if disabled {
+		return
+	}
+	if c.sampler != nil {
+		c.sampler.Stop()
+	}
+	c.mu.Lock()
+	c.checkpoints = nil
+	c.paused, c.excluded = nil, nil
+	c.nesting.reported, c.nesting.startedIn, c.nesting.lastLeaked = nil, nil, nil
+	c.subtests = nil
+	c.mu.Unlock()
+	c.takeBaseline()
+}
+
+// takeBaseline records the baselines the config asks for, returning the
+// goroutines in the baseline snapshot.
+func (c *Checker) takeBaseline() []*goroutine {
+	var baseline []*goroutine
+	c.orig = map[uint64]bool{}
+	if c.cfg.profilePolling {
+		c.baseSites = siteCounts()
+	} else {
+		baseline = c.snapshot()
+		c.baseCreators = map[frame]int{}
+		for _, g := range baseline {
+			c.orig[g.id] = true
+			if g.createdBy.function != "" {
+				c.baseCreators[g.createdBy]++
+			}
+		}
+		if c.cfg.strictBaseline {
+			c.origStacks = make(map[uint64]*goroutine, len(baseline))
+			for _, g := range baseline {
+				c.origStacks[g.id] = g
+			}
+		}
+	}
+	if c.cfg.heapProfiles {
+		c.baseHeap, c.baseHeapErr = heapProfile()
+	}
+	if c.cfg.handles {
+		c.baseHandles, c.baseHandlesErr = openHandles()
+	}
+	if len(c.cfg.metrics) > 0 {
+		c.baseMetrics = readMetrics(c.cfg.metrics)
+	}
+	if c.cfg.sampleInterval > 0 {
+		c.sampler = startSampler(c.cfg.sampleInterval, c.cfg.sampleWriter)
+	}
+	return baseline
+}
+
+// snapshot returns the interesting goroutines, reporting any parse errors.
+func (c *Checker) snapshot() []*goroutine {
+	gs, err := interestingGoroutines()
+	for _, err := range unjoin(err) {
+		c.t.Errorf("leaktest: %s", err)
+	}
+	return gs
+}
+
+// Checkpoint records the goroutines running at a named point in a
+// multi-phase test, such as "after-server-start". When leaks are reported,
+// each one names the checkpoint it appeared after, so the phase of the test
+// that introduced it can be told apart.
+func (c *Checker) Checkpoint(name string) {
+	ids := map[uint64]bool{}
+	for _, g := range c.snapshot() {
+		ids[g.id] = true
+	}
+	c.mu.Lock()
+	c.checkpoints = append(c.checkpoints, checkpoint{name: name, ids: ids})
+	c.mu.Unlock()
+}
+
+// ExpectExit makes the check fail if a goroutine that was already running
+// when the Checker was created, and whose stack contains pattern, such as
+// "mypkg.(*Server).serve", is still running at check time. The check waits
+// for such goroutines just as it waits for leaked ones. This verifies that
+// shutdown actually stops long-lived goroutines, which can't be caught as
+// leaks as they're part of the baseline.
+func (c *Checker) ExpectExit(pattern string) {
+	c.mu.Lock()
+	c.expectExit = append(c.expectExit, pattern)
+	c.mu.Unlock()
+}
+
+// Check checks whether any goroutines leaked, waiting up to 5 seconds in
+// error conditions, or 20 under the race detector.
+func (c *Checker) Check() {
+	if h, ok := c.t.(tHelper); ok {
+		h.Helper()
+	}
+	c.CheckTimeout(defaultTimeout())
+}
+
+// CheckTimeout is the same as Check, but with a configurable timeout
+func (c *Checker) CheckTimeout(dur time.Duration) {
+	if h, ok := c.t.(tHelper); ok {
+		h.Helper()
+	}
+	// A timer is used rather than context.WithTimeout, as the goroutine the
+	// latter starts to cancel the context would itself look like a leak.
+	timeout, stop := c.cfg.timer(dur)
+	defer stop()
+	c.check(context.Background(), timeout)
+}
+
+// CheckContext is the same as Check, but uses a context.Context for
+// cancellation and timeout control
+func (c *Checker) CheckContext(ctx context.Context) {
+	if h, ok := c.t.(tHelper); ok {
+		h.Helper()
+	}
+	c.check(ctx, nil)
+}
+
+// Verify is the same as CheckContext, but returns the leaked goroutines as
+// a *LeaksError rather than reporting them. Errors parsing goroutine stacks
+// are returned too, joined with the *LeaksError if there is one.
+func (c *Checker) Verify(ctx context.Context) error {
+	return c.verify(ctx, nil)
+}
+
+func (c *Checker) verify(ctx context.Context, timeout <-chan time.Time) error {
+	res := c.wait(ctx, timeout)
+	c.setReported(res.leaked)
+	errs := res.errs
+	sortLeaks(res.leaked, modulePath())
+	failing, warned := c.partition(res.leaked)
+	for _, g := range warned {
+		warnf(c.t, "leaktest: warning: leaked goroutine%s: %v", c.describe(g), c.cfg.format(g))
+	}
+	for _, r := range res.running {
+		errs = append(errs, fmt.Errorf("leaktest: goroutine expected to exit is still running (matches %q): %s", r.pattern, r.g.stack))
+	}
+	for _, s := range res.stuck {
+		errs = append(errs, fmt.Errorf("leaktest: goroutine %d, already running before the test, got stuck [%s]:\n%s", s.after.id, s.after.status, lineDiff(s.before.stack, s.after.stack)))
+	}
+	if len(failing) > 0 {
+		le := newLeaksError(failing)
+		le.reason = res.reason
+		errs = append([]error{le}, errs...)
+	}
+	return errors.Join(errs...)
+}
+
+// waitResult is the outcome of waiting for leaked goroutines to exit.
+type waitResult struct {
+	// leaked are the goroutines still considered leaked, if any
+	leaked []*goroutine
+	// all are the interesting goroutines from the last snapshot
+	all []*goroutine
+	// samples are the goroutine counts recorded during the test
+	samples []sample
+	// running are the baseline goroutines that were expected to exit but
+	// are still running
+	running []expectedExit
+	// stuck are the baseline goroutines that got stuck, see
+	// WithStrictBaseline
+	stuck []stuckBaseline
+	// reason is why waiting stopped while goroutines were still leaked
+	reason error
+	// errs are the errors encountered along the way, such as parse errors
+	errs []error
+	// alreadyFailed is set if the test had failed before waiting started
+	alreadyFailed bool
+}
+
+// clean reports whether nothing was found wrong.
+func (r waitResult) clean() bool {
+	return len(r.leaked) == 0 && len(r.running) == 0 && len(r.stuck) == 0
+}
+
+// check waits until either no leaked goroutines remain, ctx is done or
+// timeout fires, and reports the leaks that remain.
+func (c *Checker) check(ctx context.Context, timeout <-chan time.Time) {
+	t := c.t
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	start := time.Now()
+	res := c.wait(ctx, timeout)
+	c.setReported(res.leaked)
+	for _, err := range res.errs {
+		t.Errorf("leaktest: %s", err)
+	}
+	if c.cfg.flakeThreshold > 0 {
+		res.leaked = c.tally(res.leaked)
+	}
+	if c.cfg.growthWindow > 0 {
+		if msg := sustainedGrowth(res.samples, c.cfg.growthWindow); msg != "" {
+			t.Errorf("leaktest: %s", msg)
+		}
+	}
+	if res.clean() {
+		took := time.Since(start).Round(time.Millisecond)
+		c.cfg.record(levelInfo, "leaktest: settled", "test", testName(t), "baseline", len(c.orig), "goroutines", len(res.all), "took", took)
+		if c.cfg.logOnSuccess {
+			warnf(t, "leaktest: goroutines: %d → %d (settled after %s)", len(c.orig), len(res.all), took)
+		}
+		return
+	}
+	c.report(res)
+}
+
+// blockedForever returns the reason to stop waiting if one of leaked can
+// never exit, see blockedForever, and would fail the check, or nil.
+func (c *Checker) blockedForever(leaked []*goroutine) error {
+	var stuck []*goroutine
+	for _, g := range leaked {
+		if blockedForever(g) != "" {
+			stuck = append(stuck, g)
+		}
+	}
+	if len(stuck) == 0 {
+		return nil
+	}
+	if failing, _ := c.partition(stuck); len(failing) > 0 {
+		g := failing[0]
+		err := fmt.Errorf("goroutine %d can never exit, as %s", g.id, blockedForever(g))
+		if len(leaked) > 1 {
+			err = fmt.Errorf("%w, so the check didn't wait for the others, which may still have been exiting", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// errNoRetry is the reason given when a check doesn't wait for leaked
+// goroutines to exit, see WithNoRetry.
+var errNoRetry = errors.New("still running right after the test, and WithNoRetry is set")
+
+// errDeadline is the reason given when a check stops waiting because the
+// test binary is about to time out.
+var errDeadline = errors.New("giving up shortly before the test binary's deadline")
+
+// expiredError is the reason given when a check runs out of time, wrapping
+// why, along with how the number of leaked goroutines went over the polls,
+// such as "12 → 4 → 2", which tells a slow shutdown apart from a leak.
+type expiredError struct {
+	err    error
+	counts []int
+}
+
+func (e *expiredError) Error() string {
+	counts := make([]string, len(e.counts))
+	for i, n := range e.counts {
+		counts[i] = strconv.Itoa(n)
+	}
+	return fmt.Sprintf("%s, with %s goroutine(s) remaining", e.err, strings.Join(counts, " → "))
+}
+
+func (e *expiredError) Unwrap() error { return e.err }
+
+// wait polls until either no leaked goroutines remain, ctx is done or
+// timeout fires.
+func (c *Checker) wait(ctx context.Context, timeout <-chan time.Time) (res waitResult) {
+	if disabled {
+		return res
+	}
+	c.Resume()
+	start := time.Now()
+	defer func() {
+		suiteOverhead.check(testName(c.t), time.Since(start), res.clean())
+	}()
+	// when an execution trace is being taken, show in it when the check
+	// ran relative to the test's teardown, and what it found
+	if trace.IsEnabled() {
+		var task *trace.Task
+		ctx, task = trace.NewTask(ctx, "leaktest.check")
+		defer task.End()
+		defer func() {
+			for _, g := range res.leaked {
+				trace.Logf(ctx, "leaktest.leak", "goroutine %d [fingerprint %s]", g.id, g.fingerprint())
+			}
+		}()
+	}
+	if c.sampler != nil {
+		var err error
+		if res.samples, err = c.sampler.Stop(); err != nil {
+			res.errs = append(res.errs, fmt.Errorf("error writing goroutine count samples: %s", err))
+		}
+	}
+	polls := 0
+	// counts is the number of leaked goroutines each time it changed
+	var counts []int
+	update := func(all []*goroutine, err error) bool {
+		defer trace.StartRegion(ctx, "leaktest.poll").End()
+		if err != nil {
+			res.errs = append(res.errs, unjoin(err)...)
+		}
+		var ok bool
+		res.all = all
+		res.leaked, ok = c.leaked(all)
+		res.running = c.stillRunning(all)
+		res.stuck = c.stuckSince(all)
+		polls++
+		if n := len(res.leaked); len(counts) == 0 || counts[len(counts)-1] != n {
+			counts = append(counts, n)
+		}
+		c.cfg.record(levelDebug, "leaktest: poll", "test", testName(c.t), "poll", polls, "goroutines", len(all), "leaked", len(res.leaked))
+		// there's no point waiting for goroutines that can never exit
+		if res.reason = c.blockedForever(res.leaked); res.reason != nil {
+			return true
+		}
+		return ok && len(res.running) == 0 && len(res.stuck) == 0
+	}
+	poll := func() bool {
+		yield()
+		return update(interestingGoroutines())
+	}
+	if c.cfg.randomDelay > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(c.cfg.randomDelay) + 1)))
+	}
+	for _, hook := range c.cfg.preCheckHooks {
+		hook()
+	}
+	if c.cfg.profilePolling {
+		sres := c.waitSites(ctx, timeout)
+		sres.samples, sres.errs = res.samples, append(res.errs, sres.errs...)
+		return sres
+	}
+	// fast check if we have no leaks
+	if poll() {
+		return res
+	}
+	f, ok := c.t.(failer)
+	res.alreadyFailed = c.testsFailed || ok && f.Failed()
+	if c.cfg.noRetry {
+		res.reason = errNoRetry
+		return res
+	}
+	deadline, stop := testDeadline(c.t)
+	defer stop()
+	exhausted, charge, ok := waitBudget.start()
+	defer charge()
+	if !ok {
+		res.reason = errBudget
+		return res
+	}
+	// with a clock, polls are timed by it rather than by the shared poller
+	var snapshots <-chan pollResult
+	var tick <-chan time.Time
+	stopTick := func() bool { return false }
+	defer func() { stopTick() }()
+	if c.cfg.clock == nil {
+		var unsubscribe func()
+		snapshots, unsubscribe = sharedPoller.subscribe()
+		defer unsubscribe()
+	} else {
+		tick, stopTick = c.cfg.timer(pollInterval())
+	}
+
+	var reason error
+	for {
+		select {
+		case <-tick:
+			if poll() {
+				return res
+			}
+			tick, stopTick = c.cfg.timer(pollInterval())
+			continue
+		case snap := <-snapshots:
+			done := false
+			if c.cfg.stress > 0 {
+				// the snapshot predates the perturbation, so take a new one
+				stress(c.cfg.stress)
+				done = poll()
+			} else {
+				yield()
+				done = update(snap.all, snap.err)
+			}
+			if done {
+				return res
+			}
+			continue
+		case <-ctx.Done():
+			reason = ctx.Err()
+		case <-timeout:
+			reason = context.DeadlineExceeded
+		case <-deadline:
+			reason = errDeadline
+		case <-exhausted:
+			reason = errBudget
+		}
+		// the last poll may be a tick old, so report what's left now
+		if !poll() {
+			res.reason = &expiredError{err: reason, counts: counts}
+		}
+		return res
+	}
+}
+
+// leaked returns the goroutines in all that are considered leaked and the
+// boolean flag indicating if no leaks were detected.
+func (c *Checker) leaked(all []*goroutine) ([]*goroutine, bool) {
+	leaked, ok := leakedGoroutines(c.orig, all)
+	if ok {
+		return leaked, ok
+	}
+	kept := leaked[:0]
+	for _, g := range leaked {
+		if c.reportable(g) {
+			kept = append(kept, g)
+		}
+	}
+	return kept, len(kept) == 0
+}
+
+// reportable reports whether g, if it isn't in the baseline, is reported
+// rather than left out by the options or by what the check has been told.
+func (c *Checker) reportable(g *goroutine) bool {
+	switch {
+	case c.scope != "" && g.labels[scopeLabel] != c.scope:
+		return false
+	case c.cfg.ignored(g):
+		return false
+	case c.cfg.leakStates != nil && !c.cfg.leakStates[g.state]:
+		return false
+	case c.isExcluded(g) || c.reportedByNested(g):
+		return false
+	}
+	return true
+}
+
+// expectedExit is a baseline goroutine that was expected to exit.
+type expectedExit struct {
+	g       *goroutine
+	pattern string
+}
+
+// stillRunning returns the baseline goroutines in all that match a pattern
+// passed to ExpectExit.
+func (c *Checker) stillRunning(all []*goroutine) []expectedExit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var running []expectedExit
+	for _, g := range all {
+		if !c.orig[g.id] {
+			continue
+		}
+		for _, p := range c.expectExit {
+			if strings.Contains(g.stack, p) {
+				running = append(running, expectedExit{g: g, pattern: p})
+				break
+			}
+		}
+	}
+	return running
+}
+
+// phase describes where g appeared relative to the recorded checkpoints, or
+// returns "" if there are none.
+func (c *Checker) phase(g *goroutine) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.checkpoints) == 0 {
+		return ""
+	}
+	for i, cp := range c.checkpoints {
+		if !cp.ids[g.id] {
+			continue
+		}
+		if i == 0 {
+			return fmt.Sprintf("appeared before checkpoint %q", cp.name)
+		}
+		return fmt.Sprintf("appeared after checkpoint %q", c.checkpoints[i-1].name)
+	}
+	return fmt.Sprintf("appeared after checkpoint %q", c.checkpoints[len(c.checkpoints)-1].name)
+}
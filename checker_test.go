@@ -0,0 +1,183 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"runtime/trace"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fingerprintTag matches the fingerprint in the tags of a reported leak.
+var fingerprintTag = regexp.MustCompile(`, fingerprint [0-9a-f]+`)
+
+func TestCheckerCheckpoint(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := &testReporter{}
+	c := NewChecker(checker)
+	go func() { <-block }()
+	c.Checkpoint("after-start")
+	c.Checkpoint("after-work")
+	go func() { <-block }()
+	c.Checkpoint("after-shutdown")
+	c.CheckTimeout(100 * time.Millisecond)
+
+	want := []string{
+		`leaktest: leaked goroutine [test-code] (appeared before checkpoint "after-start")`,
+		`leaktest: leaked goroutine [test-code] (appeared after checkpoint "after-work")`,
+	}
+	var got []string
+	for _, msg := range checker.msgs {
+		if i := strings.Index(msg, ": goroutine "); i >= 0 {
+			got = append(got, fingerprintTag.ReplaceAllString(msg[:i], ""))
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got leaks\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckerNoLeak(t *testing.T) {
+	checker := &testReporter{}
+	c := NewChecker(checker)
+	done := make(chan struct{})
+	go func() { close(done) }()
+	<-done
+	c.Checkpoint("after-work")
+	c.CheckTimeout(time.Second)
+	if checker.failed {
+		t.Errorf("unexpected failure: %s", checker.msg)
+	}
+}
+
+func expectExitServe(started, stop chan struct{}) {
+	close(started)
+	<-stop
+}
+
+func TestCheckerExpectExit(t *testing.T) {
+	started, stop := make(chan struct{}), make(chan struct{})
+	go expectExitServe(started, stop)
+	<-started
+
+	checker := &testReporter{}
+	c := NewChecker(checker)
+	c.ExpectExit("leaktest.expectExitServe")
+	c.CheckTimeout(100 * time.Millisecond)
+	if !checker.failed || !strings.Contains(checker.msg, "expected to exit is still running") {
+		t.Errorf("still running goroutine wasn't reported: %q", checker.msgs)
+	}
+
+	checker = &testReporter{}
+	c = NewChecker(checker)
+	c.ExpectExit("leaktest.expectExitServe")
+	close(stop)
+	c.CheckTimeout(time.Second)
+	if checker.failed {
+		t.Errorf("unexpected failure: %q", checker.msgs)
+	}
+}
+
+func TestCheckTraceAnnotations(t *testing.T) {
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skipf("can't start tracing, as with go test -trace: %s", err)
+	}
+	checker := &testReporter{}
+	started, block := make(chan struct{}), make(chan struct{})
+	defer close(block)
+	check := CheckTimeout(checker, 100*time.Millisecond)
+	go blockedGoroutine(started, block)
+	<-started
+	check()
+	trace.Stop()
+
+	if !checker.failed {
+		t.Error("leak not caught while tracing")
+	}
+	for _, msg := range checker.msgs {
+		if strings.Contains(msg, "runtime/trace.") {
+			t.Errorf("tracing goroutine reported: %s", msg)
+		}
+	}
+	for _, want := range []string{"leaktest.check", "leaktest.poll", "leaktest.leak"} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("trace has no %s annotation", want)
+		}
+	}
+}
+
+func TestCheckerReset(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	c := NewChecker(&testReporter{})
+	for i := 0; i < 3; i++ {
+		c.Reset()
+		if i == 1 {
+			started := make(chan struct{})
+			go blockedGoroutine(started, block)
+			<-started
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		err := c.Verify(ctx)
+		cancel()
+		var leaks *LeaksError
+		if leaked := errors.As(err, &leaks); leaked != (i == 1) {
+			t.Errorf("iteration %d: Verify() = %v", i, err)
+		}
+	}
+}
+
+func TestCheckContextProgress(t *testing.T) {
+	blocks := []chan struct{}{make(chan struct{}), make(chan struct{}), make(chan struct{})}
+	var wg sync.WaitGroup
+	defer func() {
+		close(blocks[2])
+		wg.Wait()
+	}()
+
+	checker := &testReporter{}
+	ctx, cancel := context.WithTimeout(context.Background(), 600*time.Millisecond)
+	defer cancel()
+	check := CheckContext(ctx, checker)
+	for _, block := range blocks {
+		wg.Add(1)
+		started := make(chan struct{})
+		go func(block chan struct{}) {
+			defer wg.Done()
+			close(started)
+			<-block
+		}(block)
+		<-started
+	}
+	// let the goroutines exit one at a time, a few polls apart
+	time.AfterFunc(150*time.Millisecond, func() { close(blocks[0]) })
+	time.AfterFunc(300*time.Millisecond, func() { close(blocks[1]) })
+	check()
+
+	if !checker.failed || len(checker.msgs) < 2 {
+		t.Fatalf("didn't catch the leaked goroutine: %q", checker.msgs)
+	}
+	// goroutines of other tests may come and go in between
+	if reason := checker.msgs[0]; !strings.HasPrefix(reason, "leaktest: context deadline exceeded, with 3 → ") || !strings.HasSuffix(reason, "2 → 1 goroutine(s) remaining") {
+		t.Errorf("reason = %q; want the count to go 3 → 2 → 1", reason)
+	}
+	var leaks int
+	for _, msg := range checker.msgs {
+		if strings.HasPrefix(msg, "leaktest: leaked goroutine") {
+			leaks++
+		}
+	}
+	if leaks != 1 {
+		t.Errorf("want only the goroutine left reported, got %q", checker.msgs)
+	}
+}
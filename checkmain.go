@@ -0,0 +1,227 @@
+package leaktest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CheckMain runs the tests with m.Run, checks whether any goroutines leaked
+// over the whole run, waiting up to 5 seconds in error conditions, then
+// exits. This catches leaks in tests that don't have a Check of their own.
+// If the tests failed, leaks are still reported, noting that they may be a
+// consequence of the failure, and the exit code is the tests'. It's meant to
+// be called from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		leaktest.CheckMain(m)
+//	}
+//
+// While the tests run, CheckMain records which tests were running when each
+// goroutine first appeared, and names that test next to each leak, so that
+// leaks can be traced to their test without instrumenting every test. A
+// goroutine is only seen if it lives for at least TickerInterval. Leaks are
+// reported to standard error, followed by the tests over which the number of
+// goroutines grew, or shrank, the most, and a summary of the time spent
+// checking for leaks, the number and size of goroutine dumps taken and the
+// tests slowest to settle. As with VerifyTestMain, Cleanup is called with the
+// exit code instead of os.Exit.
+//
+// With WithFailFast, CheckMain also watches for goroutines outliving their
+// test while the tests run, as AutoCheckMain does, and aborts the run at the
+// first one rather than report every leak together at the end.
+func CheckMain(m TestingM, opts ...Option) {
+	exitMain(checkMain(m, &mainReporter{}, defaultTimeout(), 0, opts), opts)
+}
+
+// Main is the same as CheckMain, but returns the exit code rather than
+// exiting, for TestMain functions that exit themselves or have more to do
+// once the tests ran:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(leaktest.Main(m))
+//	}
+//
+// The Cleanup option has no effect.
+func Main(m TestingM, opts ...Option) int {
+	return checkMain(m, &mainReporter{}, defaultTimeout(), 0, opts)
+}
+
+// AutoCheckMain is CheckMain with leak checking for every test, without
+// editing the tests. A goroutine that's still running more than 5 seconds,
+// or 20 under the race detector, after the test it appeared during finished
+// is reported as leaked by that test, even if it exits later on, as it may
+// have been cleaned up by another test. It's meant to be called from
+// TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		leaktest.AutoCheckMain(m)
+//	}
+//
+// Test boundaries are detected by sampling the running tests every
+// TickerInterval, so the tests of a package run in parallel are told apart
+// only at the level of top-level tests, and goroutines that appear while
+// several tests run are only reported once all of them finished.
+//
+// By default, leaks are reported together once the tests finished.
+// WithFailFast instead aborts the run as soon as a leak is
+// found, which suits bisecting.
+func AutoCheckMain(m TestingM, opts ...Option) {
+	exitMain(checkMain(m, &mainReporter{}, defaultTimeout(), defaultTimeout(), opts), opts)
+}
+
+// osExit is os.Exit, but for the tests of WithFailFast.
+var osExit = os.Exit
+
+// exitMain exits with exitCode, or calls the Cleanup option with it.
+func exitMain(exitCode int, opts []Option) {
+	if cfg := newConfig(opts); cfg.cleanup != nil {
+		cfg.cleanup(exitCode)
+		return
+	}
+	osExit(exitCode)
+}
+
+// checkMain does the work of CheckMain and, if grace is set, AutoCheckMain,
+// reporting leaks to t, and returns the exit code.
+func checkMain(m TestingM, t ErrorReporter, timeout, grace time.Duration, opts []Option) int {
+	if disabled {
+		return m.Run()
+	}
+	c := NewChecker(t, opts...)
+	var onOutlived func(outlived)
+	if c.cfg.failFast {
+		// failing fast takes finding leaks while the tests run, which
+		// CheckMain otherwise leaves to the end
+		if grace == 0 {
+			grace = defaultTimeout()
+		}
+		onOutlived = c.failFast(grace, opts)
+	}
+	c.timeline = startTimeline(pollInterval(), grace, onOutlived)
+	suiteOverhead.start()
+	defer suiteOverhead.stop()
+	if c.cfg.timeBudget > 0 {
+		waitBudget.set(c.cfg.timeBudget)
+	}
+	exitCode := m.Run()
+	waitBudget.clear()
+	c.timeline.Stop()
+	// leaks are still reported when the tests failed, as are the summary
+	// and the reports, but may well be a consequence of the failure
+	c.testsFailed = exitCode != 0
+	f, ok := t.(failer)
+	report := SuiteReport{Binary: filepath.Base(os.Args[0]), Tests: map[uint64][]string{}, TestsFailed: c.testsFailed}
+	for _, o := range c.timeline.Outlived() {
+		if c.cfg.ignored(o.g) {
+			continue
+		}
+		c.reportOutlived(o, grace)
+		// it's been reported, so it's no longer a leak for the whole run
+		c.orig[o.g.id] = true
+		report.Leaks = append(report.Leaks, newLeaksError([]*goroutine{o.g}).Leaks()...)
+		report.Tests[o.g.id] = o.tests
+	}
+	if c.cfg.notifier != nil || c.cfg.htmlReport != "" {
+		hook := c.cfg.leakHook
+		c.cfg.leakHook = func(test string, leaks []Leak) {
+			for _, l := range leaks {
+				if tests, ok := c.timeline.during(l.ID); ok {
+					report.Tests[l.ID] = tests
+				}
+			}
+			report.Leaks = append(report.Leaks, leaks...)
+			if hook != nil {
+				hook(test, leaks)
+			}
+		}
+	}
+	timer, stop := c.cfg.timer(timeout)
+	defer stop()
+	c.check(context.Background(), timer)
+	if c.cfg.notifier != nil && len(report.Leaks) > 0 {
+		if err := c.cfg.notifier.Notify(report); err != nil {
+			warnf(t, "leaktest: notifying of the leaks: %s", err)
+		}
+	}
+	if c.cfg.htmlReport != "" {
+		report.Timeline = c.timeline.Samples()
+		if err := writeHTMLReportFile(c.cfg.htmlReport, report); err != nil {
+			warnf(t, "leaktest: writing the HTML report: %s", err)
+		}
+	}
+	if c.cfg.inventoryFile != "" {
+		checkInventory(t, c.cfg.inventoryFile, filteredGoroutines(c.cfg))
+	}
+	if growth := c.timeline.Growth(10); growth != "" {
+		logf(t, "leaktest: goroutine growth over the tests that changed it the most:%s", growth)
+	}
+	logf(t, "%s", suiteOverhead.summary())
+	if exitCode == 0 && ok && f.Failed() {
+		return 1
+	}
+	return exitCode
+}
+
+// failFast returns a func that reports the first goroutine it's called with
+// that isn't ignored, and exits, see WithFailFast. Cleanup is called first
+// if set, but as the tests are running in the meantime, there's no
+// returning to them if it doesn't exit.
+func (c *Checker) failFast(grace time.Duration, opts []Option) func(outlived) {
+	var once sync.Once
+	return func(o outlived) {
+		if c.cfg.ignored(o.g) {
+			return
+		}
+		once.Do(func() {
+			c.reportOutlived(o, grace)
+			c.t.Errorf("leaktest: aborting the run, as asked for with WithFailFast")
+			exitMain(1, opts)
+			osExit(1)
+		})
+	}
+}
+
+// reportOutlived reports a goroutine that outlived the tests it appeared
+// during by more than grace.
+func (c *Checker) reportOutlived(o outlived, grace time.Duration) {
+	c.t.Errorf("leaktest: %s leaked a goroutine [%s, fingerprint %s], which outlived it by more than %s: %v",
+		strings.Join(o.tests, " or "), classify(o.g.createdBy, modulePath()), o.g.fingerprint(), grace, c.cfg.format(o.g))
+}
+
+// mainReporter reports to standard error and remembers whether anything
+// was reported as an error, for use from TestMain.
+type mainReporter struct {
+	failed bool
+}
+
+func (r *mainReporter) Errorf(format string, args ...interface{}) {
+	r.failed = true
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+func (r *mainReporter) Logf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+func (r *mainReporter) Failed() bool { return r.failed }
+
+// attribution describes the tests that were running when g first appeared,
+// or returns "" if that isn't known.
+func (c *Checker) attribution(g *goroutine) string {
+	if c.timeline == nil {
+		return ""
+	}
+	tests, ok := c.timeline.during(g.id)
+	switch {
+	case !ok:
+		return ""
+	case len(tests) == 0:
+		return "first appeared between tests"
+	}
+	return "first appeared during " + strings.Join(tests, ", ")
+}
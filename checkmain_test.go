@@ -0,0 +1,271 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runFunc is a TestingM running a func in place of the tests.
+type runFunc func() int
+
+func (f runFunc) Run() int { return f() }
+
+func TestCheckMain(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := &tbReporter{}
+	code := checkMain(runFunc(func() int {
+		go func() { <-block }()
+		// give the timeline a chance to see the goroutine
+		time.Sleep(3 * TickerInterval)
+		return 0
+	}), checker, 100*time.Millisecond, 0, nil)
+	if code != 1 {
+		t.Errorf("exit code = %d; want 1", code)
+	}
+	if !checker.failed {
+		t.Fatal("didn't catch the leaked goroutine")
+	}
+	if !strings.Contains(strings.Join(checker.msgs, "\n"), "(first appeared during TestCheckMain)") {
+		t.Errorf("leak not attributed to TestCheckMain: %q", checker.msgs)
+	}
+}
+
+func TestCheckMainFailedRun(t *testing.T) {
+	checker := &tbReporter{}
+	code := checkMain(runFunc(func() int { return 2 }), checker, 100*time.Millisecond, 0, nil)
+	if code != 2 || checker.failed {
+		t.Errorf("exit code = %d, failed = %t; want 2, false", code, checker.failed)
+	}
+
+	// the leaks, the summary and the reports aren't skipped on a red run
+	block := make(chan struct{})
+	defer close(block)
+	var reports []SuiteReport
+	notifier := notifierFunc(func(r SuiteReport) error {
+		reports = append(reports, r)
+		return nil
+	})
+	checker = &tbReporter{}
+	code = checkMain(runFunc(func() int {
+		go func() { <-block }()
+		time.Sleep(3 * TickerInterval)
+		return 2
+	}), checker, 100*time.Millisecond, 0, []Option{WithNotifier(notifier)})
+	if code != 2 {
+		t.Errorf("exit code = %d; want 2", code)
+	}
+	msgs := strings.Join(checker.msgs, "\n")
+	if !checker.failed || !strings.Contains(msgs, "the test had already failed") {
+		t.Errorf("leak of a failed run not reported as such: %q", checker.msgs)
+	}
+	if len(reports) != 1 || !reports[0].TestsFailed {
+		t.Errorf("want 1 report of a failed run, got %+v", reports)
+	}
+	if !strings.Contains(strings.Join(checker.logs, "\n"), "check(s) took") {
+		t.Errorf("no summary after a failed run: %q", checker.logs)
+	}
+}
+
+func TestMainExitCode(t *testing.T) {
+	for _, want := range []int{0, 3} {
+		if code := Main(runFunc(func() int { return want })); code != want {
+			t.Errorf("Main = %d; want %d", code, want)
+		}
+	}
+}
+
+func TestCheckMainOverheadSummary(t *testing.T) {
+	checker := &tbReporter{}
+	checkMain(runFunc(func() int {
+		r := &tbReporter{name: "TestSlow"}
+		snapshot := CheckTimeout(r, time.Second)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			time.Sleep(50 * time.Millisecond)
+		}()
+		snapshot()
+		<-done
+		return 0
+	}), checker, 100*time.Millisecond, 0, nil)
+	logs := strings.Join(checker.logs, "\n")
+	for _, want := range []string{"check(s) took", "goroutine dump(s) of up to", "slowest to settle: TestSlow ("} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("summary missing %q: %q", want, logs)
+		}
+	}
+}
+
+func TestCheckMainTimeBudget(t *testing.T) {
+	checker := &tbReporter{}
+	var first, second testReporter
+	var elapsed time.Duration
+	checkMain(runFunc(func() int {
+		block := make(chan struct{})
+		defer close(block)
+		start := time.Now()
+		for _, r := range []*testReporter{&first, &second} {
+			snapshot := CheckTimeout(r, 5*time.Second)
+			started := make(chan struct{})
+			go func() {
+				close(started)
+				<-block
+			}()
+			<-started
+			snapshot()
+		}
+		elapsed = time.Since(start)
+		return 0
+	}), checker, 100*time.Millisecond, 0, []Option{WithTimeBudget(200 * time.Millisecond)})
+	if elapsed > 2*time.Second {
+		t.Errorf("checks took %s with a 200ms budget", elapsed)
+	}
+	for _, r := range []*testReporter{&first, &second} {
+		if !r.failed || !strings.Contains(strings.Join(r.msgs, "\n"), errBudget.Error()) {
+			t.Errorf("leak not reported as out of budget: %q", r.msgs)
+		}
+	}
+	if _, _, ok := waitBudget.start(); !ok {
+		t.Error("budget still in force after CheckMain")
+	}
+}
+
+func TestTestFunc(t *testing.T) {
+	g := `goroutine 21 [chan receive]:
+testing.(*T).Run(0xc000102ea0, {0x5b6f7a, 0x3}, 0x5c8a10)
+	/usr/local/go/src/testing/testing.go:1750 +0x3ab
+github.com/fortytw2/leaktest.TestRun.func1(0xc000102d00)
+	/src/run_test.go:9 +0x25
+testing.tRunner(0xc000102d00, 0x5c89f8)
+	/usr/local/go/src/testing/testing.go:1690 +0xf4
+created by testing.(*T).Run in goroutine 1
+	/usr/local/go/src/testing/testing.go:1743 +0x390`
+	if got := testFunc(g); got != "TestRun" {
+		t.Errorf("testFunc = %q; want TestRun", got)
+	}
+}
+
+// tRunnerStack is the stack of the goroutine running the test called name.
+func tRunnerStack(id int, name string) string {
+	return fmt.Sprintf(`goroutine %d [chan receive]:
+example.com/mod.%s(0xc000102d00)
+	/src/mod/mod_test.go:9 +0x25
+testing.tRunner(0xc000102d00, 0x5c89f8)
+	/usr/local/go/src/testing/testing.go:1690 +0xf4
+created by testing.(*T).Run in goroutine 1
+	/usr/local/go/src/testing/testing.go:1743 +0x390`, id, name)
+}
+
+const workerStack = `goroutine 50 [chan receive]:
+example.com/mod.worker()
+	/src/mod/mod.go:10 +0x19
+created by example.com/mod.Start in goroutine 20
+	/src/mod/mod.go:5 +0x5f`
+
+func TestTimelineOutlived(t *testing.T) {
+	tl := newTimeline(time.Second)
+	start := time.Now()
+	tl.record([]byte(tRunnerStack(20, "TestA")+"\n\n"+workerStack), start)
+	tl.record([]byte(tRunnerStack(21, "TestB")+"\n\n"+workerStack), start.Add(time.Second/2))
+	if out := tl.Outlived(); len(out) != 0 {
+		t.Errorf("goroutine outlived TestA within the grace period: %+v", out)
+	}
+	tl.record([]byte(tRunnerStack(21, "TestB")+"\n\n"+workerStack), start.Add(2*time.Second))
+	tl.record([]byte(tRunnerStack(21, "TestB")+"\n\n"+workerStack), start.Add(3*time.Second))
+	out := tl.Outlived()
+	if len(out) != 1 || out[0].g.id != 50 || !reflect.DeepEqual(out[0].tests, []string{"TestA"}) {
+		t.Errorf("got outlived %+v; want goroutine 50 outliving TestA once", out)
+	}
+}
+
+func TestTimelineGrowth(t *testing.T) {
+	tl := newTimeline(0)
+	now := time.Now()
+	tl.record([]byte(tRunnerStack(20, "TestA")), now)
+	tl.record([]byte(tRunnerStack(20, "TestA")+"\n\n"+workerStack), now)
+	tl.record([]byte(tRunnerStack(21, "TestB")+"\n\n"+workerStack), now)
+	tl.record([]byte(workerStack), now)
+	tl.record([]byte(tRunnerStack(22, "TestC")+"\n\n"+workerStack), now)
+	tl.record(nil, now)
+
+	want := "\n\t+1\tTestA\n\t-1\tTestC"
+	if got := tl.Growth(10); got != want {
+		t.Errorf("Growth = %q; want %q", got, want)
+	}
+	if got := tl.Growth(1); got != "\n\t+1\tTestA" {
+		t.Errorf("Growth(1) = %q", got)
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	var codes, exits []int
+	osExit = func(code int) { exits = append(exits, code) }
+	defer func() { osExit = os.Exit }()
+	opts := []Option{WithFailFast(), Cleanup(func(code int) { codes = append(codes, code) })}
+	checker := &testReporter{}
+	c := NewChecker(checker, opts...)
+	g, err := interestingGoroutine(workerStack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onOutlived := c.failFast(time.Second, opts)
+	onOutlived(outlived{g: g, tests: []string{"TestA"}})
+	onOutlived(outlived{g: g, tests: []string{"TestB"}})
+
+	if !reflect.DeepEqual(codes, []int{1}) {
+		t.Errorf("exit codes = %v; want [1]", codes)
+	}
+	if !reflect.DeepEqual(exits, []int{1}) {
+		t.Errorf("exits after Cleanup = %v; want [1]", exits)
+	}
+	msgs := strings.Join(checker.msgs, "\n")
+	if !strings.Contains(msgs, "TestA leaked a goroutine") || strings.Contains(msgs, "TestB") {
+		t.Errorf("want only the first leak reported, got %q", checker.msgs)
+	}
+}
+
+// notifierFunc is a Notifier calling a func.
+type notifierFunc func(SuiteReport) error
+
+func (f notifierFunc) Notify(r SuiteReport) error { return f(r) }
+
+func TestCheckMainNotifier(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	var reports []SuiteReport
+	notifier := notifierFunc(func(r SuiteReport) error {
+		reports = append(reports, r)
+		return fmt.Errorf("unreachable")
+	})
+	checker := &tbReporter{}
+	checkMain(runFunc(func() int {
+		go func() { <-block }()
+		time.Sleep(3 * TickerInterval)
+		return 0
+	}), checker, 100*time.Millisecond, 0, []Option{WithNotifier(notifier)})
+	if len(reports) != 1 || len(reports[0].Leaks) != 1 {
+		t.Fatalf("want 1 report of 1 leak, got %+v", reports)
+	}
+	r := reports[0]
+	if tests := r.Tests[r.Leaks[0].ID]; !reflect.DeepEqual(tests, []string{"TestCheckMainNotifier"}) {
+		t.Errorf("leak attributed to %q; want TestCheckMainNotifier", tests)
+	}
+	if !strings.Contains(strings.Join(checker.logs, "\n"), "leaktest: notifying of the leaks: unreachable") {
+		t.Errorf("notifier error not logged: %q", checker.logs)
+	}
+
+	reports = nil
+	checkMain(runFunc(func() int { return 0 }), &tbReporter{}, 100*time.Millisecond, 0, []Option{WithNotifier(notifier)})
+	if len(reports) != 0 {
+		t.Errorf("notified of a clean run: %+v", reports)
+	}
+}
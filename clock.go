@@ -0,0 +1,39 @@
+package leaktest
+
+import "time"
+
+// Clock is what checks tell the time with, see WithClock. Its methods
+// behave like the functions of package time with the same names, AfterFunc
+// returning the Stop method of the timer it starts.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+// WithClock makes checks wait for timeouts and between polls on clock,
+// instead of on real time, so that tests of how checks behave with custom
+// timeouts can drive them with a fake clock rather than wait. The
+// goroutine advancing a fake clock must be started before the check's
+// baseline is taken, as it's not expected to exit before the check does.
+// With a clock, each check polls on its own rather than sharing the dumps
+// of other checks.
+func WithClock(clock Clock) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
+
+// timer returns a channel receiving once d has elapsed on the config's
+// clock, and a func stopping the timer.
+func (c *config) timer(d time.Duration) (<-chan time.Time, func() bool) {
+	if c.clock == nil {
+		t := time.NewTimer(d)
+		return t.C, t.Stop
+	}
+	ch := make(chan time.Time, 1)
+	clock := c.clock
+	stop := clock.AfterFunc(d, func() {
+		ch <- clock.Now()
+	})
+	return ch, stop
+}
@@ -0,0 +1,106 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only moves when advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) func() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		stopped := t.stopped
+		t.stopped = true
+		return !stopped
+	}
+}
+
+// Advance moves the clock forward by d, running the funcs of the timers
+// that fire.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []func()
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		switch {
+		case t.stopped:
+		case !t.at.After(c.now):
+			t.stopped = true
+			due = append(due, t.f)
+		default:
+			pending = append(pending, t)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+	for _, f := range due {
+		f()
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	// the goroutine driving the clock must predate the baseline
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				clock.Advance(time.Minute)
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := &testReporter{}
+	c := NewChecker(checker, WithClock(clock))
+	started := make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+	start := time.Now()
+	c.CheckTimeout(time.Hour)
+	if !checker.failed {
+		t.Error("leak not reported")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("check waiting an hour on the fake clock took %s", elapsed)
+	}
+	if now := clock.Now(); now.Sub(time.Unix(0, 0)) < time.Hour {
+		t.Errorf("check returned at %s on the fake clock, before its timeout", now)
+	}
+}
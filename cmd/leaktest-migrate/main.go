@@ -0,0 +1,90 @@
+// Command leaktest-migrate rewrites uses of go.uber.org/goleak into the
+// equivalent github.com/fortytw2/leaktest APIs, which mirror goleak's.
+//
+// Usage:
+//
+//	leaktest-migrate [-w] [path ...]
+//
+// Each path is a Go file, or a directory that is walked for Go files. By
+// default the rewritten files are printed to standard output; with -w they
+// are written back in place. Files using parts of goleak that leaktest has
+// no equivalent for, or declaring another leaktest, are reported and left
+// alone. Files that already import leaktest keep that single import.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	write := flag.Bool("w", false, "write the result to the source files instead of standard output")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: leaktest-migrate [-w] [path ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	failed := false
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if name := d.Name(); path != "." && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasSuffix(path, ".go") {
+				return nil
+			}
+			if err := migrateFile(path, *write); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+				failed = true
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func migrateFile(path string, write bool) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	out, changed, err := migrate(path, src)
+	var unsupported *unsupportedError
+	if errors.As(err, &unsupported) {
+		return err
+	}
+	if err != nil || !changed {
+		return err
+	}
+	if !write {
+		_, err := os.Stdout.Write(out)
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, info.Mode().Perm())
+}
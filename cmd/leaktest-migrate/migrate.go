@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+const (
+	goleakPath   = "go.uber.org/goleak"
+	leaktestPath = "github.com/fortytw2/leaktest"
+)
+
+// renames maps the goleak identifiers with a leaktest equivalent to that
+// equivalent. Most have the same name, as leaktest mirrors goleak's API.
+var renames = map[string]string{
+	"Cleanup":           "Cleanup",
+	"Find":              "Find",
+	"IgnoreAnyFunction": "IgnoreAnyFunction",
+	"IgnoreCurrent":     "IgnoreCurrent",
+	"IgnoreTopFunction": "IgnoreTopFunction",
+	"MaxRetries":        "MaxRetries",
+	"MaxSleep":          "MaxSleep",
+	"Option":            "Option",
+	"TestingM":          "TestingM",
+	"TestingT":          "ErrorReporter",
+	"VerifyNone":        "VerifyNone",
+	"VerifyTestMain":    "VerifyTestMain",
+}
+
+// unsupportedError lists the goleak identifiers in a file that have no
+// leaktest equivalent.
+type unsupportedError struct {
+	uses []string
+}
+
+func (e *unsupportedError) Error() string {
+	msg := "no leaktest equivalent for"
+	for _, u := range e.uses {
+		msg += "\n\t" + u
+	}
+	return msg
+}
+
+// conflictError is returned for a file the goleak import can't be rewritten
+// in without changing what another identifier refers to.
+type conflictError struct {
+	msg string
+}
+
+func (e *conflictError) Error() string { return e.msg }
+
+// migrate rewrites the goleak call sites in a Go source file into their
+// leaktest equivalents, merging them into the file's leaktest import if it
+// already has one. It reports whether the file uses goleak at all, and
+// returns an *unsupportedError, leaving the file alone, if it uses parts of
+// goleak that leaktest has no equivalent for, or a *conflictError if the
+// name leaktest would be imported as is taken.
+func migrate(filename string, src []byte) ([]byte, bool, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var imp, existing *ast.ImportSpec
+	for _, spec := range f.Imports {
+		switch path, _ := strconv.Unquote(spec.Path.Value); path {
+		case goleakPath:
+			imp = spec
+		case leaktestPath:
+			existing = spec
+		}
+	}
+	if imp == nil {
+		return src, false, nil
+	}
+	goleak := resolve(fset, f, imp)
+
+	var sels []*ast.SelectorExpr
+	var unsupported []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); !ok || !goleak[x] {
+			return true
+		}
+		if _, ok := renames[sel.Sel.Name]; !ok {
+			unsupported = append(unsupported, fmt.Sprintf("%s: %s.%s", fset.Position(sel.Pos()), sel.X, sel.Sel.Name))
+		}
+		sels = append(sels, sel)
+		return true
+	})
+	if len(unsupported) > 0 {
+		return nil, true, &unsupportedError{uses: unsupported}
+	}
+
+	var newName string
+	switch {
+	case existing != nil && existing.Name == nil:
+		newName = "leaktest"
+	case existing != nil && (existing.Name.Name == "_" || existing.Name.Name == "."):
+		return nil, true, &conflictError{fmt.Sprintf("%s: leaktest is already imported as %s", fset.Position(existing.Pos()), existing.Name.Name)}
+	case existing != nil:
+		newName = existing.Name.Name
+	case imp.Name != nil:
+		newName = imp.Name.Name
+	default:
+		newName = "leaktest"
+		// anything else called leaktest would be shadowed by the import,
+		// or shadow it
+		var taken token.Pos
+		ast.Inspect(f, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Name == newName && taken == token.NoPos {
+				taken = id.Pos()
+			}
+			return taken == token.NoPos
+		})
+		if taken != token.NoPos {
+			return nil, true, &conflictError{fmt.Sprintf("%s: leaktest is already declared or used in this file", fset.Position(taken))}
+		}
+	}
+
+	if existing != nil {
+		removeImport(f, imp)
+	} else {
+		imp.Path.Value = strconv.Quote(leaktestPath)
+	}
+	for _, sel := range sels {
+		sel.X.(*ast.Ident).Name = newName
+		sel.Sel.Name = renames[sel.Sel.Name]
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return nil, true, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+// resolve returns the identifiers in f that refer to the package imported by
+// imp, rather than to a declaration shadowing it. The file is type-checked on
+// its own, with the imports stubbed out, so it reports errors about every
+// imported identifier, which are ignored: only scopes matter here.
+func resolve(fset *token.FileSet, f *ast.File, imp *ast.ImportSpec) map[*ast.Ident]bool {
+	conf := types.Config{
+		Importer: stubImporter{},
+		Error:    func(error) {},
+	}
+	info := &types.Info{
+		Defs:      map[*ast.Ident]types.Object{},
+		Uses:      map[*ast.Ident]types.Object{},
+		Implicits: map[ast.Node]types.Object{},
+	}
+	conf.Check(f.Name.Name, fset, []*ast.File{f}, info)
+
+	pkgName := info.Implicits[imp]
+	if imp.Name != nil {
+		pkgName = info.Defs[imp.Name]
+	}
+	ids := map[*ast.Ident]bool{}
+	for id, obj := range info.Uses {
+		if obj != nil && obj == pkgName {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// stubImporter imports every package as an empty one named after the last
+// element of its path, or goleak for goleak's.
+type stubImporter struct{}
+
+func (stubImporter) Import(path string) (*types.Package, error) {
+	name := path[strings.LastIndex(path, "/")+1:]
+	if path == goleakPath {
+		name = "goleak"
+	}
+	pkg := types.NewPackage(path, name)
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+// removeImport removes spec from the imports of f.
+func removeImport(f *ast.File, spec *ast.ImportSpec) {
+	for i, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		for j, s := range gen.Specs {
+			if s != spec {
+				continue
+			}
+			gen.Specs = append(gen.Specs[:j], gen.Specs[j+1:]...)
+			if len(gen.Specs) == 0 {
+				f.Decls = append(f.Decls[:i], f.Decls[i+1:]...)
+			}
+			break
+		}
+	}
+	for i, s := range f.Imports {
+		if s == spec {
+			f.Imports = append(f.Imports[:i], f.Imports[i+1:]...)
+			break
+		}
+	}
+}
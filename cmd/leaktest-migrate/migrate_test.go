@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	src := `package foo
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m, goleak.IgnoreTopFunction("foo.bar"))
+}
+
+func TestFoo(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	var _ goleak.TestingT = t
+}
+`
+	want := `package foo
+
+import (
+	"testing"
+
+	"github.com/fortytw2/leaktest"
+)
+
+func TestMain(m *testing.M) {
+	leaktest.VerifyTestMain(m, leaktest.IgnoreTopFunction("foo.bar"))
+}
+
+func TestFoo(t *testing.T) {
+	defer leaktest.VerifyNone(t, leaktest.IgnoreCurrent())
+	var _ leaktest.ErrorReporter = t
+}
+`
+	out, changed, err := migrate("foo_test.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("changed = false")
+	}
+	if string(out) != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestMigrateAlias(t *testing.T) {
+	src := `package foo
+
+import gl "go.uber.org/goleak"
+
+var opts = []gl.Option{gl.IgnoreAnyFunction("foo.bar")}
+`
+	out, _, err := migrate("foo.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `import gl "github.com/fortytw2/leaktest"`) ||
+		!strings.Contains(string(out), `[]gl.Option{gl.IgnoreAnyFunction("foo.bar")}`) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestMigrateUnsupported(t *testing.T) {
+	src := `package foo
+
+import "go.uber.org/goleak"
+
+var opt = goleak.IgnoreCreatedBy("foo.bar")
+`
+	_, _, err := migrate("foo.go", []byte(src))
+	var unsupported *unsupportedError
+	if !errors.As(err, &unsupported) || !strings.Contains(err.Error(), "goleak.IgnoreCreatedBy") {
+		t.Errorf("err = %v; want unsupported goleak.IgnoreCreatedBy", err)
+	}
+}
+
+func TestMigrateNoGoleak(t *testing.T) {
+	src := "package foo\n"
+	out, changed, err := migrate("foo.go", []byte(src))
+	if err != nil || changed || string(out) != src {
+		t.Errorf("migrate = %q, %v, %v; want the source unchanged", out, changed, err)
+	}
+}
+
+func TestMigrateAlreadyImported(t *testing.T) {
+	src := `package foo
+
+import (
+	"testing"
+
+	"github.com/fortytw2/leaktest"
+	"go.uber.org/goleak"
+)
+
+func TestFoo(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	defer leaktest.Check(t)()
+}
+`
+	want := `package foo
+
+import (
+	"testing"
+
+	"github.com/fortytw2/leaktest"
+)
+
+func TestFoo(t *testing.T) {
+	defer leaktest.VerifyNone(t)
+	defer leaktest.Check(t)()
+}
+`
+	out, _, err := migrate("foo_test.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+
+	src = `package foo
+
+import lt "github.com/fortytw2/leaktest"
+import "go.uber.org/goleak"
+
+var opts = []goleak.Option{lt.IgnoreCurrent()}
+`
+	out, _, err = migrate("foo.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "goleak") || !strings.Contains(string(out), "[]lt.Option{lt.IgnoreCurrent()}") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestMigrateConflict(t *testing.T) {
+	src := `package foo
+
+import "go.uber.org/goleak"
+
+var leaktest = goleak.IgnoreCurrent()
+`
+	_, _, err := migrate("foo.go", []byte(src))
+	var conflict *conflictError
+	if !errors.As(err, &conflict) {
+		t.Errorf("err = %v; want a conflict", err)
+	}
+}
+
+func TestMigrateShadowed(t *testing.T) {
+	src := `package foo
+
+import "go.uber.org/goleak"
+
+var opt = goleak.IgnoreCurrent()
+
+func f() {
+	goleak := struct{ Find func() }{}
+	goleak.Find()
+}
+`
+	out, _, err := migrate("foo.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "var opt = leaktest.IgnoreCurrent()") || !strings.Contains(string(out), "\tgoleak.Find()") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
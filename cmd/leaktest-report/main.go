@@ -0,0 +1,87 @@
+// Command leaktest-report renders a goroutine dump as a self-contained HTML
+// page, with the goroutines leaktest would report grouped by fingerprint and
+// their stacks collapsed, which is easier to attach to a bug report than
+// the raw dump.
+//
+// Usage:
+//
+//	leaktest-report [-o report.html] [file]
+//
+// The dump is read from file, or standard input, and may be surrounded by
+// other output, such as that of a test binary that timed out or got
+// SIGQUIT. The page is written to standard output unless -o is given. To
+// render the report of a whole test run instead, use
+// leaktest.WithHTMLReport.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/fortytw2/leaktest"
+)
+
+func main() {
+	out := flag.String("o", "", "write the report to `file` instead of standard output")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: leaktest-report [-o report.html] [file]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), *out); err != nil {
+		fmt.Fprintln(os.Stderr, "leaktest-report:", err)
+		os.Exit(1)
+	}
+}
+
+// run renders the dump in the file at in, or standard input if in is "",
+// to the file at out, or standard output if out is "".
+func run(in, out string) error {
+	name := "standard input"
+	r := io.Reader(os.Stdin)
+	if in != "" {
+		f, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		name, r = filepath.Base(in), f
+	}
+	dump, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		bw := bufio.NewWriter(os.Stdout)
+		if err := render(bw, name, dump); err != nil {
+			return err
+		}
+		return bw.Flush()
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	err = render(bw, name, dump)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// render writes the report of dump, which was read from name, to w.
+func render(w io.Writer, name string, dump []byte) error {
+	return leaktest.WriteHTMLReport(w, leaktest.SuiteReport{Binary: name, Leaks: leaktest.ParseDump(dump)})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "dump.txt"), filepath.Join(dir, "report.html")
+	dump := `goroutine 7 [chan receive]:
+example.com/pkg.(*Server).loop(0xc000010000)
+	/src/pkg/server.go:42 +0x25
+created by example.com/pkg.NewServer in goroutine 6
+	/src/pkg/server.go:20 +0x90
+`
+	if err := os.WriteFile(in, []byte(dump), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(in, out); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(b)
+	for _, want := range []string{"<title>leaktest: dump.txt</title>", "1 leaked goroutine(s)", "example.com/pkg.NewServer"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("report missing %q:\n%s", want, page)
+		}
+	}
+}
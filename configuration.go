@@ -0,0 +1,100 @@
+package leaktest
+
+// LeakCheckConfiguration lists goroutines that are never considered leaked.
+// Its fields follow the vocabulary of go.uber.org/goleak, so that projects
+// using both libraries can keep a single suppression list: keep it as a
+// LeakCheckConfiguration, pass it to leaktest with Option, and to goleak
+// with GoleakOptions. go.uber.org/goleak's own options are opaque, so a
+// list written as options is converted back with ConfigurationOf from
+// leaktest's goleak-style IgnoreTopFunction and IgnoreAnyFunction.
+type LeakCheckConfiguration struct {
+	// IgnoreTopFunctions ignores goroutines whose innermost function is one
+	// of these, like goleak.IgnoreTopFunction
+	IgnoreTopFunctions []string
+	// IgnoreAnyFunctions ignores goroutines with one of these functions
+	// anywhere in their stack, like goleak.IgnoreAnyFunction
+	IgnoreAnyFunctions []string
+}
+
+// DefaultCheckConfiguration applies to every check, in addition to the
+// Options passed to it.
+//
+// Deprecated: Changing DefaultCheckConfiguration while checks run is a data
+// race. Use SetDefaultConfig instead, with Config.WithIgnoreTopFunctions and
+// Config.WithIgnoreAnyFunctions, or LeakCheckConfiguration.Option passed to
+// Config.WithOptions.
+var DefaultCheckConfiguration LeakCheckConfiguration
+
+// Option returns an Option applying lc to a single check.
+func (lc LeakCheckConfiguration) Option() Option {
+	return func(c *config) {
+		c.ignoreTop = append(c.ignoreTop, lc.IgnoreTopFunctions...)
+		c.ignoreAny = append(c.ignoreAny, lc.IgnoreAnyFunctions...)
+	}
+}
+
+// GoleakOptions converts lc into goleak options, given goleak's option
+// constructors, without leaktest having to depend on goleak:
+//
+//	opts := leaktest.GoleakOptions(lc, goleak.IgnoreTopFunction, goleak.IgnoreAnyFunction)
+//	goleak.VerifyNone(t, opts...)
+func GoleakOptions[O any](lc LeakCheckConfiguration, ignoreTopFunction, ignoreAnyFunction func(string) O) []O {
+	opts := make([]O, 0, len(lc.IgnoreTopFunctions)+len(lc.IgnoreAnyFunctions))
+	for _, fn := range lc.IgnoreTopFunctions {
+		opts = append(opts, ignoreTopFunction(fn))
+	}
+	for _, fn := range lc.IgnoreAnyFunctions {
+		opts = append(opts, ignoreAnyFunction(fn))
+	}
+	return opts
+}
+
+// ConfigurationOf returns the goroutines opts ignore as a
+// LeakCheckConfiguration, such as from a suppression list written with
+// IgnoreTopFunction and IgnoreAnyFunction, to pass on to goleak with
+// GoleakOptions:
+//
+//	ignores := []leaktest.Option{leaktest.IgnoreTopFunction("example.com/pkg.worker")}
+//	lc := leaktest.ConfigurationOf(ignores...)
+//	goleak.VerifyNone(t, leaktest.GoleakOptions(lc, goleak.IgnoreTopFunction, goleak.IgnoreAnyFunction)...)
+//
+// Options other than those two have no goleak counterpart and are left out.
+func ConfigurationOf(opts ...Option) LeakCheckConfiguration {
+	var c config
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return LeakCheckConfiguration{
+		IgnoreTopFunctions: c.ignoreTop,
+		IgnoreAnyFunctions: c.ignoreAny,
+	}
+}
+
+// ignored reports whether g is ignored by the IgnoreTopFunctions or
+// IgnoreAnyFunctions in effect, or exempted by SetBaseline or
+// WithExemptInitGoroutines.
+func (c *config) ignored(g *goroutine) bool {
+	if g.keepAlive && !c.keepAlives {
+		return true
+	}
+	if exempted(g) || (c.exemptInit && startedByInit(g)) {
+		return true
+	}
+	if len(c.ignoreTop) == 0 && len(c.ignoreAny) == 0 {
+		return false
+	}
+	fns := stackFunctions(g.stack)
+	for _, ignore := range c.ignoreTop {
+		if len(fns) > 0 && fns[0] == ignore {
+			return true
+		}
+	}
+	for _, ignore := range c.ignoreAny {
+		for _, fn := range fns {
+			if fn == ignore {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ignoredTopLeak(block chan struct{}) {
+	<-block
+}
+
+func ignoredAnyLeak(block chan struct{}) {
+	ignoredTopLeak(block)
+}
+
+func TestLeakCheckConfiguration(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	lc := LeakCheckConfiguration{
+		IgnoreTopFunctions: []string{"github.com/fortytw2/leaktest.ignoredTopLeak"},
+	}
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, time.Second, lc.Option())
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		ignoredTopLeak(block)
+	}()
+	<-started
+	snapshot()
+	if checker.failed {
+		t.Errorf("ignored top function was reported: %q", checker.msgs)
+	}
+
+	lc = LeakCheckConfiguration{
+		IgnoreAnyFunctions: []string{"github.com/fortytw2/leaktest.ignoredAnyLeak"},
+	}
+	DefaultCheckConfiguration = lc
+	defer func() { DefaultCheckConfiguration = LeakCheckConfiguration{} }()
+	checker = &testReporter{}
+	snapshot = CheckTimeout(checker, time.Second)
+	started = make(chan struct{})
+	go func() {
+		close(started)
+		ignoredAnyLeak(block)
+	}()
+	<-started
+	snapshot()
+	if checker.failed {
+		t.Errorf("ignored function was reported: %q", checker.msgs)
+	}
+}
+
+func TestGoleakOptions(t *testing.T) {
+	lc := LeakCheckConfiguration{
+		IgnoreTopFunctions: []string{"a.top"},
+		IgnoreAnyFunctions: []string{"b.any"},
+	}
+	top := func(fn string) fmt.Stringer { return goleakOption("top " + fn) }
+	any := func(fn string) fmt.Stringer { return goleakOption("any " + fn) }
+	got := GoleakOptions(lc, top, any)
+	want := []fmt.Stringer{goleakOption("top a.top"), goleakOption("any b.any")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GoleakOptions = %v; want %v", got, want)
+	}
+}
+
+func TestConfigurationOf(t *testing.T) {
+	got := ConfigurationOf(IgnoreTopFunction("a.top"), IgnoreAnyFunction("b.any"), WithFailFast(), IgnoreTopFunction("c.top"))
+	want := LeakCheckConfiguration{
+		IgnoreTopFunctions: []string{"a.top", "c.top"},
+		IgnoreAnyFunctions: []string{"b.any"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigurationOf = %+v; want %+v", got, want)
+	}
+}
+
+// goleakOption stands in for goleak.Option, which is an interface.
+type goleakOption string
+
+func (o goleakOption) String() string { return string(o) }
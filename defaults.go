@@ -0,0 +1,127 @@
+package leaktest
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Config holds the defaults applied to every leak check. It's immutable:
+// its With methods return modified copies, so a Config can be shared and
+// built upon freely. Install one with SetDefaultConfig.
+//
+//	leaktest.SetDefaultConfig(leaktest.NewConfig().
+//		WithTickerInterval(10 * time.Millisecond).
+//		WithIgnoreTopFunctions("go.opencensus.io/stats/view.(*worker).start"))
+type Config struct {
+	tickerInterval time.Duration
+	ignoreTop      []string
+	ignoreAny      []string
+	preCheckHooks  []func()
+	opts           []Option
+}
+
+// NewConfig returns an empty Config, which leaves every default as is.
+func NewConfig() Config {
+	return Config{}
+}
+
+// WithTickerInterval returns a copy of c in which checks poll for leaked
+// goroutines to exit every d, instead of TickerInterval.
+func (c Config) WithTickerInterval(d time.Duration) Config {
+	c.tickerInterval = d
+	return c
+}
+
+// WithIgnoreTopFunctions returns a copy of c that also ignores goroutines
+// whose innermost function is one of fns, as with IgnoreTopFunction.
+func (c Config) WithIgnoreTopFunctions(fns ...string) Config {
+	c.ignoreTop = appendCopy(c.ignoreTop, fns...)
+	return c
+}
+
+// WithIgnoreAnyFunctions returns a copy of c that also ignores goroutines
+// with one of fns anywhere in their stack, as with IgnoreAnyFunction.
+func (c Config) WithIgnoreAnyFunctions(fns ...string) Config {
+	c.ignoreAny = appendCopy(c.ignoreAny, fns...)
+	return c
+}
+
+// WithPreCheckHooks returns a copy of c that also runs hooks before every
+// check, as with the WithPreCheckHooks Option.
+func (c Config) WithPreCheckHooks(hooks ...func()) Config {
+	c.preCheckHooks = appendCopy(c.preCheckHooks, hooks...)
+	return c
+}
+
+// WithOptions returns a copy of c that also applies opts to every check,
+// before the Options passed to the check itself.
+func (c Config) WithOptions(opts ...Option) Config {
+	c.opts = appendCopy(c.opts, opts...)
+	return c
+}
+
+// TickerInterval returns the interval set by WithTickerInterval, or 0 if
+// there is none.
+func (c Config) TickerInterval() time.Duration {
+	return c.tickerInterval
+}
+
+// Option returns an Option applying c to a single check, other than its
+// ticker interval, which only applies process-wide.
+func (c Config) Option() Option {
+	return func(cfg *config) {
+		cfg.ignoreTop = append(cfg.ignoreTop, c.ignoreTop...)
+		cfg.ignoreAny = append(cfg.ignoreAny, c.ignoreAny...)
+		cfg.preCheckHooks = append(cfg.preCheckHooks, c.preCheckHooks...)
+		for _, opt := range c.opts {
+			opt(cfg)
+		}
+	}
+}
+
+// appendCopy appends to a copy of s, so that Configs sharing s are
+// unaffected.
+func appendCopy[T any](s []T, vs ...T) []T {
+	out := make([]T, 0, len(s)+len(vs))
+	return append(append(out, s...), vs...)
+}
+
+// defaultConfig is the Config installed by SetDefaultConfig.
+var defaultConfig atomic.Pointer[Config]
+
+// SetDefaultConfig makes c apply to every check from now on, replacing the
+// Config set before. It's safe to call while checks are running, unlike
+// mutating TickerInterval or DefaultCheckConfiguration.
+func SetDefaultConfig(c Config) {
+	defaultConfig.Store(&c)
+}
+
+// DefaultConfig returns the Config installed by SetDefaultConfig.
+func DefaultConfig() Config {
+	if c := defaultConfig.Load(); c != nil {
+		return *c
+	}
+	return Config{}
+}
+
+// pollInterval returns how often checks poll for leaked goroutines to exit.
+func pollInterval() time.Duration {
+	if d := DefaultConfig().tickerInterval; d > 0 {
+		return d
+	}
+	return TickerInterval
+}
+
+// raceSlowdown is how many times longer checks wait by default under the
+// race detector, which slows code down by 2-20x, so that slow but correct
+// shutdowns aren't reported as leaks.
+const raceSlowdown = 4
+
+// defaultTimeout returns how long checks wait for leaked goroutines to exit
+// unless given a timeout: 5 seconds, or 20 under the race detector.
+func defaultTimeout() time.Duration {
+	if raceEnabled {
+		return raceSlowdown * 5 * time.Second
+	}
+	return 5 * time.Second
+}
@@ -0,0 +1,58 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigIsImmutable(t *testing.T) {
+	base := NewConfig().WithIgnoreTopFunctions("a")
+	a := base.WithIgnoreTopFunctions("b")
+	b := base.WithIgnoreTopFunctions("c")
+	if !reflect.DeepEqual(base.ignoreTop, []string{"a"}) ||
+		!reflect.DeepEqual(a.ignoreTop, []string{"a", "b"}) ||
+		!reflect.DeepEqual(b.ignoreTop, []string{"a", "c"}) {
+		t.Errorf("configs share state: %q, %q, %q", base.ignoreTop, a.ignoreTop, b.ignoreTop)
+	}
+	if d := base.WithTickerInterval(time.Second).TickerInterval(); d != time.Second {
+		t.Errorf("TickerInterval = %s; want 1s", d)
+	}
+	if d := base.TickerInterval(); d != 0 {
+		t.Errorf("TickerInterval = %s after copying; want 0", d)
+	}
+}
+
+func TestSetDefaultConfig(t *testing.T) {
+	defer SetDefaultConfig(DefaultConfig())
+	SetDefaultConfig(NewConfig().
+		WithTickerInterval(10 * time.Millisecond).
+		WithIgnoreAnyFunctions("github.com/fortytw2/leaktest.blockedGoroutine"))
+	if d := pollInterval(); d != 10*time.Millisecond {
+		t.Errorf("pollInterval = %s; want 10ms", d)
+	}
+
+	block := make(chan struct{})
+	defer close(block)
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond)
+	started := make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+	snapshot()
+	if checker.failed {
+		t.Errorf("goroutine ignored by the default config reported: %q", checker.msgs)
+	}
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	want := 5 * time.Second
+	if raceEnabled {
+		want = 20 * time.Second
+	}
+	if d := defaultTimeout(); d != want {
+		t.Errorf("defaultTimeout() = %s with raceEnabled = %t; want %s", d, raceEnabled, want)
+	}
+}
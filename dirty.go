@@ -0,0 +1,33 @@
+package leaktest
+
+import "strings"
+
+// warnDirtyBaseline warns if the baseline snapshot already contains
+// goroutines that look leaked: started by the module under test and blocked
+// for at least a minute. Most likely a previous test leaked them, and as
+// they're part of the baseline this check can't see them, nor may it see
+// new leaks of the same kind masked by them.
+func (c *Checker) warnDirtyBaseline(baseline []*goroutine) {
+	module := modulePath()
+	var dirty []string
+	for _, g := range baseline {
+		if looksLeaked(g, module) {
+			dirty = append(dirty, c.cfg.format(g))
+		}
+	}
+	if len(dirty) == 0 {
+		return
+	}
+	warnf(c.t, "leaktest: warning: %d goroutine(s) already running when the check started look leaked by a previous test, which this check can't detect:\n%s",
+		len(dirty), strings.Join(dirty, "\n\n"))
+}
+
+// looksLeaked reports whether g was started by the module under test and
+// has been blocked on a channel or lock for a long time.
+func looksLeaked(g *goroutine, module string) bool {
+	if class := classify(g.createdBy, module); class != ClassFirstParty && class != ClassTest {
+		return false
+	}
+	// the runtime only shows the wait time once it's at least a minute
+	return g.waited > 0 && g.state.blocked()
+}
@@ -0,0 +1,48 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLooksLeaked(t *testing.T) {
+	const module = "example.com/mod"
+	stack := func(header, creator string) *goroutine {
+		g, err := interestingGoroutine(header + "\nexample.com/mod.worker()\n\t/src/mod/worker.go:10 +0x1\ncreated by " + creator + " in goroutine 1\n\t/src/mod/worker.go:5 +0x2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return g
+	}
+	for _, tc := range []struct {
+		g    *goroutine
+		want bool
+	}{
+		{stack("goroutine 7 [chan receive, 3 minutes]:", "example.com/mod.Start"), true},
+		{stack("goroutine 7 [chan receive]:", "example.com/mod.Start"), false},
+		{stack("goroutine 7 [IO wait, 3 minutes]:", "example.com/mod.Start"), false},
+		{stack("goroutine 7 [chan receive, 3 minutes]:", "example.com/other.Start"), false},
+	} {
+		if got := looksLeaked(tc.g, module); got != tc.want {
+			t.Errorf("looksLeaked(%q) = %t; want %t", tc.g.stack, got, tc.want)
+		}
+	}
+}
+
+func TestWarnDirtyBaseline(t *testing.T) {
+	g, err := interestingGoroutine("goroutine 7 [chan receive, 3 minutes]:\nmain.worker()\n\t/src/main.go:10 +0x1\ncreated by main.main in goroutine 1\n\t/src/main.go:5 +0x2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := &tbReporter{}
+	c := &Checker{t: checker, cfg: newConfig(nil)}
+	c.warnDirtyBaseline([]*goroutine{g})
+	if checker.failed {
+		t.Error("dirty baseline failed the test")
+	}
+	if len(checker.logs) != 1 || !strings.Contains(checker.logs[0], "main.worker()") {
+		t.Errorf("got warnings %q; want one naming main.worker", checker.logs)
+	}
+}
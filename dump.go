@@ -0,0 +1,106 @@
+package leaktest
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime/pprof"
+	"strings"
+)
+
+// writeDump writes the full goroutine dump to a file if the config asks for
+// it, and returns a message saying where the file ended up, or "". Even if
+// it doesn't, the dump is written as a test artifact when go test runs with
+// -artifacts, which the testing package announces itself.
+func writeDump(t ErrorReporter, cfg *config) string {
+	if !cfg.dump {
+		a, ok := t.(artifactDirer)
+		if !ok || !keepArtifacts() {
+			return ""
+		}
+		if _, err := dumpGoroutines(a.ArtifactDir(), testName(t)); err != nil {
+			return fmt.Sprintf("leaktest: error writing goroutine dump: %s", err)
+		}
+		return ""
+	}
+	path, err := dumpGoroutines(artifactDir(t, cfg), testName(t))
+	if err != nil {
+		return fmt.Sprintf("leaktest: error writing goroutine dump: %s", err)
+	}
+	return fmt.Sprintf("leaktest: full goroutine dump written to %s", path)
+}
+
+// artifactDir returns the directory files written on failure go in, see
+// WithDumpDir.
+func artifactDir(t ErrorReporter, cfg *config) string {
+	if cfg.dumpDir != "" {
+		return cfg.dumpDir
+	}
+	if a, ok := t.(artifactDirer); ok {
+		return a.ArtifactDir()
+	}
+	if td, ok := t.(tempDirer); ok {
+		return td.TempDir()
+	}
+	return os.TempDir()
+}
+
+// keepArtifacts reports whether go test runs with -artifacts, which keeps
+// the files written to the tests' ArtifactDir.
+func keepArtifacts() bool {
+	f := flag.Lookup("test.artifacts")
+	return f != nil && f.Value.String() == "true"
+}
+
+// dumpAll logs the goroutines that were part of the baseline snapshot, to
+// go alongside the leaked ones that have already been reported.
+func dumpAll(t ErrorReporter, cfg *config, orig map[uint64]bool, all []*goroutine) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	for _, g := range all {
+		if orig[g.id] {
+			logf(t, "leaktest: baseline goroutine: %v", cfg.format(g))
+		}
+	}
+}
+
+func dumpGoroutines(dir, name string) (string, error) {
+	pattern := "leaktest-goroutines-*.txt"
+	if name != "" {
+		pattern = "leaktest-" + sanitizeFileName(name) + "-*.txt"
+	}
+	return writeArtifact(dir, pattern, func(w io.Writer) error {
+		return pprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+}
+
+// writeArtifact creates a file named after pattern, as with os.CreateTemp,
+// in dir, writes it with write and returns its path.
+func writeArtifact(dir, pattern string, write func(w io.Writer) error) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// sanitizeFileName replaces characters that commonly cause trouble in file
+// names, such as the slashes in subtest names.
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', ' ':
+			return '_'
+		}
+		return r
+	}, name)
+}
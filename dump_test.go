@@ -0,0 +1,64 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithDumpDir(t *testing.T) {
+	dir, err := os.MkdirTemp("", "leaktest-dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond, WithDumpDir(dir))
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+	snapshot()
+
+	const prefix = "leaktest: full goroutine dump written to "
+	if !strings.HasPrefix(checker.msg, prefix) {
+		t.Fatalf("last message = %q; want dump path", checker.msg)
+	}
+	b, err := os.ReadFile(strings.TrimPrefix(checker.msg, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "TestWithDumpDir") {
+		t.Errorf("goroutine dump does not mention the leaking test:\n%s", b)
+	}
+}
+
+func TestWithDumpAllOnFailure(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond, WithDumpAllOnFailure())
+	go func() { <-block }()
+	snapshot()
+
+	var leaked, baseline int
+	for _, msg := range checker.msgs {
+		switch {
+		case strings.HasPrefix(msg, "leaktest: leaked goroutine [test-code, fingerprint "):
+			leaked++
+		case strings.HasPrefix(msg, "leaktest: baseline goroutine: "):
+			baseline++
+		}
+	}
+	if leaked != 1 {
+		t.Errorf("got %d leaked goroutines; want 1", leaked)
+	}
+	if baseline == 0 {
+		t.Error("baseline goroutines were not logged")
+	}
+}
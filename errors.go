@@ -0,0 +1,98 @@
+package leaktest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrLeaks is matched by errors.Is for any *LeaksError, so that callers of
+// Checker.Verify can tell leaks apart from other errors.
+var ErrLeaks = errors.New("leaktest: leaked goroutines")
+
+// Leak describes a single leaked goroutine. It implements error, so that it
+// can be found with errors.As in the error returned by Checker.Verify.
+type Leak struct {
+	// ID is the goroutine's ID
+	ID uint64
+	// Stack is the goroutine's stack, including its header line
+	Stack string
+	// CreatedBy is the function whose go statement started the goroutine,
+	// followed by its file and line, or "" for the main goroutine
+	CreatedBy string
+	// File and Line locate the go statement in CreatedBy, if known
+	File string
+	Line int
+	// Class says whether CreatedBy is in the module under test, its tests,
+	// a dependency or the standard library
+	Class Class
+	// Fingerprint identifies the leaks from the same place for the same
+	// reason, as accepted by WithQuarantined
+	Fingerprint string
+	// Category is the kind of leak it is, such as a ticker never stopped
+	Category Category
+}
+
+func (l Leak) Error() string {
+	return fmt.Sprintf("leaktest: leaked goroutine: %s", l.Stack)
+}
+
+// LeaksError is returned by Checker.Verify when goroutines leaked.
+type LeaksError struct {
+	leaks []Leak
+	// err joins the individual leaks together
+	err error
+	// reason is why the check stopped waiting for them to exit, shown in
+	// the message but not wrapped, so that leaks aren't mistaken for it
+	reason error
+}
+
+func newLeaksError(leaked []*goroutine) *LeaksError {
+	e := &LeaksError{}
+	errs := make([]error, 0, len(leaked))
+	for _, g := range leaked {
+		l := Leak{ID: g.id, Stack: g.stack, Class: classify(g.createdBy, modulePath()), Fingerprint: g.fingerprint(), Category: categorize(g)}
+		if g.createdBy.function != "" {
+			l.CreatedBy = g.createdBy.String()
+			l.File, l.Line = g.createdBy.file, g.createdBy.line
+		}
+		e.leaks = append(e.leaks, l)
+		errs = append(errs, l)
+	}
+	e.err = errors.Join(errs...)
+	return e
+}
+
+// Leaks returns the leaked goroutines, in the order they're reported in.
+func (e *LeaksError) Leaks() []Leak {
+	return e.leaks
+}
+
+func (e *LeaksError) Error() string {
+	sites := make([]string, 0, len(e.leaks))
+	seen := map[string]bool{}
+	for _, l := range e.leaks {
+		if l.CreatedBy != "" && !seen[l.CreatedBy] {
+			seen[l.CreatedBy] = true
+			sites = append(sites, l.CreatedBy)
+		}
+	}
+	msg := fmt.Sprintf("leaktest: %d leaked goroutine(s)", len(e.leaks))
+	if len(sites) > 0 {
+		msg += ", created by " + strings.Join(sites, ", ")
+	}
+	if e.reason != nil {
+		msg += " (" + e.reason.Error() + ")"
+	}
+	return msg
+}
+
+// Unwrap returns the individual leaks joined together with errors.Join.
+func (e *LeaksError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target is ErrLeaks.
+func (e *LeaksError) Is(target error) bool {
+	return target == ErrLeaks
+}
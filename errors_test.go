@@ -0,0 +1,52 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	c := NewChecker(&testReporter{})
+	if err := c.Verify(context.Background()); err != nil {
+		t.Fatalf("Verify = %v; want nil", err)
+	}
+
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := c.Verify(ctx)
+
+	if !errors.Is(err, ErrLeaks) {
+		t.Fatalf("errors.Is(%v, ErrLeaks) = false", err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Error("leaks shouldn't be mistaken for a timeout")
+	}
+	var le *LeaksError
+	if !errors.As(err, &le) || len(le.Leaks()) != 1 {
+		t.Fatalf("want a *LeaksError with one leak, got %v", err)
+	}
+	var leak Leak
+	if !errors.As(err, &leak) {
+		t.Fatal("errors.As didn't find the individual leak")
+	}
+	if !strings.Contains(leak.CreatedBy, "TestVerify") {
+		t.Errorf("CreatedBy = %q; want it to mention TestVerify", leak.CreatedBy)
+	}
+	if !strings.HasSuffix(leak.File, "errors_test.go") || leak.Line == 0 {
+		t.Errorf("File, Line = %s:%d; want a line of errors_test.go", leak.File, leak.Line)
+	}
+	if !strings.Contains(err.Error(), "1 leaked goroutine(s), created by ") {
+		t.Errorf("unexpected message %q", err)
+	}
+	if !strings.Contains(err.Error(), "(context deadline exceeded, with 1 goroutine(s) remaining)") {
+		t.Errorf("message %q doesn't say why the check stopped waiting", err)
+	}
+}
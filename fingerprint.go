@@ -0,0 +1,48 @@
+package leaktest
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// fingerprint identifies goroutines that leaked from the same place for the
+// same reason. It's a hash of the function that started the goroutine and
+// the functions in its stack, leaving out everything that changes from run
+// to run or from one edit to the next, such as IDs, arguments and line
+// numbers.
+func (g *goroutine) fingerprint() string {
+	if g.fp == "" {
+		h := fnv.New64a()
+		fmt.Fprintln(h, g.createdBy.function)
+		for _, fn := range stackFunctions(g.stack) {
+			fmt.Fprintln(h, fn)
+		}
+		g.fp = fmt.Sprintf("%016x", h.Sum64())
+	}
+	return g.fp
+}
+
+// fingerprintCount is a fingerprint with the number of leaks sharing it.
+type fingerprintCount struct {
+	fp      string
+	creator frame
+	n       int
+}
+
+// countFingerprints counts the leaks sharing each fingerprint, in the order
+// the fingerprints are first seen.
+func countFingerprints(leaked []*goroutine) []fingerprintCount {
+	var counts []fingerprintCount
+	index := map[string]int{}
+	for _, g := range leaked {
+		fp := g.fingerprint()
+		i, ok := index[fp]
+		if !ok {
+			i = len(counts)
+			index[fp] = i
+			counts = append(counts, fingerprintCount{fp: fp, creator: g.createdBy})
+		}
+		counts[i].n++
+	}
+	return counts
+}
@@ -0,0 +1,107 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStackFunctions(t *testing.T) {
+	stack := "goroutine 8 [chan receive]:\n" +
+		"main.(*T).wait(0xc000010000)\n\t/tmp/main.go:12 +0x19\n" +
+		"...additional frames elided...\n" +
+		"main.f(...)\n\t/tmp/main.go:9\n" +
+		"created by main.main in goroutine 1\n\t/tmp/main.go:5 +0x1d"
+	want := []string{"main.(*T).wait", "main.f"}
+	if got := stackFunctions(stack); !reflect.DeepEqual(got, want) {
+		t.Errorf("stackFunctions = %q; want %q", got, want)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := &goroutine{
+		id:        8,
+		stack:     "goroutine 8 [chan receive]:\nmain.f(0x1)\n\t/tmp/main.go:9 +0x19\ncreated by main.main in goroutine 1\n\t/tmp/main.go:5 +0x1d",
+		createdBy: frame{function: "main.main", file: "/tmp/main.go", line: 5},
+	}
+	b := &goroutine{
+		id:        9,
+		stack:     "goroutine 9 [chan receive, 2 minutes]:\nmain.f(0x2)\n\t/tmp/main.go:10 +0x21\ncreated by main.main in goroutine 1\n\t/tmp/main.go:6 +0x1d",
+		createdBy: frame{function: "main.main", file: "/tmp/main.go", line: 6},
+	}
+	c := &goroutine{
+		id:        10,
+		stack:     "goroutine 10 [chan receive]:\nmain.g(0x1)\n\t/tmp/main.go:9 +0x19\ncreated by main.main in goroutine 1\n\t/tmp/main.go:5 +0x1d",
+		createdBy: frame{function: "main.main", file: "/tmp/main.go", line: 5},
+	}
+	if a.fingerprint() != b.fingerprint() {
+		t.Error("fingerprint changed with IDs, arguments or lines")
+	}
+	if a.fingerprint() == c.fingerprint() {
+		t.Error("different stacks have the same fingerprint")
+	}
+}
+
+func TestWithMaxReported(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond, WithMaxReported(2))
+	for i := 0; i < 5; i++ {
+		go func() { <-block }()
+	}
+	snapshot()
+
+	var full int
+	for _, msg := range checker.msgs {
+		if strings.HasPrefix(msg, "leaktest: leaked goroutine [test-code, fingerprint ") {
+			full++
+		}
+	}
+	if full != 2 {
+		t.Errorf("printed %d leaks in full; want 2", full)
+	}
+	if !strings.HasPrefix(checker.msg, "leaktest: and 3 more with the same fingerprints: 3 × ") {
+		t.Errorf("unexpected summary %q", checker.msg)
+	}
+}
+
+func TestWithQuarantined(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	leak := func() { <-block }
+
+	// find out the leak's fingerprint
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond)
+	go leak()
+	snapshot()
+	fp := fingerprintTag.FindString(checker.msgs[1])
+	if fp == "" {
+		t.Fatalf("no fingerprint in %q", checker.msgs[1])
+	}
+	fp = strings.TrimPrefix(fp, ", fingerprint ")
+
+	quarantined := &tbReporter{}
+	snapshot = CheckTimeout(quarantined, 100*time.Millisecond, WithQuarantined(fp))
+	go leak()
+	snapshot()
+	if quarantined.failed {
+		t.Errorf("quarantined leak failed the check: %q", quarantined.msgs)
+	}
+	if logs := quarantined.checkLogs(); len(logs) != 1 || !strings.Contains(logs[0], ", quarantined]") {
+		t.Errorf("quarantined leak wasn't logged: %q", logs)
+	}
+
+	plain := &testReporter{}
+	snapshot = CheckTimeout(plain, 100*time.Millisecond, WithQuarantined(fp))
+	go leak()
+	snapshot()
+	if plain.failed {
+		t.Errorf("quarantined leak failed a check without Logf: %q", plain.msgs)
+	}
+}
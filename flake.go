@@ -0,0 +1,118 @@
+package leaktest
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	talliesMu sync.Mutex
+	// tallies holds the leaks of each test across its -count runs, by test
+	// name, see WithFlakeThreshold
+	tallies = map[string]*leakTally{}
+)
+
+// leakTally counts the runs of a test and the leaks in them.
+type leakTally struct {
+	runs int
+	// leaks counts the runs each fingerprint leaked in
+	leaks map[string]int
+	// creators holds the creator of each fingerprint, to describe it
+	creators map[string]frame
+}
+
+// testCount returns the value of the -test.count flag, or 1 outside of
+// tests.
+func testCount() int {
+	if f := flag.Lookup("test.count"); f != nil {
+		if n, err := strconv.Atoi(f.Value.String()); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 1
+}
+
+// tally records the leaks of a run of the test in its tally, see
+// WithFlakeThreshold. It returns the leaks that fail the test, which are
+// none until the last run.
+func (c *Checker) tally(leaked []*goroutine) []*goroutine {
+	name := testName(c.t)
+	if name == "" {
+		return leaked
+	}
+	count := testCount()
+
+	talliesMu.Lock()
+	tl, ok := tallies[name]
+	if !ok {
+		tl = &leakTally{leaks: map[string]int{}, creators: map[string]frame{}}
+		tallies[name] = tl
+	}
+	tl.runs++
+	seen := map[string]bool{}
+	for _, g := range leaked {
+		fp := g.fingerprint()
+		if !seen[fp] {
+			seen[fp] = true
+			tl.leaks[fp]++
+			tl.creators[fp] = g.createdBy
+		}
+	}
+	runs := tl.runs
+	last := runs >= count
+	var counts map[string]int
+	var summary string
+	if last {
+		delete(tallies, name)
+		counts = tl.leaks
+		summary = tl.String()
+	}
+	talliesMu.Unlock()
+
+	if !last {
+		for _, g := range leaked {
+			warnf(c.t, "leaktest: leaked goroutine in run %d of %d, to be tallied after the last run%s: %v", runs, count, c.describe(g), c.cfg.format(g))
+		}
+		return nil
+	}
+	if summary != "" {
+		warnf(c.t, "leaktest: leaks over %d run(s) of %s:\n%s", runs, name, summary)
+	}
+	var failing []*goroutine
+	for _, g := range leaked {
+		if float64(counts[g.fingerprint()])/float64(runs) > c.cfg.flakeThreshold {
+			failing = append(failing, g)
+			continue
+		}
+		warnf(c.t, "leaktest: warning: leaked goroutine in %d of %d runs, within the threshold%s: %v", counts[g.fingerprint()], runs, c.describe(g), c.cfg.format(g))
+	}
+	return failing
+}
+
+// String describes the tally, one fingerprint per line, most frequent
+// first.
+func (tl *leakTally) String() string {
+	fps := make([]string, 0, len(tl.leaks))
+	for fp := range tl.leaks {
+		fps = append(fps, fp)
+	}
+	sort.Slice(fps, func(i, j int) bool {
+		if tl.leaks[fps[i]] != tl.leaks[fps[j]] {
+			return tl.leaks[fps[i]] > tl.leaks[fps[j]]
+		}
+		return fps[i] < fps[j]
+	})
+	lines := make([]string, 0, len(fps))
+	for _, fp := range fps {
+		line := fmt.Sprintf("%s: leaked in %d of %d run(s) (%.0f%%)", fp, tl.leaks[fp], tl.runs, 100*float64(tl.leaks[fp])/float64(tl.runs))
+		if fn := tl.creators[fp].function; fn != "" {
+			line += " created by " + fn
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
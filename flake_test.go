@@ -0,0 +1,88 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithFlakeThreshold(t *testing.T) {
+	f := flag.Lookup("test.count")
+	old := f.Value.String()
+	defer f.Value.Set(old)
+	f.Value.Set("4")
+
+	block := make(chan struct{})
+	defer close(block)
+	var last *tbReporter
+	for run := 0; run < 4; run++ {
+		checker := &tbReporter{name: "TestFlaky"}
+		snapshot := CheckTimeout(checker, 100*time.Millisecond, WithFlakeThreshold(0.5))
+		if run == 0 {
+			started := make(chan struct{})
+			go blockedGoroutine(started, block)
+			<-started
+		}
+		snapshot()
+		if checker.failed {
+			t.Fatalf("run %d failed: %q", run, checker.msgs)
+		}
+		last = checker
+	}
+	logs := strings.Join(last.logs, "\n")
+	if !strings.Contains(logs, "leaked in 1 of 4 run(s) (25%)") {
+		t.Errorf("unexpected tally %q", logs)
+	}
+}
+
+func TestWithFlakeThresholdFails(t *testing.T) {
+	// the tally spans the runs of a test, so a single one is the last
+	f := flag.Lookup("test.count")
+	old := f.Value.String()
+	defer f.Value.Set(old)
+	f.Value.Set("1")
+
+	block := make(chan struct{})
+	defer close(block)
+	checker := &tbReporter{name: "TestLeaky"}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond, WithFlakeThreshold(0.5))
+	go func() { <-block }()
+	snapshot()
+	if !checker.failed {
+		t.Error("leak in every run didn't fail the test")
+	}
+}
+
+// namedReporter is a testReporter with a Name but no Logf.
+type namedReporter struct {
+	testReporter
+	name string
+}
+
+func (r *namedReporter) Name() string { return r.name }
+
+func TestWithFlakeThresholdWithoutLogf(t *testing.T) {
+	f := flag.Lookup("test.count")
+	old := f.Value.String()
+	defer f.Value.Set(old)
+	f.Value.Set("4")
+
+	block := make(chan struct{})
+	defer close(block)
+	for run := 0; run < 4; run++ {
+		checker := &namedReporter{name: "TestFlakyWithoutLogf"}
+		snapshot := CheckTimeout(checker, 100*time.Millisecond, WithFlakeThreshold(0.5))
+		if run == 0 {
+			started := make(chan struct{})
+			go blockedGoroutine(started, block)
+			<-started
+		}
+		snapshot()
+		if checker.failed {
+			t.Fatalf("run %d failed below the threshold: %q", run, checker.msgs)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package leaktest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The functions in this file mirror the API of go.uber.org/goleak, with the
+// same semantics but implemented on leaktest's engine, so that migrating is
+// a matter of replacing the import path.
+
+// The defaults for MaxRetries and MaxSleep, which are goleak's.
+const (
+	defaultMaxRetries = 20
+	defaultMaxSleep   = 100 * time.Millisecond
+)
+
+// goleakTimeout is how long the goleak-style functions wait for goroutines
+// to exit. goleak retries with exponential backoff, starting at a
+// microsecond and capped at MaxSleep, so the wait is bounded by the sum of
+// those sleeps.
+func goleakTimeout(c *config) time.Duration {
+	retries, maxSleep := defaultMaxRetries, defaultMaxSleep
+	if c.maxRetries > 0 {
+		retries = c.maxRetries
+	}
+	if c.maxSleep > 0 {
+		maxSleep = c.maxSleep
+	}
+	var total time.Duration
+	sleep := time.Microsecond
+	for i := 0; i < retries; i++ {
+		if sleep > maxSleep {
+			sleep = maxSleep
+		}
+		total += sleep
+		sleep *= 2
+	}
+	return total
+}
+
+// MaxRetries sets how many times the goleak-style functions look for leaked
+// goroutines before giving up. The default is 20.
+func MaxRetries(n int) Option {
+	return func(c *config) {
+		c.maxRetries = n
+	}
+}
+
+// MaxSleep sets the longest the goleak-style functions wait between two
+// looks for leaked goroutines. The default is 100ms.
+func MaxSleep(d time.Duration) Option {
+	return func(c *config) {
+		c.maxSleep = d
+	}
+}
+
+// TestingM is the subset of *testing.M used by VerifyTestMain and CheckMain.
+type TestingM interface {
+	Run() int
+}
+
+// IgnoreTopFunction ignores goroutines whose innermost function is f, such
+// as "internal/poll.runtime_pollWait".
+func IgnoreTopFunction(f string) Option {
+	return LeakCheckConfiguration{IgnoreTopFunctions: []string{f}}.Option()
+}
+
+// IgnoreAnyFunction ignores goroutines with f anywhere in their stack.
+func IgnoreAnyFunction(f string) Option {
+	return LeakCheckConfiguration{IgnoreAnyFunctions: []string{f}}.Option()
+}
+
+// IgnoreCurrent ignores the goroutines running when IgnoreCurrent itself is
+// called, which for VerifyTestMain is before the tests are run. Without it,
+// VerifyNone, Find and VerifyTestMain consider every interesting goroutine
+// other than the calling one to be leaked.
+func IgnoreCurrent() Option {
+	ids := map[uint64]bool{}
+	gs, _ := interestingGoroutines()
+	for _, g := range gs {
+		ids[g.id] = true
+	}
+	return func(c *config) {
+		c.ignoreCurrent = ids
+	}
+}
+
+// Cleanup makes VerifyTestMain call f with the exit code instead of calling
+// os.Exit, leaving it to f to exit.
+func Cleanup(f func(exitCode int)) Option {
+	return func(c *config) {
+		c.cleanup = f
+	}
+}
+
+// newGoleakChecker returns a Checker whose baseline is the calling goroutine
+// and those captured by IgnoreCurrent. It's built directly rather than with
+// NewChecker, as there's no baseline snapshot to take, nor to warn about
+// the goroutines in it looking leaked, which are the ones reported here.
+func newGoleakChecker(t ErrorReporter, opts []Option) *Checker {
+	t = orStderr(t)
+	c := &Checker{
+		t:    t,
+		cfg:  newConfig(opts),
+		orig: map[uint64]bool{currentGoroutineID(): true},
+	}
+	noteTest(testName(t))
+	for id := range c.cfg.ignoreCurrent {
+		c.orig[id] = true
+	}
+	return c
+}
+
+// Find looks for leaked goroutines, retrying as set by MaxRetries and
+// MaxSleep, and returns a *LeaksError if any remain.
+func Find(opts ...Option) error {
+	c := newGoleakChecker(nil, opts)
+	timeout, stop := c.cfg.timer(goleakTimeout(c.cfg))
+	defer stop()
+	return c.verify(context.Background(), timeout)
+}
+
+// VerifyNone fails t if any goroutines other than the calling one are
+// leaked, retrying as set by MaxRetries and MaxSleep. It's meant to be
+// deferred at the start of a test.
+func VerifyNone(t ErrorReporter, opts ...Option) {
+	c := newGoleakChecker(t, opts)
+	if h, ok := c.t.(tHelper); ok {
+		h.Helper()
+	}
+	c.CheckTimeout(goleakTimeout(c.cfg))
+}
+
+// VerifyTestMain runs the tests with m.Run and, if they pass, checks for
+// leaked goroutines before exiting, failing the test binary if any remain.
+// It's meant to be called from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		leaktest.VerifyTestMain(m)
+//	}
+func VerifyTestMain(m TestingM, opts ...Option) {
+	exitCode := m.Run()
+	c := newGoleakChecker(nil, opts)
+	if exitCode == 0 {
+		timeout, stop := c.cfg.timer(goleakTimeout(c.cfg))
+		err := c.verify(context.Background(), timeout)
+		stop()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "leaktest: errors on successful test run: %v\n", err)
+			exitCode = 1
+		}
+	}
+	if c.cfg.cleanup != nil {
+		c.cfg.cleanup(exitCode)
+		return
+	}
+	os.Exit(exitCode)
+}
+
+// currentGoroutineID returns the ID of the calling goroutine.
+func currentGoroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// the header looks like "goroutine 7 [running]:"
+	fields := strings.Fields(string(buf))
+	if len(fields) < 2 {
+		return 0
+	}
+	id, _ := strconv.ParseUint(fields[1], 10, 64)
+	return id
+}
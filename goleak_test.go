@@ -0,0 +1,89 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifyNone(t *testing.T) {
+	// other tests leak goroutines on purpose, which VerifyNone would see
+	// when the tests run more than once or shuffled
+	others := IgnoreCurrent()
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+
+	checker := &testReporter{}
+	VerifyNone(checker)
+	if !checker.failed {
+		t.Error("VerifyNone didn't report a goroutine started before it was called")
+	}
+
+	checker = &testReporter{}
+	VerifyNone(checker, IgnoreCurrent())
+	if checker.failed {
+		t.Errorf("unexpected failure with IgnoreCurrent: %q", checker.msgs)
+	}
+
+	VerifyNone(t, others, IgnoreTopFunction("github.com/fortytw2/leaktest.TestVerifyNone.func1"))
+}
+
+func TestFind(t *testing.T) {
+	if err := Find(IgnoreCurrent()); err != nil {
+		t.Errorf("Find = %v; want nil", err)
+	}
+}
+
+type fakeM struct {
+	code int
+	run  func()
+}
+
+func (m fakeM) Run() int {
+	m.run()
+	return m.code
+}
+
+func TestVerifyTestMain(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	var got int
+	cleanup := Cleanup(func(code int) { got = code })
+	VerifyTestMain(fakeM{run: func() {}}, IgnoreCurrent(), cleanup)
+	if got != 0 {
+		t.Errorf("exit code = %d; want 0", got)
+	}
+
+	VerifyTestMain(fakeM{code: 2, run: func() {}}, IgnoreCurrent(), cleanup)
+	if got != 2 {
+		t.Errorf("exit code = %d; want 2", got)
+	}
+
+	VerifyTestMain(fakeM{run: func() {
+		go func() { <-block }()
+	}}, IgnoreCurrent(), cleanup)
+	if got != 1 {
+		t.Errorf("exit code = %d; want 1", got)
+	}
+}
+
+func TestCurrentGoroutineID(t *testing.T) {
+	ch := make(chan uint64)
+	go func() { ch <- currentGoroutineID() }()
+	if a, b := currentGoroutineID(), <-ch; a == 0 || b == 0 || a == b {
+		t.Errorf("goroutine IDs %d and %d; want distinct non-zero IDs", a, b)
+	}
+}
+
+func TestGoleakTimeout(t *testing.T) {
+	if got := goleakTimeout(newConfig(nil)); got < 300*time.Millisecond || got > time.Second {
+		t.Errorf("default timeout = %s; want about 430ms", got)
+	}
+	cfg := newConfig([]Option{MaxRetries(3), MaxSleep(time.Second)})
+	if got, want := goleakTimeout(cfg), 7*time.Microsecond; got != want {
+		t.Errorf("timeout = %s; want %s", got, want)
+	}
+}
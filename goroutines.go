@@ -0,0 +1,184 @@
+package leaktest
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Goroutine is a snapshot of a running goroutine, as returned by
+// Goroutines.
+type Goroutine struct {
+	// ID is the goroutine's ID
+	ID uint64
+	// State is what the goroutine was doing when the snapshot was taken
+	State State
+	// WaitDuration is roughly how long the goroutine had been waiting. The
+	// runtime only shows it in minutes once it's at least a minute, so it's
+	// 0 for shorter waits.
+	WaitDuration time.Duration
+	// LockedToThread is set for goroutines locked to their OS thread
+	LockedToThread bool
+	// CreatedBy is the go statement that started the goroutine, or the zero
+	// Frame for the main goroutine
+	CreatedBy Frame
+	// ParentID is the ID of the goroutine that started it, or 0 if unknown,
+	// as before Go 1.21
+	ParentID uint64
+	// Class says whether CreatedBy is in the module under test, its tests,
+	// a dependency or the standard library
+	Class Class
+	// Labels are the goroutine's pprof labels, when the runtime shows them
+	// in stack traces, see WithLabelScope
+	Labels map[string]string
+	// Stack is the goroutine's stack, including its header line
+	Stack string
+}
+
+// Frame is a location in a goroutine's stack.
+type Frame struct {
+	// Function is the fully qualified function name, such as
+	// "net/http.(*Server).Serve"
+	Function string
+	File     string
+	Line     int
+}
+
+func (f Frame) String() string {
+	if f.File == "" {
+		return f.Function
+	}
+	return f.Function + " (" + f.File + ":" + strconv.Itoa(f.Line) + ")"
+}
+
+// export returns g as a Goroutine.
+func (g *goroutine) export() Goroutine {
+	return Goroutine{
+		ID:             g.id,
+		State:          g.state,
+		WaitDuration:   g.waited,
+		LockedToThread: g.lockedToThread,
+		CreatedBy: Frame{
+			Function: g.createdBy.function,
+			File:     g.createdBy.file,
+			Line:     g.createdBy.line,
+		},
+		ParentID: g.parentID,
+		Class:    classify(g.createdBy, modulePath()),
+		Labels:   g.labels,
+		Stack:    g.stack,
+	}
+}
+
+// Goroutines returns the goroutines that a leak check would look at, in
+// order of their IDs: those that aren't part of the runtime or the testing
+// package, nor ignored by the options, such as IgnoreTopFunction or
+// DefaultCheckConfiguration. The calling goroutine isn't included. It's the
+// building block for custom assertions and inventories of the goroutines
+// running at a given point. Stacks that can't be parsed are skipped.
+func Goroutines(opts ...Option) []Goroutine {
+	filtered := filteredGoroutines(newConfig(opts))
+	gs := make([]Goroutine, 0, len(filtered))
+	for _, g := range filtered {
+		gs = append(gs, g.export())
+	}
+	return gs
+}
+
+// NumInteresting returns the number of goroutines Goroutines would return,
+// without the cost of building them. It suits quick inline assertions, such
+// as that a Start/Stop cycle is goroutine-neutral:
+//
+//	n := leaktest.NumInteresting()
+//	srv.Start()
+//	srv.Stop()
+//	if got := leaktest.NumInteresting(); got != n {
+//		t.Errorf("%d goroutines after Stop; want %d", got, n)
+//	}
+//
+// Unlike a check it doesn't wait, so goroutines still on their way out are
+// counted.
+func NumInteresting(opts ...Option) int {
+	return len(filteredGoroutines(newConfig(opts)))
+}
+
+// AssertRunning checks that at least one of the goroutines Goroutines would
+// return has pattern in its stack, such as "mypkg.(*Pool).worker", and
+// reports to t if none does. It's the inverse of a leak check, for making
+// sure that Start actually launched its workers before the test exercises
+// them. It reports whether a goroutine matched.
+func AssertRunning(t ErrorReporter, pattern string, opts ...Option) bool {
+	t = orStderr(t)
+	if disabled {
+		return true
+	}
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	gs := filteredGoroutines(newConfig(opts))
+	if anyMatch(gs, pattern) {
+		return true
+	}
+	t.Errorf("leaktest: no running goroutine matches %q, out of %d", pattern, len(gs))
+	return false
+}
+
+// WaitUntilRunning blocks until one of the goroutines Goroutines would
+// return has pattern in its stack, or until ctx is done, in which case it
+// returns ctx.Err(). It replaces the sleeps in tests that need a background
+// component to be up before sending it work:
+//
+//	go srv.Serve(l)
+//	if err := leaktest.WaitUntilRunning(ctx, "http.(*Server).Serve"); err != nil {
+//		t.Fatal(err)
+//	}
+//
+// It polls every TickerInterval, sharing the goroutine dumps with the
+// checks waiting at the same time.
+func WaitUntilRunning(ctx context.Context, pattern string, opts ...Option) error {
+	if disabled {
+		return nil
+	}
+	cfg := newConfig(opts)
+	if anyMatch(filteredGoroutines(cfg), pattern) {
+		return nil
+	}
+	snapshots, unsubscribe := sharedPoller.subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case snap := <-snapshots:
+			for _, g := range snap.all {
+				if !cfg.ignoreCurrent[g.id] && !cfg.ignored(g) && strings.Contains(g.stack, pattern) {
+					return nil
+				}
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// anyMatch reports whether any of gs has pattern in its stack.
+func anyMatch(gs []*goroutine, pattern string) bool {
+	for _, g := range gs {
+		if strings.Contains(g.stack, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// filteredGoroutines returns the interesting goroutines not ignored by cfg.
+func filteredGoroutines(cfg *config) []*goroutine {
+	all, _ := interestingGoroutines()
+	kept := all[:0]
+	for _, g := range all {
+		if cfg.ignoreCurrent[g.id] || cfg.ignored(g) {
+			continue
+		}
+		kept = append(kept, g)
+	}
+	return kept
+}
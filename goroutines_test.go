@@ -0,0 +1,127 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGoroutines(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+
+	find := func(opts ...Option) *Goroutine {
+		for _, g := range Goroutines(opts...) {
+			if strings.Contains(g.Stack, "leaktest.blockedGoroutine(") {
+				return &g
+			}
+		}
+		return nil
+	}
+	g := find()
+	if g == nil {
+		t.Fatal("blocked goroutine not returned")
+	}
+	if g.State != StateChanReceive {
+		t.Errorf("State = %s; want %s", g.State, StateChanReceive)
+	}
+	if g.CreatedBy.Function != "github.com/fortytw2/leaktest.TestGoroutines" || !strings.HasSuffix(g.CreatedBy.File, "goroutines_test.go") {
+		t.Errorf("CreatedBy = %s; want TestGoroutines in goroutines_test.go", g.CreatedBy)
+	}
+	if g.ParentID != currentGoroutineID() {
+		t.Errorf("ParentID = %d; want %d", g.ParentID, currentGoroutineID())
+	}
+	if g.Class != ClassTest {
+		t.Errorf("Class = %s; want %s", g.Class, ClassTest)
+	}
+	if g := find(IgnoreAnyFunction("github.com/fortytw2/leaktest.blockedGoroutine")); g != nil {
+		t.Errorf("ignored goroutine returned: %s", g.Stack)
+	}
+	for _, g := range Goroutines() {
+		if strings.Contains(g.Stack, "TestGoroutines(") {
+			t.Errorf("calling goroutine returned: %s", g.Stack)
+		}
+	}
+}
+
+func TestNumInteresting(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+
+	// goroutines of earlier tests may still be exiting, so retry until two
+	// counts in a row agree
+	var with, without int
+	for i := 0; i < 20; i++ {
+		with = NumInteresting()
+		without = NumInteresting(IgnoreAnyFunction("github.com/fortytw2/leaktest.blockedGoroutine"))
+		if without == with-1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("NumInteresting = %d ignoring the blocked goroutine; want %d", without, with-1)
+}
+
+func BenchmarkInterestingGoroutines(b *testing.B) {
+	block := make(chan struct{})
+	defer close(block)
+	for i := 0; i < 1000; i++ {
+		go func() { <-block }()
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := interestingGoroutines(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestAssertRunning(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+
+	checker := &testReporter{}
+	if !AssertRunning(checker, "leaktest.blockedGoroutine") || checker.failed {
+		t.Errorf("running goroutine not found: %q", checker.msgs)
+	}
+	if AssertRunning(checker, "leaktest.blockedGoroutine", IgnoreTopFunction("github.com/fortytw2/leaktest.blockedGoroutine")) {
+		t.Error("ignored goroutine found")
+	}
+	if AssertRunning(checker, "leaktest.noSuchWorker") || len(checker.msgs) != 2 ||
+		!strings.Contains(checker.msgs[1], `no running goroutine matches "leaktest.noSuchWorker"`) {
+		t.Errorf("missing goroutine not reported: %q", checker.msgs)
+	}
+}
+
+func TestWaitUntilRunning(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	go func() {
+		time.Sleep(2 * TickerInterval)
+		blockedGoroutine(make(chan struct{}), block)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := WaitUntilRunning(ctx, "leaktest.blockedGoroutine"); err != nil {
+		t.Errorf("WaitUntilRunning = %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 2*TickerInterval)
+	defer cancel()
+	if err := WaitUntilRunning(ctx, "leaktest.noSuchWorker"); err != context.DeadlineExceeded {
+		t.Errorf("WaitUntilRunning = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,79 @@
+package leaktest
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Guard watches the number of goroutines while the test runs, and fails t
+// as soon as more than max interesting goroutines are running, rather than
+// at the end of the test. This stops a runaway goroutine explosion before
+// it gets the whole test binary killed for running out of memory, with no
+// check having had a chance to say why:
+//
+//	defer leaktest.Guard(t, 10000)()
+//
+// Once over the cap, Guard reports the most common kinds of goroutines
+// running and panics, as the test can't be stopped from another goroutine.
+// WithAbort replaces the panic. Ignore options apply to the count.
+func Guard(t ErrorReporter, max int, opts ...Option) func() {
+	t = orStderr(t)
+	if disabled {
+		return func() {}
+	}
+	cfg := newConfig(opts)
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(pollInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			// counting them all is cheap, and an upper bound of the
+			// interesting ones, which need a dump
+			if runtime.NumGoroutine() <= max {
+				continue
+			}
+			gs := filteredGoroutines(cfg)
+			if len(gs) <= max {
+				continue
+			}
+			msg := fmt.Sprintf("leaktest: %d goroutines running, over the cap of %d set by Guard; the most common are:%s", len(gs), max, mostCommon(gs, 5))
+			t.Errorf("%s", msg)
+			if cfg.abort != nil {
+				cfg.abort(msg)
+				return
+			}
+			panic(msg)
+		}
+	}()
+	return onCleanup(t, func() {
+		close(stop)
+		<-done
+	})
+}
+
+// mostCommon describes the n fingerprints shared by the most goroutines in
+// gs, one per line.
+func mostCommon(gs []*goroutine, n int) string {
+	counts := countFingerprints(gs)
+	sort.SliceStable(counts, func(i, j int) bool { return counts[i].n > counts[j].n })
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	var b strings.Builder
+	for _, fc := range counts {
+		fmt.Fprintf(&b, "\n\t%d × %s", fc.n, fc.fp)
+		if fc.creator.function != "" {
+			b.WriteString(" created by " + fc.creator.function)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,56 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGuard(t *testing.T) {
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	// let the goroutines exit before the next test takes its baseline
+	defer wg.Wait()
+	defer close(block)
+	spawn := func(started chan struct{}) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blockedGoroutine(started, block)
+		}()
+	}
+
+	checker := &testReporter{}
+	aborted := make(chan string, 1)
+	stop := Guard(checker, NumInteresting()+50, WithAbort(func(msg string) { aborted <- msg }))
+	defer stop()
+	for i := 0; i < 10; i++ {
+		started := make(chan struct{})
+		spawn(started)
+		<-started
+	}
+	select {
+	case msg := <-aborted:
+		t.Fatalf("aborted under the cap: %s", msg)
+	case <-time.After(5 * TickerInterval):
+	}
+	for i := 0; i < 100; i++ {
+		started := make(chan struct{})
+		spawn(started)
+		<-started
+	}
+	select {
+	case msg := <-aborted:
+		if !strings.Contains(msg, "over the cap") || !strings.Contains(msg, "110 × ") {
+			t.Errorf("unexpected message %q", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not aborted over the cap")
+	}
+	if !checker.failed {
+		t.Error("guard didn't fail the test")
+	}
+}
@@ -0,0 +1,120 @@
+package leaktest
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CheckHandles notes the number of operating system handles the process has
+// open, and returns a func that reports if there are more at the end of the
+// test, waiting up to 5 seconds for them to be closed. Handles include files,
+// sockets, pipes and, on Windows, events and the like, so this catches
+// resources that leak without leaving a goroutine behind:
+//
+//	defer leaktest.CheckHandles(t)()
+//
+// It's supported on Windows, where it uses GetProcessHandleCount, and on
+// Linux, where it lists /proc/self/fd and reports what each new descriptor
+// refers to, such as a file path, a socket or a pipe. Elsewhere it logs that
+// it isn't supported, and checks nothing. Handles opened by tests running in
+// parallel are reported too. To have leaked goroutines blocked on I/O
+// reported along with the handles opened since, use WithHandles.
+func CheckHandles(t ErrorReporter) func() {
+	if disabled {
+		return func() {}
+	}
+	t = orStderr(t)
+	before, err := openHandles()
+	if err != nil {
+		warnf(t, "leaktest: can't count handles on %s: %s", runtime.GOOS, err)
+		return func() {}
+	}
+	return onCleanup(t, func() {
+		if h, ok := t.(tHelper); ok {
+			h.Helper()
+		}
+		timer := time.NewTimer(defaultTimeout())
+		defer timer.Stop()
+		for {
+			after, err := openHandles()
+			if err != nil {
+				t.Errorf("leaktest: can't count handles: %s", err)
+				return
+			}
+			if after.count <= before.count {
+				return
+			}
+			select {
+			case <-time.After(pollInterval()):
+				continue
+			case <-timer.C:
+			}
+			t.Errorf("leaktest: %d handle(s) leaked: %d open before the test, %d after%s", after.count-before.count, before.count, after.count, after.since(before))
+			return
+		}
+	})
+}
+
+// waitsOnIO reports whether g is waiting on I/O or in a syscall, which when
+// it's leaked usually means a file descriptor or socket was left open.
+func waitsOnIO(g *goroutine) bool {
+	return g.state == StateIOWait || g.state == StateSyscall
+}
+
+// handlesSince reports the handles opened since the baseline if the config
+// asks for it and some of leaked wait on I/O, see WithHandles, or returns
+// "".
+func (c *Checker) handlesSince(leaked []*goroutine) string {
+	if !c.cfg.handles {
+		return ""
+	}
+	n := 0
+	for _, g := range leaked {
+		if waitsOnIO(g) {
+			n++
+		}
+	}
+	if n == 0 {
+		return ""
+	}
+	if c.baseHandlesErr != nil {
+		return fmt.Sprintf("leaktest: can't list the handles open at the baseline: %s", c.baseHandlesErr)
+	}
+	after, err := openHandles()
+	if err != nil {
+		return fmt.Sprintf("leaktest: can't list handles: %s", err)
+	}
+	opened := after.since(c.baseHandles)
+	if opened == "" {
+		return fmt.Sprintf("leaktest: %d leaked goroutine(s) wait on I/O, but no handles were opened since the baseline: %d open before, %d now", n, c.baseHandles.count, after.count)
+	}
+	return fmt.Sprintf("leaktest: %d leaked goroutine(s) wait on I/O, handles opened since the baseline:%s", n, opened)
+}
+
+// handleSet is the handles open at some point: how many there are and,
+// where the platform can list them, what each descriptor refers to.
+type handleSet struct {
+	count   int
+	targets map[uintptr]string
+}
+
+// since lists the descriptors in s that weren't in before, or that now
+// refer to something else, one per line, or returns "" if there are none or
+// they can't be listed.
+func (s handleSet) since(before handleSet) string {
+	var fds []uintptr
+	for fd, target := range s.targets {
+		if prev, ok := before.targets[fd]; !ok || prev != target {
+			fds = append(fds, fd)
+		}
+	}
+	sort.Slice(fds, func(i, j int) bool { return fds[i] < fds[j] })
+	var b strings.Builder
+	for _, fd := range fds {
+		fmt.Fprintf(&b, "\n\tfd %d: %s", fd, s.targets[fd])
+	}
+	return b.String()
+}
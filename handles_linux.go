@@ -0,0 +1,36 @@
+package leaktest
+
+import (
+	"os"
+	"strconv"
+)
+
+// openHandles lists the file descriptors the process has open, along with
+// what they refer to, such as "/var/log/app.log", "socket:[12345]" or
+// "pipe:[6789]".
+func openHandles() (handleSet, error) {
+	dir, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return handleSet{}, err
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return handleSet{}, err
+	}
+	s := handleSet{targets: map[uintptr]string{}}
+	for _, name := range names {
+		fd, err := strconv.ParseUint(name, 10, 64)
+		if err != nil || uintptr(fd) == dir.Fd() {
+			continue
+		}
+		// the descriptor may have been closed since the directory was read
+		target, err := os.Readlink("/proc/self/fd/" + name)
+		if err != nil {
+			continue
+		}
+		s.targets[uintptr(fd)] = target
+	}
+	s.count = len(s.targets)
+	return s, nil
+}
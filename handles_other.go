@@ -0,0 +1,14 @@
+//go:build !windows && !linux
+
+package leaktest
+
+import "errors"
+
+// errUnsupported is returned by openHandles on platforms it can't list the
+// open handles of. errors.ErrUnsupported would need Go 1.21.
+var errUnsupported = errors.New("not supported on this platform")
+
+// openHandles isn't supported on this platform.
+func openHandles() (handleSet, error) {
+	return handleSet{}, errUnsupported
+}
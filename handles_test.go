@@ -0,0 +1,60 @@
+//go:build (windows || linux) && !leaktest_off
+
+package leaktest
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckHandles(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "leaked.log")
+	checker := &testReporter{}
+	check := CheckHandles(checker)
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	check()
+
+	msgs := strings.Join(checker.msgs, "\n")
+	if !checker.failed || !strings.Contains(msgs, "handle(s) leaked") {
+		t.Fatalf("open file not reported: %q", checker.msgs)
+	}
+	if runtime.GOOS == "linux" && !strings.Contains(msgs, ": "+name) {
+		t.Errorf("open file's path not reported: %q", checker.msgs)
+	}
+}
+
+func TestWithHandles(t *testing.T) {
+	checker := &testReporter{}
+	check := CheckTimeout(checker, 100*time.Millisecond, WithHandles())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	defer func() {
+		l.Close()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		l.Accept()
+	}()
+	check()
+
+	msgs := strings.Join(checker.msgs, "\n")
+	if !strings.Contains(msgs, "likely an unclosed fd or socket") || !strings.Contains(msgs, "1 leaked goroutine(s) wait on I/O") {
+		t.Fatalf("goroutine waiting on I/O not reported as such: %q", checker.msgs)
+	}
+	if runtime.GOOS == "linux" && !strings.Contains(msgs, "socket:[") {
+		t.Errorf("listener's socket not reported: %q", checker.msgs)
+	}
+}
@@ -0,0 +1,22 @@
+package leaktest
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetProcessHandleCount = syscall.NewLazyDLL("kernel32.dll").NewProc("GetProcessHandleCount")
+
+// openHandles returns the number of handles the process has open. They
+// can't be listed.
+func openHandles() (handleSet, error) {
+	p, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return handleSet{}, err
+	}
+	var count uint32
+	if r, _, err := procGetProcessHandleCount.Call(uintptr(p), uintptr(unsafe.Pointer(&count))); r == 0 {
+		return handleSet{}, err
+	}
+	return handleSet{count: int(count)}, nil
+}
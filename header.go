@@ -0,0 +1,190 @@
+package leaktest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// State is the state of a goroutine, as shown in the header of its stack
+// trace. Most states are reasons a goroutine is waiting.
+type State int
+
+const (
+	// StateUnknown is for states leaktest doesn't know about
+	StateUnknown State = iota
+	StateRunning
+	StateRunnable
+	StateSyscall
+	// StateChanReceive and StateChanSend include operations on nil
+	// channels, which block forever
+	StateChanReceive
+	StateChanSend
+	StateSelect
+	StateSleep
+	StateIOWait
+	StateSemacquire
+	// StateMutexLock is for sync.Mutex.Lock and sync.RWMutex's Lock and
+	// RLock
+	StateMutexLock
+	StateCondWait
+	StateWaitGroupWait
+	// StateWaiting is for the other reasons the runtime gives for waiting,
+	// such as "GC assist wait" or "finalizer wait"
+	StateWaiting
+)
+
+var stateNames = [...]string{
+	StateUnknown:       "unknown",
+	StateRunning:       "running",
+	StateRunnable:      "runnable",
+	StateSyscall:       "syscall",
+	StateChanReceive:   "chan receive",
+	StateChanSend:      "chan send",
+	StateSelect:        "select",
+	StateSleep:         "sleep",
+	StateIOWait:        "IO wait",
+	StateSemacquire:    "semacquire",
+	StateMutexLock:     "mutex lock",
+	StateCondWait:      "sync.Cond.Wait",
+	StateWaitGroupWait: "sync.WaitGroup.Wait",
+	StateWaiting:       "waiting",
+}
+
+// DefaultLeakStates returns the states a goroutine may be in to be
+// reported as leaked unless WithLeakStates says otherwise: all of them.
+func DefaultLeakStates() []State {
+	states := make([]State, len(stateNames))
+	for i := range states {
+		states[i] = State(i)
+	}
+	return states
+}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+// blocked reports whether a goroutine in state s is waiting for another
+// goroutine, rather than running, on I/O, a syscall or a timer.
+func (s State) blocked() bool {
+	switch s {
+	case StateChanReceive, StateChanSend, StateSelect, StateSemacquire,
+		StateMutexLock, StateCondWait, StateWaitGroupWait:
+		return true
+	}
+	return false
+}
+
+// parseState returns the State for a status as printed by the runtime,
+// without the annotations in parentheses.
+func parseState(status string) State {
+	switch status {
+	case "running":
+		return StateRunning
+	case "runnable":
+		return StateRunnable
+	case "syscall":
+		return StateSyscall
+	case "chan receive":
+		return StateChanReceive
+	case "chan send":
+		return StateChanSend
+	case "select":
+		return StateSelect
+	case "sleep":
+		return StateSleep
+	case "IO wait":
+		return StateIOWait
+	case "semacquire":
+		return StateSemacquire
+	case "sync.Mutex.Lock", "sync.RWMutex.Lock", "sync.RWMutex.RLock":
+		return StateMutexLock
+	case "sync.Cond.Wait":
+		return StateCondWait
+	case "sync.WaitGroup.Wait":
+		return StateWaitGroupWait
+	case "", "???":
+		return StateUnknown
+	}
+	return StateWaiting
+}
+
+// header is the parsed header line of a goroutine's stack trace.
+type header struct {
+	id uint64
+	// status is the state as printed, such as "chan receive (nil chan)"
+	status string
+	state  State
+	// nilChan is set for channel operations on a nil channel
+	nilChan bool
+	// waited is how long the goroutine has been waiting, which the runtime
+	// only shows once it's at least a minute
+	waited         time.Duration
+	lockedToThread bool
+	labels         map[string]string
+}
+
+// parseHeader parses the header line of a goroutine's stack trace. Its
+// grammar, as printed by the runtime, is
+//
+//	goroutine ID [gp=G m=M mp=MP] "[" STATUS [" (" NOTE ")"]... [", " ATTR]... "]" [" {" LABELS "}"] ":"
+//
+// where the gp, m and mp fields only appear with GOTRACEBACK=system or
+// higher, the notes are annotations such as "nil chan", "scan", "leaked" or
+// "durable", and the attributes are "N minutes", "locked to thread" or
+// "synctest bubble N". Notes and attributes leaktest doesn't know about are
+// ignored.
+func parseHeader(line string) (header, error) {
+	var h header
+	rest, ok := strings.CutPrefix(line, "goroutine ")
+	if !ok {
+		return h, fmt.Errorf("error parsing stack header: %q", line)
+	}
+	id, rest, ok := strings.Cut(rest, " ")
+	if !ok {
+		return h, fmt.Errorf("error parsing stack header: %q", line)
+	}
+	var err error
+	if h.id, err = strconv.ParseUint(id, 10, 64); err != nil {
+		return h, fmt.Errorf("error parsing goroutine id: %s", err)
+	}
+	start := strings.IndexByte(rest, '[')
+	end := strings.IndexByte(rest, ']')
+	if start < 0 || end < start {
+		return h, fmt.Errorf("error parsing stack header: %q", line)
+	}
+	parts := strings.Split(rest[start+1:end], ", ")
+
+	status := parts[0]
+	h.status = status
+	// strip the notes in parentheses, which come after the status
+	for strings.HasSuffix(status, ")") {
+		open := strings.LastIndex(status, " (")
+		if open < 0 {
+			break
+		}
+		if status[open+2:len(status)-1] == "nil chan" {
+			h.nilChan = true
+		}
+		status = status[:open]
+	}
+	h.state = parseState(status)
+
+	for _, attr := range parts[1:] {
+		switch {
+		case attr == "locked to thread":
+			h.lockedToThread = true
+		case strings.HasSuffix(attr, " minutes"):
+			if n, err := strconv.Atoi(strings.TrimSuffix(attr, " minutes")); err == nil {
+				h.waited = time.Duration(n) * time.Minute
+			}
+		}
+	}
+	h.labels = parseLabels(line)
+	return h, nil
+}
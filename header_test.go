@@ -0,0 +1,51 @@
+package leaktest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHeader(t *testing.T) {
+	cases := []struct {
+		line string
+		want header
+	}{
+		{"goroutine 7 [running]:", header{id: 7, status: "running", state: StateRunning}},
+		{"goroutine 7 [chan receive (nil chan)]:", header{id: 7, status: "chan receive (nil chan)", state: StateChanReceive, nilChan: true}},
+		{"goroutine 7 [sync.Mutex.Lock, 2 minutes]:", header{id: 7, status: "sync.Mutex.Lock", state: StateMutexLock, waited: 2 * time.Minute}},
+		{"goroutine 7 [GC assist wait]:", header{id: 7, status: "GC assist wait", state: StateWaiting}},
+		{"goroutine 7 [select (no cases), 3 minutes, locked to thread]:", header{id: 7, status: "select (no cases)", state: StateSelect, waited: 3 * time.Minute, lockedToThread: true}},
+		{"goroutine 7 gp=0xc000007340 m=nil [chan send (scan)]:", header{id: 7, status: "chan send (scan)", state: StateChanSend}},
+		{"goroutine 7 [chan receive (durable), synctest bubble 1]:", header{id: 7, status: "chan receive (durable)", state: StateChanReceive}},
+		{"goroutine 7 [some future state, a new attribute]:", header{id: 7, status: "some future state", state: StateWaiting}},
+	}
+	for _, c := range cases {
+		got, err := parseHeader(c.line)
+		if err != nil {
+			t.Errorf("parseHeader(%q): %s", c.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseHeader(%q) = %+v; want %+v", c.line, got, c.want)
+		}
+	}
+}
+
+func TestParseHeaderLabels(t *testing.T) {
+	h, err := parseHeader(`goroutine 7 [select] {a: 1}:`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.state != StateSelect || h.labels["a"] != "1" {
+		t.Errorf("parseHeader = %+v; want a select with label a=1", h)
+	}
+}
+
+func TestParseHeaderErrors(t *testing.T) {
+	for _, line := range []string{"", "goroutine", "goroutine x [running]:", "goroutine 7 running:"} {
+		if _, err := parseHeader(line); err == nil {
+			t.Errorf("parseHeader(%q) succeeded", line)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package leaktest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/pprof"
+)
+
+// heapProfile returns a heap profile, after a garbage collection so that
+// it's up to date.
+func heapProfile() ([]byte, error) {
+	runtime.GC()
+	var buf bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeHeapProfiles writes the heap profile taken with the baseline and a
+// new one to files if the config asks for it, see WithHeapProfiles, and
+// returns a message saying where the files ended up, or "".
+func (c *Checker) writeHeapProfiles() string {
+	if !c.cfg.heapProfiles {
+		return ""
+	}
+	if c.baseHeapErr != nil {
+		return fmt.Sprintf("leaktest: error taking the baseline heap profile: %s", c.baseHeapErr)
+	}
+	leaked, err := heapProfile()
+	if err != nil {
+		return fmt.Sprintf("leaktest: error taking the heap profile: %s", err)
+	}
+	dir := artifactDir(c.t, c.cfg)
+	prefix := "leaktest-"
+	if name := testName(c.t); name != "" {
+		prefix += sanitizeFileName(name) + "-"
+	}
+	var paths [2]string
+	for i, profile := range [][]byte{c.baseHeap, leaked} {
+		kind := [...]string{"heap-baseline", "heap"}[i]
+		paths[i], err = writeArtifact(dir, prefix+kind+"-*.pb.gz", func(w io.Writer) error {
+			_, err := w.Write(profile)
+			return err
+		})
+		if err != nil {
+			return fmt.Sprintf("leaktest: error writing heap profile: %s", err)
+		}
+	}
+	return fmt.Sprintf("leaktest: heap profiles written to %s and %s, compare them with: go tool pprof -sample_index=inuse_space -diff_base %s %s",
+		paths[0], paths[1], paths[0], paths[1])
+}
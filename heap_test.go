@@ -0,0 +1,29 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithHeapProfiles(t *testing.T) {
+	dir := t.TempDir()
+	checker := &tbReporter{name: "TestHeap"}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond, WithDumpDir(dir), WithHeapProfiles())
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+	snapshot()
+
+	for _, pattern := range []string{"leaktest-TestHeap-heap-baseline-*.pb.gz", "leaktest-TestHeap-heap-[0-9]*.pb.gz"} {
+		if files, _ := filepath.Glob(filepath.Join(dir, pattern)); len(files) != 1 {
+			t.Errorf("got files %q for %s; want one", files, pattern)
+		}
+	}
+	if msg := strings.Join(checker.msgs, "\n"); !strings.Contains(msg, "go tool pprof -sample_index=inuse_space -diff_base") {
+		t.Errorf("no pprof command in %q", msg)
+	}
+}
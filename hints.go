@@ -0,0 +1,199 @@
+package leaktest
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// Category is the kind of leak a leaked goroutine is, as far as can be told
+// from its stack, so that leaks can be bucketed across tests and projects.
+type Category int
+
+const (
+	// CategoryUnknown is for leaks of no recognized kind
+	CategoryUnknown Category = iota
+	// CategoryTicker is for loops reading from a ticker never stopped
+	CategoryTicker
+	// CategoryHTTPBody is for HTTP responses never done with, usually as
+	// their body isn't closed
+	CategoryHTTPBody
+	// CategoryContext is for contexts never canceled
+	CategoryContext
+	// CategoryChannelDeadlock is for goroutines blocked on channels no one
+	// else uses
+	CategoryChannelDeadlock
+	// CategoryMutexDeadlock is for goroutines blocked on a sync.Mutex,
+	// RWMutex, Cond or WaitGroup no one releases
+	CategoryMutexDeadlock
+)
+
+func (c Category) String() string {
+	switch c {
+	case CategoryTicker:
+		return "ticker"
+	case CategoryHTTPBody:
+		return "http-body"
+	case CategoryContext:
+		return "context"
+	case CategoryChannelDeadlock:
+		return "channel-deadlock"
+	case CategoryMutexDeadlock:
+		return "mutex-deadlock"
+	}
+	return "unknown"
+}
+
+// signature is a well-known way for goroutines to leak, recognized from
+// their stacks.
+type signature struct {
+	// match reports whether g, with the functions fns in its stack,
+	// innermost first, leaked this way
+	match func(g *goroutine, fns []string) bool
+	// category is the category of the leaks, see Leak
+	category Category
+	// hint names the likely fix
+	hint string
+}
+
+// signatures are the leaks hint recognizes, most specific first.
+var signatures = []signature{
+	// the connection's own readLoop and writeLoop goroutines are ignored
+	// as keep-alives unless WithCloseIdleConnections is used, but
+	// goroutines waiting on the connection, or reading a response body
+	// from it, are not
+	{
+		match: func(g *goroutine, fns []string) bool {
+			return anyPrefix(fns, "net/http.(*persistConn).", "net/http.(*bodyEOFSignal).")
+		},
+		category: CategoryHTTPBody,
+		hint:     "an HTTP response is never done with: defer resp.Body.Close() once the request succeeds, and give the client or the request's context a timeout",
+	},
+	{
+		match: func(g *goroutine, fns []string) bool {
+			return anyPrefix(fns, "context.(*cancelCtx).propagateCancel.func", "context.propagateCancel.func")
+		},
+		category: CategoryContext,
+		hint:     "a context from context.WithCancel, WithTimeout or WithDeadline is never canceled: defer the cancel func they return",
+	},
+	{
+		match: func(g *goroutine, fns []string) bool {
+			return anyPrefix(fns, "database/sql.(*DB).connectionOpener")
+		},
+		category: CategoryUnknown,
+		hint:     "a sql.DB is never closed: call its Close method once done with it",
+	},
+	{
+		match: func(g *goroutine, fns []string) bool {
+			if g.state != StateChanReceive && g.state != StateSelect {
+				return false
+			}
+			return strings.Contains(sourceLine(innermostFrame(g)), "time.Tick(")
+		},
+		category: CategoryTicker,
+		hint:     "the ticker of time.Tick can't be stopped, so the loop receiving from it never ends: use time.NewTicker, with a way to end the loop that stops the ticker",
+	},
+	{
+		match: func(g *goroutine, fns []string) bool {
+			return g.state == StateWaitGroupWait
+		},
+		category: CategoryMutexDeadlock,
+		hint:     "a sync.WaitGroup is waited on, but Done isn't called for every Add: defer wg.Done() first thing in each goroutine counted, and check for early returns before Add's goroutines start",
+	},
+}
+
+// recognize returns the signature g leaked with, or nil if there's none.
+func recognize(g *goroutine) *signature {
+	fns := stackFunctions(g.stack)
+	for i := range signatures {
+		if signatures[i].match(g, fns) {
+			return &signatures[i]
+		}
+	}
+	return nil
+}
+
+// hint returns a line naming the likely fix for g if it leaked in a
+// well-known way, or "".
+func hint(g *goroutine) string {
+	if s := recognize(g); s != nil {
+		return "\nhint: " + s.hint
+	}
+	return ""
+}
+
+// categorize returns the category of the leaked goroutine g: that of the
+// signature it leaked with or, failing that, what it's blocked on.
+func categorize(g *goroutine) Category {
+	if s := recognize(g); s != nil {
+		return s.category
+	}
+	switch g.state {
+	case StateChanReceive, StateChanSend, StateSelect:
+		return CategoryChannelDeadlock
+	case StateMutexLock, StateCondWait, StateWaitGroupWait, StateSemacquire:
+		return CategoryMutexDeadlock
+	}
+	return CategoryUnknown
+}
+
+// anyPrefix reports whether one of fns starts with one of prefixes.
+func anyPrefix(fns []string, prefixes ...string) bool {
+	for _, fn := range fns {
+		for _, p := range prefixes {
+			if strings.HasPrefix(fn, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// innermostFrame returns the innermost frame of g's stack outside of the
+// runtime, which is where it's blocked, or the zero frame.
+func innermostFrame(g *goroutine) frame {
+	lines := strings.Split(g.stack, "\n")
+	for i := 1; i+1 < len(lines); i++ {
+		fn := lines[i]
+		if fn == "" || strings.HasPrefix(fn, "\t") || strings.HasPrefix(fn, "created by ") {
+			continue
+		}
+		if p := strings.LastIndex(fn, "("); p > 0 {
+			fn = fn[:p]
+		}
+		if strings.HasPrefix(fn, "runtime.") || strings.HasPrefix(fn, "internal/") {
+			continue
+		}
+		file, line := parseFileLine(lines[i+1])
+		return frame{function: fn, file: file, line: line}
+	}
+	return frame{}
+}
+
+var (
+	sourceMu sync.Mutex
+	// sourceFiles caches the lines of the source files read by sourceLine,
+	// nil for those that can't be read
+	sourceFiles = map[string][]string{}
+)
+
+// sourceLine returns the line of source code at f, or "" if it can't be
+// read, as when the test binary runs away from its sources.
+func sourceLine(f frame) string {
+	if f.file == "" || f.line <= 0 {
+		return ""
+	}
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+	lines, ok := sourceFiles[f.file]
+	if !ok {
+		if b, err := os.ReadFile(f.file); err == nil {
+			lines = strings.Split(string(b), "\n")
+		}
+		sourceFiles[f.file] = lines
+	}
+	if f.line > len(lines) {
+		return ""
+	}
+	return lines[f.line-1]
+}
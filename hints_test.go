@@ -0,0 +1,62 @@
+package leaktest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHint(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "poll.go")
+	if err := os.WriteFile(src, []byte("package poll\n\nfunc poll() {\n\tfor range time.Tick(time.Second) {\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name, stack, want string
+		category          Category
+	}{
+		{
+			"response body",
+			"goroutine 7 [select]:\nnet/http.(*persistConn).roundTrip(0xc000123456, 0xc000234567)\n\t/usr/local/go/src/net/http/transport.go:2781 +0x9e5\nexample.com/poll.fetch()\n\t/src/poll.go:10 +0x1d",
+			"defer resp.Body.Close()",
+			CategoryHTTPBody,
+		},
+		{
+			"context",
+			"goroutine 7 [select]:\ncontext.(*cancelCtx).propagateCancel.func2()\n\t/usr/local/go/src/context/context.go:524 +0x7c",
+			"is never canceled",
+			CategoryContext,
+		},
+		{
+			"time.Tick",
+			"goroutine 7 [chan receive]:\nexample.com/poll.poll()\n\t" + src + ":4 +0x2f",
+			"the ticker of time.Tick can't be stopped",
+			CategoryTicker,
+		},
+		{
+			"WaitGroup",
+			"goroutine 7 [sync.WaitGroup.Wait]:\nsync.runtime_SemacquireWaitGroup(0xc000012345)\n\t/usr/local/go/src/runtime/sema.go:114 +0x2e\nsync.(*WaitGroup).Wait(0xc000012340)\n\t/usr/local/go/src/sync/waitgroup.go:118 +0x48\nexample.com/poll.wait()\n\t/src/poll.go:10 +0x1d",
+			"Done isn't called for every Add",
+			CategoryMutexDeadlock,
+		},
+		{
+			"unknown",
+			"goroutine 7 [chan receive]:\nexample.com/poll.wait()\n\t/src/poll.go:10 +0x1d",
+			"",
+			CategoryChannelDeadlock,
+		},
+	} {
+		g, err := interestingRecord([]byte(tt.stack + "\ncreated by example.com/poll.start in goroutine 1\n\t/src/poll.go:5 +0x1a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := hint(g)
+		if (tt.want == "") != (got == "") || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: hint = %q; want it to contain %q", tt.name, got, tt.want)
+		}
+		if got := categorize(g); got != tt.category {
+			t.Errorf("%s: categorize = %s; want %s", tt.name, got, tt.category)
+		}
+	}
+}
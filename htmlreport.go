@@ -0,0 +1,216 @@
+package leaktest
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WriteHTMLReport writes r to w as a self-contained HTML page, as
+// WithHTMLReport does: the leaks grouped by fingerprint, each with its
+// stacks, collapsed, the tests they appeared during, and the number of
+// goroutines over the run, if r has a timeline.
+func WriteHTMLReport(w io.Writer, r SuiteReport) error {
+	return htmlReportTemplate.Execute(w, newHTMLReport(r))
+}
+
+// writeHTMLReportFile writes the HTML report of r to the file at path.
+func writeHTMLReportFile(path string, r SuiteReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	err = WriteHTMLReport(bw, r)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// htmlReport is what the HTML report template is executed with.
+type htmlReport struct {
+	Binary      string
+	TestsFailed bool
+	Leaks       int
+	Groups []htmlGroup
+	// Tests are the tests leaks appeared during, most leaks first
+	Tests []htmlTest
+	Chart *htmlChart
+}
+
+// htmlGroup is the leaks sharing a fingerprint.
+type htmlGroup struct {
+	Leak
+	Leaks []Leak
+	Tests []string
+}
+
+type htmlTest struct {
+	Name  string
+	Leaks int
+}
+
+// htmlChart is the number of goroutines over the run, drawn as a step line.
+type htmlChart struct {
+	Width, Height int
+	Points        string
+	Max           int
+	Duration      string
+}
+
+func newHTMLReport(r SuiteReport) htmlReport {
+	rep := htmlReport{Binary: r.Binary, TestsFailed: r.TestsFailed, Leaks: len(r.Leaks)}
+	index := map[string]int{}
+	perTest := map[string]int{}
+	for _, l := range r.Leaks {
+		i, ok := index[l.Fingerprint]
+		if !ok {
+			i = len(rep.Groups)
+			index[l.Fingerprint] = i
+			rep.Groups = append(rep.Groups, htmlGroup{Leak: l})
+		}
+		grp := &rep.Groups[i]
+		grp.Leaks = append(grp.Leaks, l)
+		for _, test := range r.Tests[l.ID] {
+			perTest[test]++
+			if !contains(grp.Tests, test) {
+				grp.Tests = append(grp.Tests, test)
+			}
+		}
+	}
+	sort.SliceStable(rep.Groups, func(i, j int) bool {
+		return len(rep.Groups[i].Leaks) > len(rep.Groups[j].Leaks)
+	})
+	for test, n := range perTest {
+		rep.Tests = append(rep.Tests, htmlTest{Name: test, Leaks: n})
+	}
+	sort.Slice(rep.Tests, func(i, j int) bool {
+		if rep.Tests[i].Leaks != rep.Tests[j].Leaks {
+			return rep.Tests[i].Leaks > rep.Tests[j].Leaks
+		}
+		return rep.Tests[i].Name < rep.Tests[j].Name
+	})
+	rep.Chart = newHTMLChart(r.Timeline)
+	return rep
+}
+
+// newHTMLChart draws samples, or returns nil if there are too few to.
+func newHTMLChart(samples []Sample) *htmlChart {
+	if len(samples) < 2 {
+		return nil
+	}
+	c := &htmlChart{Width: 800, Height: 160}
+	for _, s := range samples {
+		if s.Goroutines > c.Max {
+			c.Max = s.Goroutines
+		}
+	}
+	start, span := samples[0].Time, samples[len(samples)-1].Time.Sub(samples[0].Time)
+	c.Duration = span.Round(time.Millisecond).String()
+	x := func(s Sample) float64 {
+		if span <= 0 {
+			return 0
+		}
+		return float64(c.Width) * float64(s.Time.Sub(start)) / float64(span)
+	}
+	y := func(s Sample) float64 {
+		if c.Max == 0 {
+			return float64(c.Height)
+		}
+		return float64(c.Height) * (1 - float64(s.Goroutines)/float64(c.Max))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%.1f,%.1f", x(samples[0]), y(samples[0]))
+	for i, s := range samples[1:] {
+		// the count holds until the next sample changes it
+		fmt.Fprintf(&b, " %.1f,%.1f %.1f,%.1f", x(s), y(samples[i]), x(s), y(s))
+	}
+	c.Points = b.String()
+	return c
+}
+
+// contains reports whether s holds v.
+func contains(s []string, v string) bool {
+	for _, have := range s {
+		if have == v {
+			return true
+		}
+	}
+	return false
+}
+
+// stackHeader returns the first line of a stack, such as
+// "goroutine 7 [chan receive]:".
+func stackHeader(stack string) string {
+	first, _, _ := strings.Cut(stack, "\n")
+	return first
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"header": stackHeader,
+	"join":   strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>leaktest: {{.Binary}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+pre { background: #f6f6f6; padding: .5em; overflow-x: auto; }
+code, pre { font-size: 13px; }
+details { margin: .3em 0; }
+details.group { border: 1px solid #ddd; border-radius: 4px; padding: .5em; }
+summary { cursor: pointer; }
+.count { font-weight: bold; }
+.meta { color: #666; }
+table { border-collapse: collapse; }
+td, th { text-align: left; padding: .2em 1em .2em 0; }
+svg { border: 1px solid #ddd; }
+</style>
+</head>
+<body>
+<h1>leaktest: {{.Binary}}</h1>
+{{if .TestsFailed}}<p>The tests failed, the leaks below may be a consequence of that failure.</p>
+{{end}}{{if .Leaks}}<p>{{.Leaks}} leaked goroutine(s), in {{len .Groups}} group(s) of the same fingerprint.</p>
+{{else}}<p>No goroutines leaked.</p>
+{{end}}
+{{- with .Chart}}
+<h2>Goroutines over the run</h2>
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" xmlns="http://www.w3.org/2000/svg">
+<polyline points="{{.Points}}" fill="none" stroke="#c33" stroke-width="1.5"/>
+</svg>
+<p class="meta">0 to {{.Max}} goroutine(s), over {{.Duration}}</p>
+{{- end}}
+{{- if .Groups}}
+<h2>Leaks</h2>
+{{- range .Groups}}
+<details class="group">
+<summary><span class="count">{{len .Leaks}}×</span> {{if .CreatedBy}}created by <code>{{.CreatedBy}}</code>{{else}}the main goroutine{{end}}</summary>
+<p class="meta">fingerprint <code>{{.Fingerprint}}</code>, {{.Class}}, {{.Category}}{{if .Tests}}, during {{join .Tests ", "}}{{end}}</p>
+{{- range .Leaks}}
+<details><summary><code>{{header .Stack}}</code></summary><pre>{{.Stack}}</pre></details>
+{{- end}}
+</details>
+{{- end}}
+{{- end}}
+{{- if .Tests}}
+<h2>Tests</h2>
+<table>
+<tr><th>Test</th><th>Leaks</th></tr>
+{{- range .Tests}}
+<tr><td>{{.Name}}</td><td>{{.Leaks}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
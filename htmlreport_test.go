@@ -0,0 +1,111 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const timedOutDump = `panic: test timed out after 10s
+	running tests:
+		TestServe (10s)
+
+goroutine 7 [chan receive]:
+example.com/pkg.(*Server).loop(0xc000010000)
+	/src/pkg/server.go:42 +0x25
+created by example.com/pkg.NewServer in goroutine 6
+	/src/pkg/server.go:20 +0x90
+
+goroutine 8 [select]:
+example.com/pkg.tick()
+	/src/pkg/tick.go:9 +0x30
+created by example.com/pkg.Start in goroutine 6
+	/src/pkg/tick.go:5 +0x25
+exit status 2
+FAIL	example.com/pkg	10.012s
+`
+
+func TestParseDump(t *testing.T) {
+	leaks := ParseDump([]byte(timedOutDump))
+	if len(leaks) != 2 {
+		t.Fatalf("want 2 goroutines, got %+v", leaks)
+	}
+	if leaks[0].ID != 7 || leaks[0].File != "/src/pkg/server.go" || leaks[0].Line != 20 {
+		t.Errorf("unexpected first leak %+v", leaks[0])
+	}
+	if strings.Contains(leaks[1].Stack, "exit status") || !strings.HasSuffix(leaks[1].Stack, "tick.go:5 +0x25") {
+		t.Errorf("trailing output kept in the stack: %q", leaks[1].Stack)
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	leaks := ParseDump([]byte(timedOutDump))
+	start := time.Now()
+	var b strings.Builder
+	err := WriteHTMLReport(&b, SuiteReport{
+		Binary: "pkg.test",
+		Leaks:  append(leaks, leaks[0]),
+		Tests:  map[uint64][]string{7: {"TestServe"}},
+		Timeline: []Sample{
+			{Time: start, Goroutines: 1},
+			{Time: start.Add(time.Second), Goroutines: 3, Tests: []string{"TestServe"}},
+			{Time: start.Add(2 * time.Second), Goroutines: 2},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := b.String()
+	for _, want := range []string{
+		"<title>leaktest: pkg.test</title>",
+		"3 leaked goroutine(s), in 2 group(s)",
+		`<span class="count">2×</span> created by <code>example.com/pkg.NewServer (/src/pkg/server.go:20)</code>`,
+		"during TestServe",
+		"<code>goroutine 8 [select]:</code>",
+		"<td>TestServe</td><td>2</td>",
+		`<polyline points="0.0,106.7 400.0,106.7 400.0,0.0 800.0,0.0 800.0,53.3"`,
+		"0 to 3 goroutine(s), over 2s",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("report missing %q:\n%s", want, page)
+		}
+	}
+}
+
+func TestCheckMainHTMLReport(t *testing.T) {
+	block := make(chan struct{})
+	done := make(chan struct{})
+	defer func() {
+		close(block)
+		<-done
+	}()
+
+	path := filepath.Join(t.TempDir(), "report.html")
+	checker := &tbReporter{}
+	checkMain(runFunc(func() int {
+		// let the timeline sample the count before the goroutine starts,
+		// and after
+		time.Sleep(3 * TickerInterval)
+		go func() {
+			defer close(done)
+			<-block
+		}()
+		time.Sleep(3 * TickerInterval)
+		return 0
+	}), checker, 100*time.Millisecond, 0, []Option{WithHTMLReport(path)})
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(b)
+	if !strings.Contains(page, "leaktest.TestCheckMainHTMLReport") || !strings.Contains(page, "<td>TestCheckMainHTMLReport</td><td>1</td>") {
+		t.Errorf("leak missing from the report:\n%s", page)
+	}
+	if !strings.Contains(page, "<polyline") {
+		t.Errorf("timeline missing from the report:\n%s", page)
+	}
+}
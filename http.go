@@ -0,0 +1,27 @@
+package leaktest
+
+import "net/http"
+
+// WithCloseIdleConnections closes the idle connections of
+// http.DefaultTransport, and of transports, right before a check takes its
+// first snapshot, as with WithPreCheckHooks. Transports include
+// *http.Transport and *http.Client. The goroutines serving idle keep-alive
+// connections then exit, rather than lingering until the connections time
+// out, so the check no longer ignores the goroutines serving keep-alive
+// connections as it otherwise does: those still running belong to
+// connections left in use, such as by a response body never closed, and are
+// reported as leaks.
+func WithCloseIdleConnections(transports ...interface{ CloseIdleConnections() }) Option {
+	hook := WithPreCheckHooks(func() {
+		if t, ok := http.DefaultTransport.(interface{ CloseIdleConnections() }); ok {
+			t.CloseIdleConnections()
+		}
+		for _, t := range transports {
+			t.CloseIdleConnections()
+		}
+	})
+	return func(c *config) {
+		hook(c)
+		c.keepAlives = true
+	}
+}
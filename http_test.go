@@ -0,0 +1,61 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// closeCounter counts calls to CloseIdleConnections.
+type closeCounter int
+
+func (c *closeCounter) CloseIdleConnections() { *c++ }
+
+func TestWithCloseIdleConnections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	transport := &http.Transport{}
+	var closes closeCounter
+
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, time.Second, WithCloseIdleConnections(transport, &closes))
+	resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	snapshot()
+	if checker.failed {
+		t.Errorf("unexpected failure: %q", checker.msgs)
+	}
+	if closes != 1 {
+		t.Errorf("CloseIdleConnections called %d times; want 1", closes)
+	}
+}
+
+func TestWithCloseIdleConnectionsReportsKeepAlives(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+	transport := &http.Transport{}
+	defer transport.CloseIdleConnections()
+
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, 200*time.Millisecond, WithCloseIdleConnections(transport))
+	resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the body is never closed, which keeps its connection in use, so
+	// closing the idle ones leaves it running
+	snapshot()
+	resp.Body.Close()
+	if !checker.failed || !strings.Contains(strings.Join(checker.msgs, "\n"), "net/http.(*persistConn).readLoop") {
+		t.Errorf("keep-alive connection left in use not reported: %q", checker.msgs)
+	}
+}
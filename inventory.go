@@ -0,0 +1,102 @@
+package leaktest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// inventory counts goroutines by fingerprint, see WithInventoryFile.
+type inventory struct {
+	Goroutines []inventoryEntry `json:"goroutines"`
+}
+
+type inventoryEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	CreatedBy   string `json:"created_by,omitempty"`
+	Count       int    `json:"count"`
+}
+
+// takeInventory returns the inventory of gs, ordered by fingerprint.
+func takeInventory(gs []*goroutine) inventory {
+	var inv inventory
+	for _, fc := range countFingerprints(gs) {
+		inv.Goroutines = append(inv.Goroutines, inventoryEntry{
+			Fingerprint: fc.fp,
+			CreatedBy:   fc.creator.function,
+			Count:       fc.n,
+		})
+	}
+	sort.Slice(inv.Goroutines, func(i, j int) bool {
+		return inv.Goroutines[i].Fingerprint < inv.Goroutines[j].Fingerprint
+	})
+	return inv
+}
+
+// growth describes the kinds of goroutines there are more of in inv than
+// in prev.
+func (inv inventory) growth(prev inventory) []string {
+	before := map[string]int{}
+	for _, e := range prev.Goroutines {
+		before[e.Fingerprint] = e.Count
+	}
+	var grown []string
+	for _, e := range inv.Goroutines {
+		if n := before[e.Fingerprint]; e.Count > n {
+			desc := fmt.Sprintf("%s: %d → %d", e.Fingerprint, n, e.Count)
+			if e.CreatedBy != "" {
+				desc += " created by " + e.CreatedBy
+			}
+			grown = append(grown, desc)
+		}
+	}
+	return grown
+}
+
+// readInventory reads the inventory in the file at path, and reports
+// whether there was one, as there isn't before the first run.
+func readInventory(path string) (inventory, bool, error) {
+	var inv inventory
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return inv, false, nil
+	} else if err != nil {
+		return inv, false, err
+	}
+	err = json.Unmarshal(b, &inv)
+	return inv, true, err
+}
+
+func writeInventory(path string, inv inventory) error {
+	b, err := json.MarshalIndent(inv, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// checkInventory compares the inventory of gs with the one recorded in
+// path by the previous run, reporting growth to t, and records it for the
+// next run.
+func checkInventory(t ErrorReporter, path string, gs []*goroutine) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	prev, found, err := readInventory(path)
+	if err != nil {
+		t.Errorf("leaktest: error reading goroutine inventory: %s", err)
+		return
+	}
+	inv := takeInventory(gs)
+	// the previous run may well have recorded no goroutines at all
+	if grown := inv.growth(prev); found && len(grown) > 0 {
+		t.Errorf("leaktest: goroutines grew since the previous run recorded in %s:\n%s", path, strings.Join(grown, "\n"))
+	}
+	if err := writeInventory(path, inv); err != nil {
+		t.Errorf("leaktest: error writing goroutine inventory: %s", err)
+	}
+}
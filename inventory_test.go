@@ -0,0 +1,67 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInventoryGrowth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+
+	run := func() *tbReporter {
+		checker := &tbReporter{}
+		code := checkMain(runFunc(func() int { return 0 }), checker, 100*time.Millisecond, 0, []Option{WithInventoryFile(path)})
+		if code != 0 && !checker.failed {
+			t.Errorf("exit code %d without a failure", code)
+		}
+		return checker
+	}
+	if checker := run(); checker.failed {
+		t.Fatalf("first run failed: %q", checker.msgs)
+	}
+	if checker := run(); checker.failed {
+		t.Fatalf("run without growth failed: %q", checker.msgs)
+	}
+
+	started = make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+	checker := run()
+	if !checker.failed {
+		t.Fatal("growth across runs not reported")
+	}
+	if msg := strings.Join(checker.msgs, "\n"); !strings.Contains(msg, ": 1 → 2 created by github.com/fortytw2/leaktest.TestInventoryGrowth") {
+		t.Errorf("unexpected report %q", msg)
+	}
+}
+
+func TestInventoryGrowthFromNone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	g, err := interestingRecord([]byte(`goroutine 7 [chan receive]:
+example.com/pkg.worker()
+	/src/pkg/worker.go:10 +0x25
+created by example.com/pkg.Start in goroutine 1
+	/src/pkg/worker.go:5 +0x90`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker := &testReporter{}
+	checkInventory(checker, path, nil)
+	if checker.failed {
+		t.Fatalf("first run failed: %q", checker.msgs)
+	}
+	checkInventory(checker, path, []*goroutine{g})
+	if !checker.failed || !strings.Contains(strings.Join(checker.msgs, "\n"), ": 0 → 1 created by example.com/pkg.Start") {
+		t.Errorf("growth from no goroutines not reported: %q", checker.msgs)
+	}
+}
@@ -0,0 +1,68 @@
+package leaktest
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// IsolatedEnv is the environment variable Isolated sets, to the name of the
+// test, in the child process it runs the test in.
+const IsolatedEnv = "LEAKTEST_ISOLATED"
+
+// Isolated runs f in a fresh child process, re-executing the test binary
+// with -test.run set to match only t, and checks there that f leaks no
+// goroutines, waiting up to 5 seconds in error conditions. The child's
+// output is relayed to t, and t fails if the child does. t is a *testing.T
+// or a *testing.B.
+//
+// As nothing else runs in the child, goroutines leaked by other tests can't
+// be blamed on f and vice versa. This is meant for the worst offenders, as
+// starting a process is far slower than a regular check. Everything in the
+// test before Isolated runs in both processes, and everything after it only
+// in the parent, so it's best called at the top of a test with the whole
+// body in f.
+func Isolated[Sub TB[Sub]](t Sub, f func(t Sub), opts ...Option) {
+	t.Helper()
+	if disabled {
+		f(t)
+		return
+	}
+	if os.Getenv(IsolatedEnv) == t.Name() {
+		c := NewChecker(t, opts...)
+		defer c.Check()
+		f(t)
+		return
+	}
+	runIsolated(t, t.Name())
+}
+
+// runIsolated runs the test called name in a child process, reporting its
+// failure to t.
+func runIsolated(t ErrorReporter, name string) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	cmd := exec.Command(os.Args[0], "-test.run="+runPattern(name), "-test.count=1", "-test.v")
+	cmd.Env = append(os.Environ(), IsolatedEnv+"="+name)
+	out, err := cmd.CombinedOutput()
+	switch {
+	case err != nil:
+		t.Errorf("leaktest: isolated run of %s failed: %s\n%s", name, err, out)
+	case strings.Contains(string(out), "no tests to run"):
+		t.Errorf("leaktest: isolated run of %s matched no tests\n%s", name, out)
+	case len(out) > 0:
+		logf(t, "leaktest: isolated run of %s:\n%s", name, out)
+	}
+}
+
+// runPattern returns the -test.run pattern that matches only the test
+// called name, which has one element per level of subtests.
+func runPattern(name string) string {
+	parts := strings.Split(name, "/")
+	for i, p := range parts {
+		parts[i] = "^" + regexp.QuoteMeta(p) + "$"
+	}
+	return strings.Join(parts, "/")
+}
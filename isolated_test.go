@@ -0,0 +1,56 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsolated(t *testing.T) {
+	Isolated(t, func(t *testing.T) {
+		if os.Getenv(IsolatedEnv) != t.Name() {
+			t.Error("not running in the child process")
+		}
+		done := make(chan struct{})
+		go close(done)
+		<-done
+	})
+}
+
+// TestIsolatedLeaky leaks a goroutine in its child process. It only runs
+// when started by TestIsolatedReportsLeaks.
+func TestIsolatedLeaky(t *testing.T) {
+	if os.Getenv("LEAKTEST_TEST_LEAKY") == "" {
+		t.Skip("only run by TestIsolatedReportsLeaks")
+	}
+	Isolated(t, func(t *testing.T) {
+		block := make(chan struct{})
+		go func() { <-block }()
+	})
+}
+
+func TestIsolatedReportsLeaks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the child's leak check to time out")
+	}
+	t.Setenv("LEAKTEST_TEST_LEAKY", "1")
+	checker := &tbReporter{deadline: time.Now().Add(time.Minute)}
+	start := time.Now()
+	runIsolated(checker, "TestIsolatedLeaky")
+	if !checker.failed {
+		t.Fatal("didn't report the child's leak")
+	}
+	if !strings.Contains(checker.msgs[0], "leaked goroutine") {
+		t.Errorf("child output not relayed: %s", checker.msgs[0])
+	}
+	t.Logf("isolated run took %s", time.Since(start))
+}
+
+func TestRunPattern(t *testing.T) {
+	if got, want := runPattern("TestFoo/case_1.a"), `^TestFoo$/^case_1\.a$`; got != want {
+		t.Errorf("runPattern = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package leaktest
+
+import (
+	"context"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// scopeLabel is the pprof label used to tell which goroutines were started
+// by a function run by CheckFunc with WithLabelScope.
+const scopeLabel = "leaktest.scope"
+
+// scopeSeq generates unique scope label values.
+var scopeSeq uint64
+
+// noLabelsOnce makes sure the lack of labels in stack traces is only
+// reported once per process.
+var noLabelsOnce sync.Once
+
+// runScoped runs fn under a scope label unique to c, so that only the
+// goroutines fn starts are considered when checking for leaks. If the
+// runtime doesn't show labels in goroutine dumps, fn is run as-is.
+func (c *Checker) runScoped(fn func()) {
+	scope := strconv.FormatUint(atomic.AddUint64(&scopeSeq, 1), 10)
+	pprof.Do(context.Background(), pprof.Labels(scopeLabel, scope), func(context.Context) {
+		if currentLabels()[scopeLabel] == scope {
+			c.scope = scope
+		} else {
+			noLabelsOnce.Do(func() {
+				warnf(c.t, "leaktest: goroutine labels aren't shown in stack traces (needs Go 1.26+ with GODEBUG=tracebacklabels=1), checking all goroutines")
+			})
+		}
+		fn()
+	})
+}
+
+// currentLabels returns the labels shown in the current goroutine's stack
+// trace header.
+func currentLabels() map[string]string {
+	buf := make([]byte, 1024)
+	buf = buf[:runtime.Stack(buf, false)]
+	return parseLabels(strings.SplitN(string(buf), "\n", 2)[0])
+}
+
+// parseLabels parses the pprof labels out of a goroutine header such as
+//
+//	goroutine 7 [chan receive] {a: 1, "b c": "d"}:
+//
+// returning nil if there are none. Keys and values are quoted by the runtime
+// only when they need to be.
+func parseLabels(header string) map[string]string {
+	i := strings.Index(header, "] {")
+	if i < 0 || !strings.HasSuffix(header, "}:") {
+		return nil
+	}
+	s := header[i+3 : len(header)-2]
+	labels := map[string]string{}
+	for s != "" {
+		key, rest, ok := labelToken(s, ": ")
+		if !ok {
+			return labels
+		}
+		value, rest, ok := labelToken(rest, ", ")
+		if !ok {
+			return labels
+		}
+		labels[key] = value
+		s = rest
+	}
+	return labels
+}
+
+// labelToken reads a possibly quoted token from the start of s, up to sep or
+// the end of s, returning the unquoted token and what follows sep.
+func labelToken(s, sep string) (string, string, bool) {
+	if strings.HasPrefix(s, `"`) {
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return "", "", false
+		}
+		tok, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		return tok, strings.TrimPrefix(s[end+1:], sep), true
+	}
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", true
+}
@@ -0,0 +1,92 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"context"
+	"reflect"
+	"runtime/pprof"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseLabels(t *testing.T) {
+	cases := []struct {
+		header string
+		want   map[string]string
+	}{
+		{"goroutine 7 [chan receive]:", nil},
+		{"goroutine 7 [chan receive] {a: 1}:", map[string]string{"a": "1"}},
+		{
+			`goroutine 7 [select, 2 minutes] {leaktest.scope: 12, "a b": "c: \"d\", e"}:`,
+			map[string]string{"leaktest.scope": "12", "a b": `c: "d", e`},
+		},
+	}
+	for _, c := range cases {
+		if got := parseLabels(c.header); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseLabels(%q) = %v; want %v", c.header, got, c.want)
+		}
+	}
+}
+
+func TestCheckFuncWithLabelScope(t *testing.T) {
+	var supported bool
+	pprof.Do(context.Background(), pprof.Labels("k", "v"), func(context.Context) {
+		supported = currentLabels()["k"] == "v"
+	})
+	if !supported {
+		t.Skip("goroutine labels aren't shown in stack traces")
+	}
+
+	block := make(chan struct{})
+	defer close(block)
+
+	// a goroutine started concurrently by something other than the
+	// function under test
+	var wg sync.WaitGroup
+	wg.Add(1)
+	start := make(chan struct{})
+	go func() {
+		<-start
+		go func() { <-block }()
+		wg.Done()
+	}()
+
+	checker := &testReporter{}
+	CheckFunc(checker, func() {
+		close(start)
+		wg.Wait()
+	}, WithLabelScope())
+	if checker.failed {
+		t.Errorf("unrelated goroutine was reported as a leak: %s", checker.msg)
+	}
+
+	leaky := &tbReporter{deadline: time.Now().Add(deadlineGrace + 100*time.Millisecond)}
+	CheckFunc(leaky, func() {
+		go func() {
+			go func() { <-block }()
+		}()
+	}, WithLabelScope())
+	if !leaky.failed {
+		t.Error("didn't catch goroutine started by a goroutine started by the func")
+	}
+}
+
+func TestWithLabelScopeUnsupported(t *testing.T) {
+	var supported bool
+	pprof.Do(context.Background(), pprof.Labels("k", "v"), func(context.Context) {
+		supported = currentLabels()["k"] == "v"
+	})
+	if supported {
+		t.Skip("goroutine labels are shown in stack traces")
+	}
+	noLabelsOnce = sync.Once{}
+
+	// the notice that labels aren't shown mustn't fail a check without Logf
+	checker := &testReporter{}
+	CheckFunc(checker, func() {}, WithLabelScope())
+	if checker.failed {
+		t.Errorf("check without labels failed: %q", checker.msgs)
+	}
+}
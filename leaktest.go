@@ -7,24 +7,55 @@
 // test that may use goroutines.
 // copied out of the cockroachdb source tree with slight modifications to be
 // more re-useable
+//
+// Building with -tags leaktest_off turns every check into a no-op that
+// passes, so that harness packages calling leaktest can be linked into
+// release builds without the leak detection machinery.
 package leaktest
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"runtime"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-// TickerInterval defines the interval used by the ticker in Check* functions.
+// TickerInterval defines the interval at which Check* functions poll for
+// leaked goroutines to exit. The polling is shared by all checks waiting at
+// the same time, with some jitter added to the interval.
+//
+// Deprecated: Changing TickerInterval while checks run is a data race. Use
+// SetDefaultConfig with Config.WithTickerInterval instead, which takes
+// precedence.
 var TickerInterval = time.Millisecond * 50
 
 type goroutine struct {
 	id    uint64
 	stack string
+	// labels are the pprof labels shown in the goroutine's header, which
+	// the runtime only includes from Go 1.26 with GODEBUG=tracebacklabels=1
+	labels map[string]string
+	// state, status, nilChan, waited and lockedToThread come from the
+	// header, see parseHeader
+	state          State
+	status         string
+	nilChan        bool
+	waited         time.Duration
+	lockedToThread bool
+	// createdBy is the go statement that started the goroutine
+	createdBy frame
+	// parentID is the ID of the goroutine that ran that go statement, if
+	// known
+	parentID uint64
+	// keepAlive is set for the goroutines serving an HTTP keep-alive
+	// connection, which are ignored unless WithCloseIdleConnections is used
+	keepAlive bool
+	// fp caches the goroutine's fingerprint
+	fp string
 }
 
 type goroutineByID []*goroutine
@@ -34,56 +65,123 @@ func (g goroutineByID) Less(i, j int) bool { return g[i].id < g[j].id }
 func (g goroutineByID) Swap(i, j int)      { g[i], g[j] = g[j], g[i] }
 
 func interestingGoroutine(g string) (*goroutine, error) {
-	sl := strings.SplitN(g, "\n", 2)
-	if len(sl) != 2 {
+	return interestingRecord([]byte(g))
+}
+
+// interestingRecord is interestingGoroutine for a goroutine's record in a
+// dump. Most of a dump is usually ignored goroutines, so the record is only
+// copied once it's known not to be one.
+func interestingRecord(g []byte) (*goroutine, error) {
+	return parseRecord(g, false)
+}
+
+// parseRecord is interestingRecord, but with keepAlives set it returns the
+// goroutines serving HTTP keep-alive connections too, marked as such, for
+// the checks to ignore them or not, see config.ignored.
+func parseRecord(g []byte, keepAlives bool) (*goroutine, error) {
+	header, rest, ok := bytes.Cut(g, []byte("\n"))
+	if !ok {
 		return nil, fmt.Errorf("error parsing stack: %q", g)
 	}
-	stack := strings.TrimSpace(sl[1])
-	if strings.HasPrefix(stack, "testing.RunTests") {
+	stack := bytes.TrimSpace(rest)
+	if bytes.HasPrefix(stack, []byte("testing.RunTests")) {
 		return nil, nil
 	}
 
-	if stack == "" ||
+	if len(stack) == 0 ||
+		// Ignore timers cancelling a context.WithTimeout, which briefly
+		// appear when the context passed to CheckContext expires.
+		(bytes.HasPrefix(stack, []byte("context.")) && bytes.Contains(stack, []byte("created by time.goFunc"))) ||
 		// Ignore HTTP keep alives
-		strings.Contains(stack, ").readLoop(") ||
-		strings.Contains(stack, ").writeLoop(") ||
+		(!keepAlives && keepAlive(stack)) ||
+		// Ignore the goroutines running tests themselves, such as paused
+		// parallel subtests or parents waiting for their subtests.
+		bytes.Contains(stack, []byte("testing.tRunner(")) ||
+		// Ignore the poller shared by the checks, see poller.
+		bytes.Contains(stack, []byte("leaktest.(*poller).run(")) ||
+		// Ignore CheckMain's timeline, which the first test's baseline may
+		// miss if it hadn't started yet.
+		bytes.Contains(stack, []byte("leaktest.(*timeline).run(")) ||
 		// Below are the stacks ignored by the upstream leaktest code.
-		strings.Contains(stack, "testing.Main(") ||
-		strings.Contains(stack, "testing.(*T).Run(") ||
-		strings.Contains(stack, "runtime.goexit") ||
-		strings.Contains(stack, "created by runtime.gc") ||
-		strings.Contains(stack, "interestingGoroutines") ||
-		strings.Contains(stack, "runtime.MHeap_Scavenger") ||
-		strings.Contains(stack, "signal.signal_recv") ||
-		strings.Contains(stack, "sigterm.handler") ||
-		strings.Contains(stack, "runtime_mcall") ||
-		strings.Contains(stack, "goroutine in C code") {
+		bytes.Contains(stack, []byte("testing.Main(")) ||
+		bytes.Contains(stack, []byte("testing.(*T).Run(")) ||
+		bytes.Contains(stack, []byte("runtime.goexit")) ||
+		bytes.Contains(stack, []byte("created by runtime.gc")) ||
+		bytes.Contains(stack, []byte("interestingGoroutines")) ||
+		bytes.Contains(stack, []byte("runtime.MHeap_Scavenger")) ||
+		bytes.Contains(stack, []byte("signal.signal_recv")) ||
+		bytes.Contains(stack, []byte("sigterm.handler")) ||
+		bytes.Contains(stack, []byte("runtime_mcall")) ||
+		bytes.Contains(stack, []byte("goroutine in C code")) ||
+		platformIgnored(stack) {
 		return nil, nil
 	}
 
-	// Parse the goroutine's ID from the header line.
-	h := strings.SplitN(sl[0], " ", 3)
-	if len(h) < 3 {
-		return nil, fmt.Errorf("error parsing stack header: %q", sl[0])
-	}
-	id, err := strconv.ParseUint(h[1], 10, 64)
+	h, err := parseHeader(string(header))
 	if err != nil {
-		return nil, fmt.Errorf("error parsing goroutine id: %s", err)
+		return nil, err
 	}
 
-	return &goroutine{id: id, stack: strings.TrimSpace(g)}, nil
+	full := string(bytes.TrimSpace(g))
+	stackStr := strings.TrimSpace(full[len(header):])
+	return &goroutine{
+		id:             h.id,
+		stack:          full,
+		labels:         h.labels,
+		state:          h.state,
+		status:         h.status,
+		nilChan:        h.nilChan,
+		waited:         h.waited,
+		lockedToThread: h.lockedToThread,
+		createdBy:      parseCreatedBy(stackStr),
+		parentID:       parseParentID(stackStr),
+		keepAlive:      keepAlives && keepAlive(stack),
+	}, nil
+}
+
+// keepAlive reports whether stack is that of a goroutine serving an HTTP
+// keep-alive connection.
+func keepAlive(stack []byte) bool {
+	return bytes.Contains(stack, []byte(").readLoop(")) || bytes.Contains(stack, []byte(").writeLoop("))
+}
+
+// dumpBuffers pools the buffers goroutine dumps are taken into, as suites
+// poll thousands of times.
+var dumpBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 2<<20)
+		return &buf
+	},
 }
 
 // interestingGoroutines returns all goroutines we care about for the purpose
-// of leak checking. It excludes testing or runtime ones.
-func interestingGoroutines(t ErrorReporter) []*goroutine {
-	buf := make([]byte, 2<<20)
-	buf = buf[:runtime.Stack(buf, true)]
+// of leak checking. It excludes testing or runtime ones. Stacks that can't
+// be parsed are skipped, and the errors parsing them are joined together.
+func interestingGoroutines() ([]*goroutine, error) {
+	if disabled {
+		return nil, nil
+	}
+	pooled := dumpBuffers.Get().(*[]byte)
+	buf, err := stackDump(*pooled)
+	// keep the buffer stackDump grew, if it did, for next time
+	*pooled = buf[:cap(buf)]
+	defer dumpBuffers.Put(pooled)
+	suiteOverhead.poll(len(buf))
 	var gs []*goroutine
-	for _, g := range strings.Split(string(buf), "\n\n") {
-		gr, err := interestingGoroutine(g)
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+		// the last goroutine's stack is cut short
+		if i := bytes.LastIndex(buf, []byte("\n\n")); i >= 0 {
+			buf = buf[:i]
+		}
+	}
+	s := dumpScanner{dump: buf}
+	for s.Scan() {
+		// the goroutine's stack is copied, as the buffer is reused
+		gr, err := parseRecord(s.Record(), true)
 		if err != nil {
-			t.Errorf("leaktest: %s", err)
+			errs = append(errs, err)
 			continue
 		} else if gr == nil {
 			continue
@@ -91,17 +189,28 @@ func interestingGoroutines(t ErrorReporter) []*goroutine {
 		gs = append(gs, gr)
 	}
 	sort.Sort(goroutineByID(gs))
-	return gs
+	return gs, errors.Join(errs...)
+}
+
+// unjoin splits an error created by errors.Join back into its parts.
+func unjoin(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if u, ok := err.(interface{ Unwrap() []error }); ok {
+		return u.Unwrap()
+	}
+	return []error{err}
 }
 
 // leakedGoroutines returns all goroutines we are considering leaked and
 // the boolean flag indicating if no leaks detected
-func leakedGoroutines(orig map[uint64]bool, interesting []*goroutine) ([]string, bool) {
-	leaked := make([]string, 0)
+func leakedGoroutines(orig map[uint64]bool, interesting []*goroutine) ([]*goroutine, bool) {
+	leaked := make([]*goroutine, 0)
 	flag := true
 	for _, g := range interesting {
 		if !orig[g.id] {
-			leaked = append(leaked, g.stack)
+			leaked = append(leaked, g)
 			flag = false
 		}
 	}
@@ -109,63 +218,112 @@ func leakedGoroutines(orig map[uint64]bool, interesting []*goroutine) ([]string,
 }
 
 // ErrorReporter is a tiny subset of a testing.TB to make testing not such a
-// massive pain
+// massive pain. Passing a nil ErrorReporter reports to standard error, which
+// is useful outside of tests.
 type ErrorReporter interface {
 	Errorf(format string, args ...interface{})
 }
 
 // Check snapshots the currently-running goroutines and returns a
 // function to be run at the end of tests to see whether any
-// goroutines leaked, waiting up to 5 seconds in error conditions
-func Check(t ErrorReporter) func() {
-	return CheckTimeout(t, 5*time.Second)
+// goroutines leaked, waiting up to 5 seconds in error conditions.
+// Under the race detector, which slows code down several times, this and
+// every other default wait is 4 times longer.
+func Check(t ErrorReporter, opts ...Option) func() {
+	return CheckTimeout(t, defaultTimeout(), opts...)
 }
 
 // CheckTimeout is the same as Check, but with a configurable timeout
-func CheckTimeout(t ErrorReporter, dur time.Duration) func() {
-	ctx, cancel := context.WithCancel(context.Background())
-	fn := CheckContext(ctx, t)
-	return func() {
-		timer := time.AfterFunc(dur, cancel)
-		fn()
-		// Remember to clean up the timer and context
-		timer.Stop()
-		cancel()
-	}
+func CheckTimeout(t ErrorReporter, dur time.Duration, opts ...Option) func() {
+	c := NewChecker(t, opts...)
+	c.enter(1)
+	return onCleanup(c.t, func() {
+		if h, ok := c.t.(tHelper); ok {
+			h.Helper()
+		}
+		defer c.exit()
+		c.CheckTimeout(dur)
+	})
 }
 
 // CheckContext is the same as Check, but uses a context.Context for
-// cancellation and timeout control
-func CheckContext(ctx context.Context, t ErrorReporter) func() {
-	orig := map[uint64]bool{}
-	for _, g := range interestingGoroutines(t) {
-		orig[g.id] = true
-	}
-	return func() {
-		var leaked []string
-		var ok bool
-		// fast check if we have no leaks
-		if leaked, ok = leakedGoroutines(orig, interestingGoroutines(t)); ok {
-			return
-		}
-		ticker := time.NewTicker(TickerInterval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				if leaked, ok = leakedGoroutines(orig, interestingGoroutines(t)); ok {
-					return
-				}
-				continue
-			case <-ctx.Done():
-				t.Errorf("leaktest: %v", ctx.Err())
-			}
-			break
+// cancellation and timeout control. If ctx is done while goroutines are
+// still leaked, the leaks are those of a last poll, and the report says how
+// their number went down while waiting, such as "12 → 4 → 2".
+func CheckContext(ctx context.Context, t ErrorReporter, opts ...Option) func() {
+	c := NewChecker(t, opts...)
+	c.enter(1)
+	return onCleanup(c.t, func() {
+		if h, ok := c.t.(tHelper); ok {
+			h.Helper()
 		}
+		defer c.exit()
+		c.CheckContext(ctx)
+	})
+}
 
-		for _, g := range leaked {
-			t.Errorf("leaktest: leaked goroutine: %v", g)
+// BindContext snapshots the currently-running goroutines and checks
+// whether any leaked once ctx is done, waiting up to 5 seconds in error
+// conditions. It fits harnesses that tear down by canceling a context
+// rather than with defer statements:
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	leaktest.BindContext(ctx, t)
+//	env := startEnv(ctx)
+//	...
+//	cancel()
+//
+// If t has a Cleanup method, the check also runs when the test finishes,
+// if ctx isn't done by then, and the test waits for it. Otherwise, wait on
+// the returned channel, closed once the check is done, before the test
+// ends.
+func BindContext(ctx context.Context, t ErrorReporter, opts ...Option) <-chan struct{} {
+	done := make(chan struct{})
+	if disabled {
+		close(done)
+		return done
+	}
+	c := NewChecker(t, opts...)
+	stop, started := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		// this goroutine started after the baseline, but isn't a leak
+		c.orig[currentGoroutineID()] = true
+		close(started)
+		select {
+		case <-ctx.Done():
+		case <-stop:
 		}
+		c.Check()
+	}()
+	<-started
+	onCleanup(c.t, func() {
+		close(stop)
+		<-done
+	})
+	return done
+}
+
+// CheckFunc snapshots the currently-running goroutines, runs fn and then
+// checks whether fn leaked any goroutines, waiting up to 5 seconds in error
+// conditions. It gives each case of a table-driven test its own leak check.
+//
+// It can run within the scope of another check of the same test or of a
+// parent test, such as a deferred Check: the leaks CheckFunc reports aren't
+// reported again by the enclosing check, which names the CheckFunc call
+// when it reports other goroutines started by fn, such as those CheckFunc
+// was told to ignore.
+func CheckFunc(t ErrorReporter, fn func(), opts ...Option) {
+	c := NewChecker(t, opts...)
+	if h, ok := c.t.(tHelper); ok {
+		h.Helper()
+	}
+	c.enter(1)
+	defer c.exit()
+	if c.cfg.labelScope {
+		c.runScoped(fn)
+	} else {
+		fn()
 	}
+	c.Check()
 }
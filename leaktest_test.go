@@ -1,9 +1,10 @@
+//go:build !leaktest_off
+
 package leaktest
 
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"sync"
@@ -11,16 +12,6 @@ import (
 	"time"
 )
 
-type testReporter struct {
-	failed bool
-	msg    string
-}
-
-func (tr *testReporter) Errorf(format string, args ...interface{}) {
-	tr.failed = true
-	tr.msg = fmt.Sprintf(format, args...)
-}
-
 // Client for the TestServer
 var testServer *httptest.Server
 
@@ -225,3 +216,85 @@ func TestInterestingGoroutine(t *testing.T) {
 
 	}
 }
+
+type helperReporter struct {
+	testReporter
+	helpers int
+}
+
+func (hr *helperReporter) Helper() {
+	hr.helpers++
+}
+
+func TestCheckCallsHelper(t *testing.T) {
+	checker := &helperReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+	snapshot()
+
+	if !checker.failed {
+		t.Error("didn't catch blocked goroutine")
+	}
+	if checker.helpers == 0 {
+		t.Error("Helper was never called")
+	}
+}
+
+func TestCheckFunc(t *testing.T) {
+	checker := &testReporter{}
+	CheckFunc(checker, func() {
+		done := make(chan struct{})
+		go close(done)
+		<-done
+	})
+	if checker.failed {
+		t.Errorf("unexpected failure: %s", checker.msg)
+	}
+
+	block := make(chan struct{})
+	defer close(block)
+	// a near test deadline keeps the leaky case from waiting 5 seconds
+	leaky := &tbReporter{deadline: time.Now().Add(deadlineGrace + 100*time.Millisecond)}
+	CheckFunc(leaky, func() {
+		go func() { <-block }()
+	})
+	if !leaky.failed {
+		t.Error("didn't catch blocked goroutine")
+	}
+}
+
+func TestBindContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	checker := &tbReporter{}
+	done := BindContext(ctx, checker)
+	exited := make(chan struct{})
+	go close(exited)
+	<-exited
+	cancel()
+	<-done
+	checker.runCleanups()
+	if checker.failed {
+		t.Errorf("unexpected failure: %q", checker.msgs)
+	}
+
+	block := make(chan struct{})
+	defer close(block)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	// a near test deadline keeps the leaky case from waiting 5 seconds
+	leaky := &tbReporter{deadline: time.Now().Add(deadlineGrace + 100*time.Millisecond)}
+	done = BindContext(ctx, leaky)
+	go func() { <-block }()
+	// the context isn't done, so the check runs on cleanup
+	leaky.runCleanups()
+	select {
+	case <-done:
+	default:
+		t.Error("cleanup didn't wait for the check")
+	}
+	if !leaky.failed {
+		t.Error("didn't catch blocked goroutine")
+	}
+}
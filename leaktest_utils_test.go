@@ -2,6 +2,7 @@ package leaktest
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"time"
@@ -28,3 +29,20 @@ func startKeepAliveEnabledServer(ctx context.Context) *httptest.Server {
 
 	return server
 }
+
+type testReporter struct {
+	failed bool
+	msg    string
+	msgs   []string
+}
+
+func (tr *testReporter) Errorf(format string, args ...interface{}) {
+	tr.failed = true
+	tr.msg = fmt.Sprintf(format, args...)
+	tr.msgs = append(tr.msgs, tr.msg)
+}
+
+func blockedGoroutine(started, block chan struct{}) {
+	close(started)
+	<-block
+}
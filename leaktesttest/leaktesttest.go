@@ -0,0 +1,209 @@
+// Package leaktesttest provides goroutines that leak in the typical ways,
+// so that custom leaktest configurations and ignore lists can be checked to
+// catch, or ignore, what they're meant to:
+//
+//	for _, f := range leaktesttest.Fixtures() {
+//		t.Run(f.Name, func(t *testing.T) {
+//			var r reporter
+//			check := leaktest.CheckTimeout(&r, time.Second, myOptions...)
+//			stop := f.Start()
+//			check()
+//			stop()
+//			if !r.failed {
+//				t.Errorf("%s not caught", f.Function)
+//			}
+//		})
+//	}
+package leaktesttest
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+)
+
+// Fixture is a typical way for a goroutine to leak.
+type Fixture struct {
+	// Name describes the leak
+	Name string
+	// Function is the function the leaked goroutine runs, as it appears in
+	// its stack, such as for IgnoreAnyFunction
+	Function string
+	// State is the state the leaked goroutine is in
+	State leaktest.State
+	// Start starts a leaked goroutine, returning once it's about to block,
+	// and returns a func that releases it and waits for it to exit
+	Start func() (stop func())
+}
+
+const pkg = "github.com/fortytw2/leaktest/leaktesttest."
+
+// Fixtures returns all the fixtures.
+func Fixtures() []Fixture {
+	return []Fixture{
+		{"receive on a channel no one sends on", pkg + "chanReceive", leaktest.StateChanReceive, ChanReceive},
+		{"send on a channel no one receives on", pkg + "chanSend", leaktest.StateChanSend, ChanSend},
+		{"select on channels no one else uses", pkg + "blockedSelect", leaktest.StateSelect, BlockedSelect},
+		{"sync.Mutex locked twice", pkg + "doubleLock", leaktest.StateMutexLock, DoubleLock},
+		{"sync.RWMutex locked while read-locked", pkg + "rwLock", leaktest.StateMutexLock, RWLock},
+		{"sync.Cond waited on with no one to signal it", pkg + "condWait", leaktest.StateCondWait, CondWait},
+		{"sync.WaitGroup waited on with no one to call Done", pkg + "waitGroupWait", leaktest.StateWaitGroupWait, WaitGroupWait},
+		{"ticker loop that's never stopped", pkg + "tickerLoop", leaktest.StateSelect, TickerLoop},
+		{"sleep loop that's never stopped", pkg + "sleepLoop", leaktest.StateSleep, SleepLoop},
+	}
+}
+
+// start runs f in a goroutine, returning once it's started, along with a
+// func that calls release and waits for f to return.
+func start(f func(started chan<- struct{}), release func()) func() {
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(started)
+	}()
+	<-started
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			release()
+			<-done
+		})
+	}
+}
+
+// ChanReceive leaks a goroutine receiving on a channel no one sends on.
+func ChanReceive() (stop func()) {
+	c := make(chan struct{})
+	return start(func(started chan<- struct{}) { chanReceive(started, c) }, func() { close(c) })
+}
+
+func chanReceive(started chan<- struct{}, c chan struct{}) {
+	close(started)
+	<-c
+}
+
+// ChanSend leaks a goroutine sending on a channel no one receives on.
+func ChanSend() (stop func()) {
+	c := make(chan struct{})
+	return start(func(started chan<- struct{}) { chanSend(started, c) }, func() { <-c })
+}
+
+func chanSend(started chan<- struct{}, c chan struct{}) {
+	close(started)
+	c <- struct{}{}
+}
+
+// BlockedSelect leaks a goroutine in a select on channels no one else
+// uses.
+func BlockedSelect() (stop func()) {
+	c := make(chan struct{})
+	c2 := make(chan struct{})
+	return start(func(started chan<- struct{}) { blockedSelect(started, c, c2) }, func() { close(c) })
+}
+
+func blockedSelect(started chan<- struct{}, c, c2 chan struct{}) {
+	close(started)
+	select {
+	case <-c:
+	case c2 <- struct{}{}:
+	}
+}
+
+// DoubleLock leaks a goroutine locking a sync.Mutex it already holds.
+func DoubleLock() (stop func()) {
+	var mu sync.Mutex
+	return start(func(started chan<- struct{}) { doubleLock(started, &mu) }, func() { mu.Unlock() })
+}
+
+func doubleLock(started chan<- struct{}, mu *sync.Mutex) {
+	mu.Lock()
+	close(started)
+	mu.Lock()
+	mu.Unlock()
+}
+
+// RWLock leaks a goroutine write-locking a sync.RWMutex it holds a read
+// lock on.
+func RWLock() (stop func()) {
+	var mu sync.RWMutex
+	return start(func(started chan<- struct{}) { rwLock(started, &mu) }, func() { mu.RUnlock() })
+}
+
+func rwLock(started chan<- struct{}, mu *sync.RWMutex) {
+	mu.RLock()
+	close(started)
+	mu.Lock()
+	mu.Unlock()
+}
+
+// CondWait leaks a goroutine waiting on a sync.Cond no one signals.
+func CondWait() (stop func()) {
+	var mu sync.Mutex
+	cond := sync.NewCond(&mu)
+	var released bool
+	return start(func(started chan<- struct{}) { condWait(started, cond, &released) }, func() {
+		mu.Lock()
+		released = true
+		mu.Unlock()
+		cond.Broadcast()
+	})
+}
+
+func condWait(started chan<- struct{}, cond *sync.Cond, released *bool) {
+	cond.L.Lock()
+	defer cond.L.Unlock()
+	close(started)
+	for !*released {
+		cond.Wait()
+	}
+}
+
+// WaitGroupWait leaks a goroutine waiting on a sync.WaitGroup no one calls
+// Done on.
+func WaitGroupWait() (stop func()) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	return start(func(started chan<- struct{}) { waitGroupWait(started, &wg) }, wg.Done)
+}
+
+func waitGroupWait(started chan<- struct{}, wg *sync.WaitGroup) {
+	close(started)
+	wg.Wait()
+}
+
+// TickerLoop leaks a goroutine doing periodic work with a time.Ticker that
+// no one stops.
+func TickerLoop() (stop func()) {
+	quit := make(chan struct{})
+	return start(func(started chan<- struct{}) { tickerLoop(started, quit) }, func() { close(quit) })
+}
+
+func tickerLoop(started chan<- struct{}, quit chan struct{}) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	close(started)
+	for {
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// SleepLoop leaks a goroutine polling in a loop with time.Sleep, which no
+// one stops.
+func SleepLoop() (stop func()) {
+	var quit atomic.Bool
+	return start(func(started chan<- struct{}) { sleepLoop(started, &quit) }, func() { quit.Store(true) })
+}
+
+func sleepLoop(started chan<- struct{}, quit *atomic.Bool) {
+	close(started)
+	for !quit.Load() {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
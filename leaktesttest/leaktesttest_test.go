@@ -0,0 +1,71 @@
+//go:build !leaktest_off
+
+package leaktesttest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+)
+
+type reporter struct {
+	mu     sync.Mutex
+	failed bool
+	msgs   []string
+}
+
+func (r *reporter) Errorf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed = true
+	r.msgs = append(r.msgs, format)
+}
+
+func TestFixtures(t *testing.T) {
+	for _, f := range Fixtures() {
+		t.Run(f.Name, func(t *testing.T) {
+			r := &reporter{}
+			check := leaktest.CheckTimeout(r, 100*time.Millisecond)
+			stop := f.Start()
+
+			var found *leaktest.Goroutine
+			// give the goroutine time to block, and sleep loops time to sleep
+			for i := 0; i < 100 && (found == nil || found.State != f.State); i++ {
+				time.Sleep(time.Millisecond)
+				found = nil
+				for _, g := range leaktest.Goroutines() {
+					if strings.Contains(g.Stack, f.Function+"(") {
+						g := g
+						found = &g
+					}
+				}
+			}
+			if found == nil {
+				t.Fatalf("no goroutine running %s", f.Function)
+			}
+			if found.State != f.State {
+				t.Errorf("State = %s; want %s", found.State, f.State)
+			}
+			check()
+			if !r.failed {
+				t.Errorf("leak of %s not caught", f.Function)
+			}
+			stop()
+		})
+	}
+}
+
+func TestFixturesStop(t *testing.T) {
+	for _, f := range Fixtures() {
+		r := &reporter{}
+		check := leaktest.CheckTimeout(r, time.Second)
+		f.Start()()
+		check()
+		if r.failed {
+			t.Errorf("%s: goroutine still running after stop", f.Name)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package leaktest
+
+import (
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"strings"
+)
+
+// defaultMetrics are the runtime metrics WithMetrics reports if given none.
+var defaultMetrics = []string{
+	"/sched/goroutines:goroutines",
+	"/sync/mutex/wait/total:seconds",
+	"/gc/heap/objects:objects",
+}
+
+// readMetrics reads the named runtime metrics.
+func readMetrics(names []string) []metrics.Sample {
+	samples := make([]metrics.Sample, len(names))
+	for i, name := range names {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+	return samples
+}
+
+// metricValue returns the value of a sample as a float64, and false if it
+// isn't a number, as for histograms and metrics the runtime doesn't have.
+func metricValue(s metrics.Sample) (float64, bool) {
+	switch s.Value.Kind() {
+	case metrics.KindUint64:
+		return float64(s.Value.Uint64()), true
+	case metrics.KindFloat64:
+		return s.Value.Float64(), true
+	}
+	return 0, false
+}
+
+// metricsDelta reads the runtime metrics read with the baseline again, if
+// the config asks for it, see WithMetrics, and returns a message showing how
+// they changed, or "".
+func (c *Checker) metricsDelta() string {
+	if len(c.baseMetrics) == 0 {
+		return ""
+	}
+	names := make([]string, len(c.baseMetrics))
+	for i, s := range c.baseMetrics {
+		names[i] = s.Name
+	}
+	var b strings.Builder
+	b.WriteString("leaktest: runtime metrics since the baseline:")
+	for i, now := range readMetrics(names) {
+		before, ok := metricValue(c.baseMetrics[i])
+		after, ok2 := metricValue(now)
+		if !ok || !ok2 {
+			fmt.Fprintf(&b, "\n\t%s: not a number, or not supported by this Go version", now.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "\n\t%s: %s → %s (%+g)", now.Name, formatMetric(before), formatMetric(after), after-before)
+	}
+	return b.String()
+}
+
+// formatMetric formats a metric's value, without a fractional part if it
+// has none.
+func formatMetric(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return fmt.Sprintf("%d", int64(v))
+	}
+	return fmt.Sprintf("%g", v)
+}
@@ -0,0 +1,37 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithMetrics(t *testing.T) {
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond, WithMetrics(), WithMetrics("/sched/goroutines:goroutines", "/no/such:metric"))
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+	snapshot()
+
+	msg := strings.Join(checker.msgs, "\n")
+	if !strings.Contains(msg, "/sched/goroutines:goroutines: ") || !strings.Contains(msg, "(+") {
+		t.Errorf("no goroutine count delta in %q", msg)
+	}
+	if !strings.Contains(msg, "/no/such:metric: not a number, or not supported") {
+		t.Errorf("unknown metric not called out in %q", msg)
+	}
+	if strings.Contains(msg, "/gc/heap/objects") {
+		t.Errorf("later WithMetrics didn't replace the default metrics: %q", msg)
+	}
+}
+
+func TestFormatMetric(t *testing.T) {
+	for v, want := range map[float64]string{12: "12", 0.25: "0.25", -3: "-3"} {
+		if got := formatMetric(v); got != want {
+			t.Errorf("formatMetric(%g) = %q; want %q", v, got, want)
+		}
+	}
+}
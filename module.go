@@ -0,0 +1,120 @@
+package leaktest
+
+import (
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+var (
+	mainModuleOnce sync.Once
+	mainModule     string
+)
+
+// modulePath returns the path of the module under test, or failing that of
+// the package the test binary was built from, or "" if neither is known.
+func modulePath() string {
+	mainModuleOnce.Do(func() {
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		mainModule = bi.Main.Path
+		if mainModule == "" {
+			// Outside of module mode, bi.Path is still the path of the
+			// package under test, with ".test" added for test binaries.
+			mainModule = strings.TrimSuffix(bi.Path, ".test")
+		}
+	})
+	return mainModule
+}
+
+var (
+	testPackageOnce sync.Once
+	testPkg         string
+)
+
+// testPackage returns the import path of the package the test binary was
+// built from, or "" if it isn't known.
+func testPackage() string {
+	testPackageOnce.Do(func() {
+		if bi, ok := debug.ReadBuildInfo(); ok && strings.HasSuffix(bi.Path, ".test") {
+			testPkg = strings.TrimSuffix(bi.Path, ".test")
+		}
+	})
+	return testPkg
+}
+
+// funcPackage returns the import path of the package a function belongs
+// to, given its fully qualified name as it appears in stack traces, such as
+// "net/http.(*persistConn).readLoop". Dots in the last element of the
+// import path are escaped as %2e in such names, so the package ends at the
+// first dot after the last slash.
+func funcPackage(fn string) string {
+	slash := strings.LastIndex(fn, "/")
+	if slash < 0 {
+		slash = 0
+	}
+	pkg := fn
+	if dot := strings.Index(fn[slash:], "."); dot >= 0 {
+		pkg = fn[:slash+dot]
+	}
+	return strings.Replace(pkg, "%2e", ".", -1)
+}
+
+// Class says where the code that started a leaked goroutine comes from,
+// relative to the module under test.
+type Class int
+
+// The classes are in the order leaks are reported in, most likely to be
+// actionable first.
+const (
+	// ClassFirstParty is for goroutines started by the module under test
+	ClassFirstParty Class = iota
+	// ClassTest is for goroutines started by code in _test.go files
+	ClassTest
+	// ClassDependency is for goroutines started by other modules
+	ClassDependency
+	// ClassStdlib is for goroutines started by the standard library
+	ClassStdlib
+	// ClassUnknown is for goroutines whose creator isn't known
+	ClassUnknown
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassFirstParty:
+		return "first-party"
+	case ClassTest:
+		return "test-code"
+	case ClassDependency:
+		return "dependency"
+	case ClassStdlib:
+		return "stdlib"
+	}
+	return "unknown"
+}
+
+// classify returns the class of a goroutine started by the go statement at
+// createdBy, relative to the module under test.
+func classify(createdBy frame, module string) Class {
+	fn := createdBy.function
+	if fn == "" {
+		return ClassUnknown
+	}
+	if strings.HasSuffix(createdBy.file, "_test.go") {
+		return ClassTest
+	}
+	pkg := funcPackage(fn)
+	switch {
+	case module != "" && (pkg == module || strings.HasPrefix(pkg, module+"/")):
+		return ClassFirstParty
+	case pkg == "main":
+		return ClassFirstParty
+	case !strings.Contains(strings.SplitN(pkg, "/", 2)[0], "."):
+		// the standard library's import paths have no dot in their first
+		// element, unlike those of modules
+		return ClassStdlib
+	}
+	return ClassDependency
+}
@@ -0,0 +1,45 @@
+package leaktest
+
+import "testing"
+
+func TestFuncPackage(t *testing.T) {
+	cases := map[string]string{
+		"main.main":                                    "main",
+		"net/http.(*persistConn).readLoop":             "net/http",
+		"github.com/fortytw2/leaktest.TestCheck.func1": "github.com/fortytw2/leaktest",
+		"gopkg.in/yaml.v3.(*parser).parse":             "gopkg.in/yaml",
+	}
+	for fn, want := range cases {
+		if got := funcPackage(fn); got != want {
+			t.Errorf("funcPackage(%q) = %q; want %q", fn, got, want)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	const module = "example.com/mod"
+	cases := []struct {
+		createdBy frame
+		want      Class
+	}{
+		{frame{function: "example.com/mod.Start", file: "/src/mod/start.go"}, ClassFirstParty},
+		{frame{function: "example.com/mod/sub.Start"}, ClassFirstParty},
+		{frame{function: "example.com/mod.TestStart", file: "/src/mod/start_test.go"}, ClassTest},
+		{frame{function: "example.com/module.Start"}, ClassDependency},
+		{frame{function: "github.com/other/dep.Start"}, ClassDependency},
+		{frame{function: "net/http.(*Server).Serve"}, ClassStdlib},
+		{frame{function: "time.goFunc"}, ClassStdlib},
+		{frame{}, ClassUnknown},
+	}
+	for _, c := range cases {
+		if got := classify(c.createdBy, module); got != c.want {
+			t.Errorf("classify(%v) = %v; want %v", c.createdBy, got, c.want)
+		}
+	}
+}
+
+func TestModulePath(t *testing.T) {
+	if got := modulePath(); got != "github.com/fortytw2/leaktest" {
+		t.Errorf("modulePath = %q", got)
+	}
+}
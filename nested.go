@@ -0,0 +1,132 @@
+package leaktest
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var (
+	activeMu sync.Mutex
+	// active are the checks whose scope hasn't ended, in the order they
+	// started, so that nested checks can tell the checks enclosing them what
+	// they found
+	active []*Checker
+)
+
+// nesting is what a Checker was told by the checks nested in its scope.
+type nesting struct {
+	// site is where the nested check was called, if the Checker is one
+	site string
+	// reported are the IDs of the goroutines nested checks reported as
+	// leaked, which aren't reported again
+	reported map[uint64]bool
+	// startedIn holds, for the other goroutines started in a nested check's
+	// scope that outlived it, where that check was called
+	startedIn map[uint64]string
+	// lastLeaked are the IDs of the goroutines this Checker last reported
+	lastLeaked map[uint64]bool
+}
+
+// enter registers c as active until exit is called, naming its scope after
+// the line skip frames above enter's caller.
+func (c *Checker) enter(skip int) {
+	if disabled {
+		return
+	}
+	if _, file, line, ok := runtime.Caller(skip + 1); ok {
+		c.nesting.site = fmt.Sprintf("%s:%d", file, line)
+	}
+	activeMu.Lock()
+	active = append(active, c)
+	activeMu.Unlock()
+}
+
+// exit unregisters c, and tells the active checks enclosing it about the
+// goroutines started in its scope that are still running: those it
+// reported aren't reported again, and the others are reported as started
+// in its scope.
+func (c *Checker) exit() {
+	if disabled {
+		return
+	}
+	activeMu.Lock()
+	var enclosing []*Checker
+	for i, e := range active {
+		if e == c {
+			active = append(active[:i:i], active[i+1:]...)
+			break
+		}
+		if encloses(e, c) {
+			enclosing = append(enclosing, e)
+		}
+	}
+	activeMu.Unlock()
+	if len(enclosing) == 0 {
+		return
+	}
+	all, _ := interestingGoroutines()
+	c.mu.Lock()
+	var reported, survived []uint64
+	for _, g := range all {
+		switch {
+		case c.orig[g.id] || c.excluded[g.id]:
+		case c.nesting.lastLeaked[g.id]:
+			reported = append(reported, g.id)
+		default:
+			survived = append(survived, g.id)
+		}
+	}
+	c.mu.Unlock()
+	for _, e := range enclosing {
+		e.mu.Lock()
+		if e.nesting.reported == nil {
+			e.nesting.reported = map[uint64]bool{}
+			e.nesting.startedIn = map[uint64]string{}
+		}
+		for _, id := range reported {
+			e.nesting.reported[id] = true
+		}
+		for _, id := range survived {
+			if _, ok := e.nesting.startedIn[id]; !ok {
+				e.nesting.startedIn[id] = c.nesting.site
+			}
+		}
+		e.mu.Unlock()
+	}
+}
+
+// encloses reports whether outer's scope encloses inner's, which requires
+// both to report to the same test, or inner to report to one of its
+// subtests.
+func encloses(outer, inner *Checker) bool {
+	o, i := testName(outer.t), testName(inner.t)
+	return o != "" && (i == o || strings.HasPrefix(i, o+"/"))
+}
+
+// setReported records the goroutines c reported, for exit.
+func (c *Checker) setReported(leaked []*goroutine) {
+	ids := make(map[uint64]bool, len(leaked))
+	for _, g := range leaked {
+		ids[g.id] = true
+	}
+	c.mu.Lock()
+	c.nesting.lastLeaked = ids
+	c.mu.Unlock()
+}
+
+// reportedByNested reports whether a nested check already reported g.
+func (c *Checker) reportedByNested(g *goroutine) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nesting.reported[g.id]
+}
+
+// nestedSite returns where the nested check g was started in the scope of
+// was called, or "".
+func (c *Checker) nestedSite(g *goroutine) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nesting.startedIn[g.id]
+}
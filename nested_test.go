@@ -0,0 +1,58 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNestedCheckFunc(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	outer := &tbReporter{name: "TestNested"}
+	check := CheckTimeout(outer, 100*time.Millisecond)
+	// a deadline close by makes CheckFunc give up quickly
+	inner := &tbReporter{name: "TestNested/case", deadline: time.Now().Add(deadlineGrace + 100*time.Millisecond)}
+	started := make(chan struct{})
+	CheckFunc(inner, func() {
+		go blockedGoroutine(started, block)
+		<-started
+		started = make(chan struct{})
+		go warnOnlyLeak(block)
+	}, IgnoreTopFunction("github.com/fortytw2/leaktest.warnOnlyLeak"))
+	// started after the nested check, unrelated to it
+	go blockedGoroutine(started, block)
+	<-started
+	check()
+
+	if !inner.failed {
+		t.Fatal("leak not reported by the nested check")
+	}
+	if len(outer.msgs) == 0 {
+		t.Fatal("leaks outside the nested check not reported")
+	}
+	var leaks []string
+	for _, msg := range outer.msgs {
+		if strings.Contains(msg, "leaked goroutine [") {
+			leaks = append(leaks, msg)
+		}
+	}
+	if len(leaks) != 2 {
+		t.Fatalf("want 2 leaks reported by the enclosing check, got %q", leaks)
+	}
+	var fromNested int
+	for _, msg := range leaks {
+		if strings.Contains(msg, "started in the scope of the nested check at ") {
+			fromNested++
+			if !strings.Contains(msg, "nested_test.go:") || !strings.Contains(msg, "warnOnlyLeak") {
+				t.Errorf("unexpected attribution %q", msg)
+			}
+		}
+	}
+	if fromNested != 1 {
+		t.Errorf("want the ignored leak attributed to the nested check, got %q", leaks)
+	}
+}
@@ -0,0 +1,48 @@
+package leaktest
+
+import "time"
+
+// Notifier is told about the leaks found over a whole test run, see
+// WithNotifier. Package webhook has one that posts them to a URL, and
+// package sarif one that writes them as static analysis results.
+type Notifier interface {
+	Notify(r SuiteReport) error
+}
+
+// SuiteReport is the final leak report of a test run by CheckMain or
+// AutoCheckMain.
+type SuiteReport struct {
+	// Binary is the name of the test binary, such as "mypkg.test"
+	Binary string
+	// Leaks are the leaked goroutines, including those AutoCheckMain found
+	// outliving their tests
+	Leaks []Leak
+	// Tests holds, for the ID of each leak, the tests that were running
+	// when it first appeared, if that's known
+	Tests map[uint64][]string
+	// Timeline is the number of goroutines over the run
+	Timeline []Sample
+	// TestsFailed is set if the tests failed, in which case the leaks may
+	// be a consequence of the failure
+	TestsFailed bool
+}
+
+// Sample is the number of goroutines at a point of a test run, and the
+// tests running then.
+type Sample struct {
+	Time       time.Time
+	Goroutines int
+	Tests      []string
+}
+
+// WithNotifier makes CheckMain and AutoCheckMain call n with the final
+// report once the tests ran, if goroutines leaked, so that nightly soak
+// jobs can page someone without scraping logs. Leaks whose fingerprints are
+// quarantined with WithQuarantined only warn, so they're left out, which
+// leaves the new ones. An error from n is logged, and doesn't change the
+// exit code.
+func WithNotifier(n Notifier) Option {
+	return func(c *config) {
+		c.notifier = n
+	}
+}
@@ -0,0 +1,33 @@
+//go:build leaktest_off
+
+package leaktest
+
+import (
+	"testing"
+	"time"
+)
+
+// Run with go test -tags leaktest_off -run TestDisabled, as every other
+// test expects leaks to be caught.
+func TestDisabled(t *testing.T) {
+	started, block := make(chan struct{}), make(chan struct{})
+	defer close(block)
+	checker := &testReporter{}
+	check := CheckTimeout(checker, time.Second)
+	var tr Tracker
+	checkTracked := CheckTracked(checker, &tr)
+	go blockedGoroutine(started, block)
+	<-started
+	tr.Acquire("conn", "")
+	checkTracked()
+	check()
+	if checker.failed {
+		t.Errorf("leak reported with leaktest_off: %q", checker.msgs)
+	}
+	if err := Find(); err != nil {
+		t.Errorf("Find() = %v with leaktest_off", err)
+	}
+	if n := NumInteresting(); n != 0 {
+		t.Errorf("NumInteresting() = %d with leaktest_off", n)
+	}
+}
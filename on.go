@@ -0,0 +1,7 @@
+//go:build !leaktest_off
+
+package leaktest
+
+// disabled is set by the leaktest_off build tag, under which every check
+// passes without looking at anything.
+const disabled = false
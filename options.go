@@ -0,0 +1,547 @@
+package leaktest
+
+import (
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Option configures the behaviour of a single leak check.
+type Option func(*config)
+
+// config holds the settings for a single leak check, built from the default
+// values and any Options passed to a Check* function.
+type config struct {
+	// dump enables writing a full goroutine dump when leaks are found
+	dump bool
+	// dumpDir is the directory the dump is written to
+	dumpDir string
+	// dumpAll logs every interesting goroutine when leaks are found
+	dumpAll bool
+	// abort is called with a summary once leaks have been reported
+	abort func(msg string)
+	// labelScope restricts CheckFunc to goroutines started by its func
+	labelScope bool
+	// sampleInterval, if set, is how often the goroutine count is sampled
+	// during the test
+	sampleInterval time.Duration
+	// sampleWriter, if set, has every sample written to it
+	sampleWriter sampleWriter
+	// growthWindow, if set, is the window over which sustained growth of
+	// the goroutine count fails the check, see WithGrowthDetection
+	growthWindow time.Duration
+	// scrub removes volatile tokens from reported stacks
+	scrub bool
+	// singleReport reports all leaks in a single Errorf call
+	singleReport bool
+	// maxReported is the number of leaks printed in full, or 0 for all
+	maxReported int
+	// dependencyWarnings demotes leaks of ClassDependency to warnings
+	dependencyWarnings bool
+	// quarantined is the set of fingerprints reported only as warnings
+	quarantined map[string]bool
+	// warnAll reports every leak as a warning
+	warnAll bool
+	// warnPatterns reports leaks whose stack contains any of them as warnings
+	warnPatterns []string
+	// ignoreTop and ignoreAny come from LeakCheckConfiguration
+	ignoreTop []string
+	ignoreAny []string
+	// ignoreCurrent and cleanup are the goleak-style IgnoreCurrent and
+	// Cleanup options
+	ignoreCurrent map[uint64]bool
+	cleanup       func(exitCode int)
+	maxRetries    int
+	maxSleep      time.Duration
+	// profilePolling polls goroutine counts by entry function rather than
+	// full dumps, see WithProfilePolling
+	profilePolling bool
+	// exemptInit exempts the goroutines running when the first check using
+	// it started, see WithExemptInitGoroutines
+	exemptInit bool
+	// preCheckHooks run before the first snapshot of a check
+	preCheckHooks []func()
+	// logOnSuccess logs the goroutine counts when no leaks are found
+	logOnSuccess bool
+	// timeBudget, if set, is how long the checks run by CheckMain's tests may
+	// spend waiting in total, see WithTimeBudget
+	timeBudget time.Duration
+	// randomDelay, if set, is the most a check sleeps before its first
+	// snapshot, see WithRandomDelay
+	randomDelay time.Duration
+	// metrics are the runtime metrics reported when leaks are found, see
+	// WithMetrics
+	metrics []string
+	// heapProfiles writes heap profiles when leaks are found
+	heapProfiles bool
+	// handles lists the handles opened since the baseline when leaked
+	// goroutines wait on I/O, see WithHandles
+	handles bool
+	// flakeThreshold, if set, is the fraction of -count runs a leak must
+	// happen in to fail the test, see WithFlakeThreshold
+	flakeThreshold float64
+	// failFast makes AutoCheckMain abort the run at the first leak
+	failFast bool
+	// inventoryFile, if set, is where CheckMain keeps the goroutine
+	// inventory between runs, see WithInventoryFile
+	inventoryFile string
+	// stress is the number of rounds of scheduler perturbation run before
+	// each poll, see WithStress
+	stress int
+	// leakHook, if set, is called with the leaks once they're reported
+	leakHook func(test string, leaks []Leak)
+	// slog, if set, emits structured records, see WithSlog
+	slog func(level logLevel, msg string, args ...interface{})
+	// leakStates, if set, are the only states leaked goroutines are
+	// reported in, see WithLeakStates
+	leakStates map[State]bool
+	// noRetry reports leaks found by the first snapshot, see WithNoRetry
+	noRetry bool
+	// clock, if set, is what checks wait on, see WithClock
+	clock Clock
+	// strictBaseline flags baseline goroutines that got stuck, see
+	// WithStrictBaseline
+	strictBaseline bool
+	// notifier, if set, is told about the leaks found by CheckMain, see
+	// WithNotifier
+	notifier Notifier
+	// keepAlives makes the goroutines serving HTTP keep-alive connections
+	// count, see WithCloseIdleConnections
+	keepAlives bool
+	// htmlReport, if set, is where CheckMain writes its report as HTML,
+	// see WithHTMLReport
+	htmlReport string
+}
+
+// WarnOnlyEnv is the environment variable that, when set to a non-empty
+// value, puts every check in the process in warn-only mode, see WithWarnOnly.
+const WarnOnlyEnv = "LEAKTEST_WARN_ONLY"
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		warnAll: os.Getenv(WarnOnlyEnv) != "",
+	}
+	DefaultCheckConfiguration.Option()(cfg)
+	DefaultConfig().Option()(cfg)
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.exemptInit {
+		recordInitGoroutines()
+	}
+	return cfg
+}
+
+// WithDumpDir writes the complete goroutine dump (as produced by
+// runtime/pprof at debug=2) to a file in dir when leaks are found, and
+// reports the path of that file. This is handy on CI, where the log output
+// may be truncated but the file can be kept as a build artifact.
+//
+// If dir is empty, the reporter's ArtifactDir() is used when it has one, as
+// testing.T does since Go 1.26, its TempDir() otherwise, and os.TempDir()
+// failing both. Note that a testing.T's TempDir is removed when the test
+// finishes, as is its ArtifactDir unless go test runs with -artifacts, so
+// CI jobs should pass an explicit directory or that flag.
+func WithDumpDir(dir string) Option {
+	return func(c *config) {
+		c.dump = true
+		c.dumpDir = dir
+	}
+}
+
+// WithDumpAllOnFailure logs every interesting goroutine, not just the leaked
+// ones, when leaks are found. Goroutines that were already running when the
+// check started are marked as such. Knowing what the rest of the process is
+// doing is often needed to work out why a goroutine is stuck.
+func WithDumpAllOnFailure() Option {
+	return func(c *config) {
+		c.dumpAll = true
+	}
+}
+
+// WithAbort calls fn with a short summary once leaks have been reported.
+// It's meant for example binaries and smoke-test harnesses that have no
+// testing.T but still want the process to fail loudly, for example by
+// passing a func that calls os.Exit(1).
+func WithAbort(fn func(msg string)) Option {
+	return func(c *config) {
+		c.abort = fn
+	}
+}
+
+// WithPanic panics once leaks have been reported. See WithAbort.
+func WithPanic() Option {
+	return WithAbort(func(msg string) {
+		panic(msg)
+	})
+}
+
+// WithLabelScope makes CheckFunc only consider goroutines started, directly
+// or transitively, by the function it runs, so that goroutines started
+// concurrently by unrelated test infrastructure are never blamed on it. It
+// works by running the function under a pprof label, which goroutines
+// inherit from the goroutine that started them.
+//
+// The runtime only shows labels in goroutine dumps from Go 1.26 with
+// GODEBUG=tracebacklabels=1, which is the default from Go 1.27. Without
+// that, a message is logged once and every new goroutine is considered, as
+// usual. WithLabelScope has no effect on the other Check* functions.
+func WithLabelScope() Option {
+	return func(c *config) {
+		c.labelScope = true
+	}
+}
+
+// WithSampling records the number of goroutines every interval from the
+// moment the baseline is taken until the check starts. When leaks are found,
+// the report includes a small chart of the count over time and when it
+// jumped the most, which is often enough to pinpoint the operation at fault.
+func WithSampling(interval time.Duration) Option {
+	return func(c *config) {
+		c.sampleInterval = interval
+	}
+}
+
+// WithSampleCSV writes every goroutine count sample recorded by WithSampling
+// to w as CSV, with a "time,goroutines" header and RFC 3339 timestamps. This
+// makes it easy to chart the goroutine population of long integration tests
+// and spot slow leaks that never trip the end-of-test check. It has no
+// effect without WithSampling.
+func WithSampleCSV(w io.Writer) Option {
+	return func(c *config) {
+		c.sampleWriter = newCSVSampleWriter(w)
+	}
+}
+
+// WithSampleNDJSON is the same as WithSampleCSV, but writes one JSON object
+// per line, such as {"time":"2006-01-02T15:04:05Z","goroutines":12}.
+func WithSampleNDJSON(w io.Writer) Option {
+	return func(c *config) {
+		c.sampleWriter = newNDJSONSampleWriter(w)
+	}
+}
+
+// WithGrowthDetection fails the check if the number of goroutines grew
+// steadily over the last window of the test, even if none are left over
+// once it ends. It's meant for soak tests, whose slow leaks can look
+// settled to a check at the end. A line is fitted to the goroutine counts
+// sampled over the window, and growth is reported when the line rises by
+// at least one goroutine and its slope is statistically significant, which
+// needs at least 10 samples. It turns WithSampling on, every window/50, if
+// it isn't already.
+func WithGrowthDetection(window time.Duration) Option {
+	return func(c *config) {
+		c.growthWindow = window
+		if c.sampleInterval == 0 {
+			c.sampleInterval = window / 50
+		}
+	}
+}
+
+// WithLeakStates only reports leaked goroutines that are in one of states,
+// instead of DefaultLeakStates. Goroutines doing CPU-bound work in the
+// background, which are never blocked long enough to be caught waiting,
+// can be left out by leaving out StateRunning and StateRunnable:
+//
+//	leaktest.WithLeakStates(leaktest.StateChanReceive, leaktest.StateChanSend,
+//		leaktest.StateSelect, leaktest.StateMutexLock, ...)
+//
+// The check passes as soon as the goroutines left are in other states, so
+// this trades missed leaks for fewer false positives: a busy loop that
+// leaks is missed as long as it's running when polled.
+func WithLeakStates(states ...State) Option {
+	return func(c *config) {
+		c.leakStates = make(map[State]bool, len(states))
+		for _, s := range states {
+			c.leakStates[s] = true
+		}
+	}
+}
+
+// WithNoRetry makes the check take a single snapshot and report the leaks
+// in it right away, instead of waiting for them to exit. This enforces that
+// teardown is synchronous: a test that stops what it started, and waits
+// for it to stop, leaves nothing behind, while waiting for goroutines to
+// exit on their own hides sloppy teardown.
+func WithNoRetry() Option {
+	return func(c *config) {
+		c.noRetry = true
+	}
+}
+
+// WithStrictBaseline also fails the check if a goroutine that was already
+// running when the baseline was taken got stuck during the test: it wasn't
+// but now is blocked on a lock, a WaitGroup, a Cond, a nil channel or a
+// select with no cases. Such goroutines can't leak, as they predate the
+// test, but the test broke them. The check waits for them to get unstuck,
+// and reports each one with a diff of its stack before and after.
+func WithStrictBaseline() Option {
+	return func(c *config) {
+		c.strictBaseline = true
+	}
+}
+
+// WithScrubbedOutput removes the parts of reported stacks that change from
+// run to run: goroutine IDs, wait durations, pc offsets and addresses. Along
+// with the stable order leaks are reported in (by creation site, then by
+// count), this makes leak output suitable for golden-file tests.
+func WithScrubbedOutput() Option {
+	return func(c *config) {
+		c.scrub = true
+	}
+}
+
+// WithSingleReport reports all the leaks found by a check with a single call
+// to Errorf, containing a header with the number of leaks followed by their
+// stacks grouped by creation site. Some CI log viewers turn each Errorf into
+// a separate annotation, which one call per leak floods.
+func WithSingleReport() Option {
+	return func(c *config) {
+		c.singleReport = true
+	}
+}
+
+// WithMaxReported prints only the first n leaks in full, and summarizes the
+// rest by fingerprint, with how many leaks share each one. A runaway leak can
+// otherwise produce megabytes of output and hide other failures. A
+// fingerprint identifies goroutines started by the same function and stuck
+// in the same functions.
+func WithMaxReported(n int) Option {
+	return func(c *config) {
+		c.maxReported = n
+	}
+}
+
+// WithDependencyWarnings reports leaked goroutines started by other modules
+// (those of ClassDependency) as warnings, logged without failing the test,
+// as they're usually out of the test author's hands.
+func WithDependencyWarnings() Option {
+	return func(c *config) {
+		c.dependencyWarnings = true
+	}
+}
+
+// WithQuarantined reports leaks with any of the given fingerprints as
+// warnings, logged in full without failing the test. Fingerprints are shown
+// next to each reported leak. This lets leak checking be turned on while
+// known leaks are being fixed, without losing sight of them.
+func WithQuarantined(fingerprints ...string) Option {
+	return func(c *config) {
+		if c.quarantined == nil {
+			c.quarantined = map[string]bool{}
+		}
+		for _, fp := range fingerprints {
+			c.quarantined[fp] = true
+		}
+	}
+}
+
+// WithWarnOnly reports leaks as warnings, logged in full with Logf instead
+// of failing the test with Errorf, so a suite can run in an "observe" mode
+// before leak checking is enforced. With no patterns every leak is a warning,
+// otherwise only leaks whose stack contains one of the patterns are. Setting
+// the LEAKTEST_WARN_ONLY environment variable does the same as WithWarnOnly()
+// for every check.
+func WithWarnOnly(patterns ...string) Option {
+	return func(c *config) {
+		if len(patterns) == 0 {
+			c.warnAll = true
+		}
+		c.warnPatterns = append(c.warnPatterns, patterns...)
+	}
+}
+
+// WithStress perturbs the scheduler n times before each poll while waiting
+// for leaked goroutines to exit: it yields the processor in a storm of
+// runtime.Gosched calls, briefly changes GOMAXPROCS and forces a garbage
+// collection. Goroutines that only exit under certain interleavings then
+// show up as leaks far more reliably, turning flaky teardown bugs into
+// consistent failures. As GOMAXPROCS is process-wide, this also perturbs any
+// tests running in parallel.
+func WithStress(n int) Option {
+	return func(c *config) {
+		c.stress = n
+	}
+}
+
+// WithProfilePolling bounds the cost of checks in processes with tens of
+// thousands of goroutines. Rather than taking a full goroutine dump, the
+// baseline and each poll only count the goroutines by the function they
+// were started with, from the much cheaper goroutine profile, and the check
+// passes once no count is above the baseline's. A full dump is taken only
+// if the check gives up waiting, to report the newest goroutines started
+// with each function whose count grew. Checkpoint, ExpectExit, WithLabelScope
+// and warnings about the baseline have no effect in this mode.
+func WithProfilePolling() Option {
+	return func(c *config) {
+		c.profilePolling = true
+	}
+}
+
+// WithExemptInitGoroutines never reports the goroutines that were running
+// when the first check using it started, which are usually those started by
+// the init functions of imported packages. It takes no changes to TestMain,
+// unlike SetBaseline, but goroutines started by tests that ran before that
+// check are exempted too. Use it for every check with Config.WithOptions.
+func WithExemptInitGoroutines() Option {
+	return func(c *config) {
+		c.exemptInit = true
+	}
+}
+
+// WithPreCheckHooks runs hooks, in order, right before a check takes its
+// first snapshot, so that cleanups common to every test, such as
+// http.DefaultClient.CloseIdleConnections, flushing loggers or stopping
+// shared tickers, happen in one place. Set them for every check with
+// Config.WithPreCheckHooks.
+func WithPreCheckHooks(hooks ...func()) Option {
+	return func(c *config) {
+		c.preCheckHooks = append(c.preCheckHooks, hooks...)
+	}
+}
+
+// WithLogOnSuccess logs the number of goroutines before and after the test
+// when a check finds no leaks, and how long they took to settle, such as
+// "goroutines: 14 → 14 (settled after 0s)". This shows that the check ran,
+// and points out tests whose teardown takes most of the timeout even though
+// they pass. Reporters without a Logf method get it on standard error.
+func WithLogOnSuccess() Option {
+	return func(c *config) {
+		c.logOnSuccess = true
+	}
+}
+
+// WithTimeBudget limits the total time the checks in a test suite spend
+// waiting for leaked goroutines to exit to d. Once it's used up, checks fail
+// as soon as their first snapshot shows leaks, rather than each waiting for
+// its full timeout, which keeps a change that makes hundreds of tests leak
+// from also making the suite crawl. It only applies when passed to
+// CheckMain or AutoCheckMain. Checks running in parallel are each charged in
+// full for the time they spend waiting.
+func WithTimeBudget(d time.Duration) Option {
+	return func(c *config) {
+		c.timeBudget = d
+	}
+}
+
+// WithRandomDelay makes a check sleep for a random duration of up to max
+// before looking for leaked goroutines. Teardown code that only passes
+// thanks to the check happening to run late, or early, then fails some of
+// the time, all the more so when run with -count.
+func WithRandomDelay(max time.Duration) Option {
+	return func(c *config) {
+		c.randomDelay = max
+	}
+}
+
+// WithHeapProfiles takes a heap profile along with the baseline snapshot
+// and, when leaks are found, another one, and writes both to files in the
+// directory set with WithDumpDir, or the default one described there. The
+// allocations leaked goroutines pin show up in the difference between them,
+// which pprof can show, as the failure message explains. Taking the profiles
+// forces a garbage collection each time.
+func WithHeapProfiles() Option {
+	return func(c *config) {
+		c.heapProfiles = true
+	}
+}
+
+// WithHandles lists the handles the process has open along with the
+// baseline snapshot and, when leaked goroutines are waiting on I/O or in a
+// syscall, reports the ones opened since, as CheckHandles does: the
+// goroutine is then most likely blocked on one of them, such as a socket
+// that was never closed. It's only supported where CheckHandles is.
+func WithHandles() Option {
+	return func(c *config) {
+		c.handles = true
+	}
+}
+
+// WithMetrics reads the named runtime/metrics along with the baseline
+// snapshot and, when leaks are found, reports how much they changed, which
+// puts numbers on what the leaked goroutines cost. With no names, it reports
+// /sched/goroutines:goroutines, /sync/mutex/wait/total:seconds and
+// /gc/heap/objects:objects. Histograms can't be reported, nor can metrics
+// the running Go version doesn't have.
+func WithMetrics(names ...string) Option {
+	return func(c *config) {
+		if len(names) == 0 {
+			names = defaultMetrics
+		}
+		c.metrics = names
+	}
+}
+
+// WithFlakeThreshold tallies leaks across the runs of a test with -count=N,
+// rather than failing the run they happen in. After the last run the tally
+// is logged, and the test fails only for leaks that happened in more than
+// fraction of the runs, such as 0.2 for 20%, with the others logged as
+// warnings. This tells real leaks apart from noise due to scheduling. It
+// requires a reporter with a Name method, such as a testing.TB, and one
+// check per run of the test.
+func WithFlakeThreshold(fraction float64) Option {
+	return func(c *config) {
+		c.flakeThreshold = fraction
+	}
+}
+
+// WithFailFast makes CheckMain and AutoCheckMain report the first goroutine
+// found to outlive its test, then exit with status 1 right away, rather
+// than keep running the tests and report every leak at the end, which is
+// better suited to CI. Failing at the test that leaked helps bisecting, as
+// with git bisect run. CheckMain then looks for leaks while the tests run,
+// with AutoCheckMain's grace period. The Cleanup option is called with 1
+// before exiting, but the run is aborted even if it returns.
+func WithFailFast() Option {
+	return func(c *config) {
+		c.failFast = true
+	}
+}
+
+// WithInventoryFile makes CheckMain and AutoCheckMain record an inventory of
+// the goroutines running at the end of the suite in the file at path, and
+// fail if the number of goroutines of any kind grew since the inventory
+// recorded by the previous run. This catches leaks in long-lived
+// integration suites that are too slow to trip a single test's check. Keep
+// the file between runs, such as in a CI cache.
+func WithInventoryFile(path string) Option {
+	return func(c *config) {
+		c.inventoryFile = path
+	}
+}
+
+// WithHTMLReport makes CheckMain and AutoCheckMain write their report to
+// the file at path as a self-contained HTML page, once the tests ran:
+// the leaks grouped by fingerprint, with their stacks, the tests they
+// appeared during and the number of goroutines over the run. It's easier
+// to attach to a bug report than the log.
+func WithHTMLReport(path string) Option {
+	return func(c *config) {
+		c.htmlReport = path
+	}
+}
+
+// WithLeakHook calls fn with the name of the test, if the reporter has one,
+// and the leaks that failed the check, once they've been reported. It's
+// meant for passing findings on to other systems, such as the tracing of a
+// test pipeline, see package otelhook.
+func WithLeakHook(fn func(test string, leaks []Leak)) Option {
+	return func(c *config) {
+		c.leakHook = fn
+	}
+}
+
+// warnOnly reports whether a leak of g should only be a warning, according
+// to WithWarnOnly.
+func (c *config) warnOnly(g *goroutine) bool {
+	if c.warnAll {
+		return true
+	}
+	for _, p := range c.warnPatterns {
+		if strings.Contains(g.stack, p) {
+			return true
+		}
+	}
+	return false
+}
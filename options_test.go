@@ -0,0 +1,206 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithAbort(t *testing.T) {
+	var got string
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond, WithAbort(func(msg string) {
+		got = msg
+	}))
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+	snapshot()
+
+	if want := "leaktest: 1 leaked goroutine(s)"; got != want {
+		t.Errorf("abort message = %q; want %q", got, want)
+	}
+}
+
+func TestWithPanic(t *testing.T) {
+	snapshot := CheckTimeout(&testReporter{}, 100*time.Millisecond, WithPanic())
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("check didn't panic")
+		}
+	}()
+	snapshot()
+}
+
+func TestWithPanicNoLeak(t *testing.T) {
+	defer CheckTimeout(nil, time.Second, WithPanic())()
+}
+
+func TestWithWarnOnly(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := &tbReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond, WithWarnOnly())
+	go func() { <-block }()
+	snapshot()
+	if checker.failed {
+		t.Errorf("warn-only leak failed the check: %q", checker.msgs)
+	}
+	if logs := checker.checkLogs(); len(logs) != 1 {
+		t.Errorf("got %d warnings; want 1", len(logs))
+	}
+
+	checker = &tbReporter{}
+	snapshot = CheckTimeout(checker, 100*time.Millisecond, WithWarnOnly("warnOnlyLeak"))
+	go warnOnlyLeak(block)
+	go func() { <-block }()
+	snapshot()
+	if !checker.failed {
+		t.Error("leak not matching the pattern didn't fail the check")
+	}
+	if logs := checker.checkLogs(); len(logs) != 1 {
+		t.Errorf("got %d warnings; want 1", len(logs))
+	}
+
+	// without Logf, warnings go to standard error rather than Errorf
+	plain := &testReporter{}
+	snapshot = CheckTimeout(plain, 100*time.Millisecond, WithWarnOnly())
+	go func() { <-block }()
+	snapshot()
+	if plain.failed {
+		t.Errorf("warn-only leak failed a check without Logf: %q", plain.msgs)
+	}
+}
+
+func warnOnlyLeak(block chan struct{}) {
+	<-block
+}
+
+func TestWithStress(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+	checker := &tbReporter{}
+	snapshot := CheckTimeout(checker, time.Second, WithStress(3))
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(done)
+	}()
+	snapshot()
+	<-done
+	if checker.failed {
+		t.Errorf("goroutine exiting under stress reported as leaked: %q", checker.msgs)
+	}
+	if got := runtime.GOMAXPROCS(0); got != procs {
+		t.Errorf("GOMAXPROCS = %d after stress; want %d", got, procs)
+	}
+}
+
+func TestWithRandomDelay(t *testing.T) {
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, time.Second, WithRandomDelay(50*time.Millisecond))
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(done)
+	}()
+	start := time.Now()
+	snapshot()
+	<-done
+	if checker.failed {
+		t.Errorf("unexpected failure: %q", checker.msgs)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("check took %s", elapsed)
+	}
+}
+
+func TestWithLogOnSuccess(t *testing.T) {
+	checker := &tbReporter{}
+	CheckTimeout(checker, time.Second, WithLogOnSuccess())()
+	if logs := checker.checkLogs(); checker.failed || len(logs) != 1 || !strings.Contains(logs[0], "goroutines: ") || !strings.Contains(logs[0], "(settled after ") {
+		t.Errorf("failed = %t, logs = %q", checker.failed, logs)
+	}
+
+	plain := &testReporter{}
+	CheckTimeout(plain, time.Second, WithLogOnSuccess())()
+	if plain.failed {
+		t.Errorf("passing check failed without Logf: %q", plain.msgs)
+	}
+}
+
+func TestWithPreCheckHooks(t *testing.T) {
+	defer SetDefaultConfig(DefaultConfig())
+	var calls []string
+	SetDefaultConfig(NewConfig().WithPreCheckHooks(func() { calls = append(calls, "default") }))
+
+	block := make(chan struct{})
+	checker := &testReporter{}
+	// the hook stops the goroutine, so the check must pass
+	snapshot := CheckTimeout(checker, 100*time.Millisecond, WithPreCheckHooks(func() {
+		calls = append(calls, "option")
+		close(block)
+	}))
+	go func() { <-block }()
+	snapshot()
+	if checker.failed {
+		t.Errorf("goroutine stopped by a pre-check hook reported: %q", checker.msgs)
+	}
+	if strings.Join(calls, ",") != "default,option" {
+		t.Errorf("hooks called %q; want default, then option", calls)
+	}
+}
+
+func TestWithLeakStates(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan struct{})
+
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond, WithLeakStates(StateSelect, StateMutexLock))
+	go blockedGoroutine(started, block)
+	<-started
+	snapshot()
+	if checker.failed {
+		t.Errorf("goroutine receiving from a channel reported: %q", checker.msgs)
+	}
+
+	checker = &testReporter{}
+	snapshot = CheckTimeout(checker, 100*time.Millisecond, WithLeakStates(DefaultLeakStates()...))
+	started = make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+	snapshot()
+	if !checker.failed {
+		t.Error("goroutine receiving from a channel not reported with the default states")
+	}
+}
+
+func TestWithNoRetry(t *testing.T) {
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, time.Second, WithNoRetry())
+	done := make(chan struct{})
+	stop := make(chan struct{})
+	go func() {
+		<-stop
+		time.Sleep(10 * time.Millisecond)
+		close(done)
+	}()
+	start := time.Now()
+	snapshot()
+	close(stop)
+	<-done
+	if !checker.failed || !strings.Contains(strings.Join(checker.msgs, "\n"), "WithNoRetry is set") {
+		t.Errorf("goroutine exiting after the check started not reported: %q", checker.msgs)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("check took %s", elapsed)
+	}
+}
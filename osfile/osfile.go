@@ -0,0 +1,123 @@
+// Package osfile wraps the functions opening files in package os, and any
+// fs.FS, to keep track of the files that are open, so that tests can check
+// they closed every file they opened:
+//
+//	func TestConfig(t *testing.T) {
+//		defer osfile.CheckFiles(t)()
+//		f, err := osfile.Open("testdata/config.json")
+//		...
+//	}
+//
+// Unclosed files are reported with the stack they were opened at, which is
+// more precise than counting file descriptors, and works on every platform.
+package osfile
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/fortytw2/leaktest"
+)
+
+// tracker tracks the files opened through this package.
+var tracker leaktest.Tracker
+
+// errUnsupported is returned for the operations the underlying fs.File
+// doesn't implement. errors.ErrUnsupported would need Go 1.21.
+var errUnsupported = errors.New("operation not supported")
+
+// CheckFiles returns a func that reports every file opened through this
+// package since CheckFiles was called and not yet closed, waiting up to 5
+// seconds for them to be closed. Files opened by tests running in parallel
+// are reported too.
+func CheckFiles(t leaktest.ErrorReporter) func() {
+	return leaktest.CheckTracked(t, &tracker)
+}
+
+// File is an *os.File whose Close marks it as closed.
+type File struct {
+	*os.File
+	h *leaktest.Handle
+}
+
+// Close closes the file, as os.File's Close does.
+func (f *File) Close() error {
+	f.h.Release()
+	return f.File.Close()
+}
+
+// Open opens the named file for reading, as os.Open does.
+func Open(name string) (*File, error) {
+	return track(os.Open(name))
+}
+
+// Create creates or truncates the named file, as os.Create does.
+func Create(name string) (*File, error) {
+	return track(os.Create(name))
+}
+
+// OpenFile opens the named file with the given flag and permissions, as
+// os.OpenFile does.
+func OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	return track(os.OpenFile(name, flag, perm))
+}
+
+func track(f *os.File, err error) (*File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: f, h: tracker.Acquire("file "+f.Name(), "")}, nil
+}
+
+// FS returns a file system that keeps track of the files opened from fsys.
+// The files it opens have ReadDir, Seek and ReadAt methods, which return an
+// error if the file opened from fsys doesn't have them.
+func FS(fsys fs.FS) fs.FS {
+	return trackedFS{fsys}
+}
+
+type trackedFS struct {
+	fsys fs.FS
+}
+
+func (t trackedFS) Open(name string) (fs.File, error) {
+	f, err := t.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fsFile{File: f, h: tracker.Acquire("file "+name, "")}, nil
+}
+
+// fsFile is a file opened from a trackedFS.
+type fsFile struct {
+	fs.File
+	h *leaktest.Handle
+}
+
+func (f *fsFile) Close() error {
+	f.h.Release()
+	return f.File.Close()
+}
+
+func (f *fsFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d, ok := f.File.(fs.ReadDirFile); ok {
+		return d.ReadDir(n)
+	}
+	return nil, &fs.PathError{Op: "readdir", Err: errUnsupported}
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, &fs.PathError{Op: "seek", Err: errUnsupported}
+}
+
+func (f *fsFile) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := f.File.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, &fs.PathError{Op: "readat", Err: errUnsupported}
+}
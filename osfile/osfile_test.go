@@ -0,0 +1,61 @@
+//go:build !leaktest_off
+
+package osfile
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+)
+
+type reporter struct {
+	failed bool
+	msgs   []string
+}
+
+func (r *reporter) Errorf(format string, args ...interface{}) {
+	r.failed = true
+	r.msgs = append(r.msgs, fmt.Sprintf(format, args...))
+}
+
+func TestCheckFiles(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "f")
+	var r reporter
+	check := leaktest.CheckTrackedTimeout(&r, &tracker, 100*time.Millisecond)
+	f, err := Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+	check()
+	f.Close()
+
+	if len(r.msgs) != 1 || !strings.Contains(r.msgs[0], "file "+name+" was never released") || !strings.Contains(r.msgs[0], "osfile.TestCheckFiles") {
+		t.Errorf("want f reported as unclosed, got %q", r.msgs)
+	}
+}
+
+func TestFS(t *testing.T) {
+	defer CheckFiles(t)()
+	fsys := FS(fstest.MapFS{
+		"dir/a.txt": {Data: []byte("a")},
+	})
+	entries, err := fs.ReadDir(fsys, "dir")
+	if err != nil || len(entries) != 1 {
+		t.Errorf("ReadDir = %v, %v", entries, err)
+	}
+	data, err := fs.ReadFile(fsys, "dir/a.txt")
+	if err != nil || string(data) != "a" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+}
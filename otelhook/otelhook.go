@@ -0,0 +1,77 @@
+// Package otelhook turns leak findings into trace events, so that teams
+// running traced test pipelines can correlate leaks with the rest of their
+// telemetry. It doesn't depend on OpenTelemetry: Option passes each Event
+// to a func that records it, usually on the active span:
+//
+//	span := trace.SpanFromContext(ctx)
+//	defer leaktest.Check(t, otelhook.Option(func(e otelhook.Event) {
+//		span.AddEvent(e.Name, trace.WithAttributes(
+//			attribute.String("leaktest.test", e.Test),
+//			attribute.String("leaktest.fingerprint", e.Fingerprint),
+//			attribute.Int("leaktest.count", e.Count),
+//			attribute.String("leaktest.created_by", e.CreatedBy),
+//		))
+//	}))()
+package otelhook
+
+import "github.com/fortytw2/leaktest"
+
+// EventName is the name of the events recorded for leaks.
+const EventName = "goroutine leak"
+
+// Event is the leaks from the same place for the same reason found by a
+// check.
+type Event struct {
+	// Name is EventName
+	Name string
+	// Test is the name of the test, or "" if the reporter has none
+	Test string
+	// Fingerprint is shared by the leaks, see leaktest.WithQuarantined
+	Fingerprint string
+	// Count is the number of leaked goroutines with the fingerprint
+	Count int
+	// CreatedBy is the function whose go statement started the goroutines,
+	// followed by its file and line
+	CreatedBy string
+	// Class is the class of CreatedBy, such as "dependency"
+	Class string
+	// Category is the kind of leak, such as "ticker"
+	Category string
+	// Stack is the stack of the first of the goroutines
+	Stack string
+}
+
+// Events groups leaks by fingerprint into events, in the order the
+// fingerprints first appear.
+func Events(test string, leaks []leaktest.Leak) []Event {
+	var events []Event
+	index := map[string]int{}
+	for _, l := range leaks {
+		i, ok := index[l.Fingerprint]
+		if !ok {
+			i = len(events)
+			index[l.Fingerprint] = i
+			events = append(events, Event{
+				Name:        EventName,
+				Test:        test,
+				Fingerprint: l.Fingerprint,
+				CreatedBy:   l.CreatedBy,
+				Class:       l.Class.String(),
+				Category:    l.Category.String(),
+				Stack:       l.Stack,
+			})
+		}
+		events[i].Count++
+	}
+	return events
+}
+
+// Option returns a leaktest.Option that calls record with an Event for each
+// fingerprint among the leaks a check reports.
+func Option(record func(Event)) leaktest.Option {
+	return leaktest.WithLeakHook(func(test string, leaks []leaktest.Leak) {
+		for _, e := range Events(test, leaks) {
+			record(e)
+		}
+	})
+}
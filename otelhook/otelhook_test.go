@@ -0,0 +1,69 @@
+//go:build !leaktest_off
+
+package otelhook
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+)
+
+type reporter struct {
+	failed bool
+	msgs   []string
+}
+
+func (r *reporter) Errorf(format string, args ...interface{}) {
+	r.failed = true
+	r.msgs = append(r.msgs, fmt.Sprintf(format, args...))
+}
+
+func (r *reporter) Name() string { return "TestLeaky" }
+
+func leak(started, block chan struct{}) {
+	started <- struct{}{}
+	<-block
+}
+
+func TestOption(t *testing.T) {
+	var events []Event
+	var r reporter
+	check := leaktest.CheckTimeout(&r, 100*time.Millisecond, Option(func(e Event) {
+		events = append(events, e)
+	}))
+	started, block := make(chan struct{}), make(chan struct{})
+	defer close(block)
+	for i := 0; i < 2; i++ {
+		go leak(started, block)
+		<-started
+	}
+	check()
+
+	if !r.failed {
+		t.Fatal("leaks not reported")
+	}
+	if len(events) != 1 {
+		t.Fatalf("want 1 event for the 2 leaks sharing a fingerprint, got %+v", events)
+	}
+	e := events[0]
+	if e.Name != EventName || e.Test != "TestLeaky" || e.Count != 2 || e.Fingerprint == "" ||
+		!strings.Contains(e.CreatedBy, "otelhook.TestOption") || e.Class != "test-code" || e.Category != "channel-deadlock" {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	leaks := []leaktest.Leak{
+		{ID: 1, Fingerprint: "a", CreatedBy: "pkg.f"},
+		{ID: 2, Fingerprint: "b", CreatedBy: "pkg.g"},
+		{ID: 3, Fingerprint: "a", CreatedBy: "pkg.f"},
+	}
+	events := Events("TestX", leaks)
+	if len(events) != 2 || events[0].Fingerprint != "a" || events[0].Count != 2 ||
+		events[1].Fingerprint != "b" || events[1].Count != 1 {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
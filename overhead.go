@@ -0,0 +1,101 @@
+package leaktest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// slowestReported is how many of the slowest tests to settle the overhead
+// summary names.
+const slowestReported = 5
+
+// overhead tallies the time and work spent checking for leaks while
+// CheckMain runs the tests, for the summary it prints at the end.
+type overhead struct {
+	mu       sync.Mutex
+	enabled  bool
+	checks   int
+	total    time.Duration
+	polls    int
+	maxDump  int
+	settling []settled
+}
+
+// settled is a check that passed after waiting for goroutines to exit.
+type settled struct {
+	test string
+	took time.Duration
+}
+
+// suiteOverhead is the process-wide tally, enabled by CheckMain.
+var suiteOverhead overhead
+
+func (o *overhead) start() {
+	o.mu.Lock()
+	o.enabled, o.checks, o.total, o.polls, o.maxDump, o.settling = true, 0, 0, 0, 0, nil
+	o.mu.Unlock()
+}
+
+func (o *overhead) stop() {
+	o.mu.Lock()
+	o.enabled = false
+	o.mu.Unlock()
+}
+
+// poll records a goroutine dump of n bytes.
+func (o *overhead) poll(n int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.enabled {
+		return
+	}
+	o.polls++
+	if n > o.maxDump {
+		o.maxDump = n
+	}
+}
+
+// check records a check by test that spent took waiting, and whether it
+// ended with no leaks.
+func (o *overhead) check(test string, took time.Duration, passed bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.enabled {
+		return
+	}
+	o.checks++
+	o.total += took
+	if !passed || test == "" {
+		return
+	}
+	o.settling = append(o.settling, settled{test, took})
+	sort.SliceStable(o.settling, func(i, j int) bool {
+		return o.settling[i].took > o.settling[j].took
+	})
+	if len(o.settling) > slowestReported {
+		o.settling = o.settling[:slowestReported]
+	}
+}
+
+// summary describes the overhead recorded so far.
+func (o *overhead) summary() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "leaktest: %d check(s) took %s in total, with %d goroutine dump(s) of up to %d bytes",
+		o.checks, o.total.Round(time.Millisecond), o.polls, o.maxDump)
+	var slowest []string
+	for _, s := range o.settling {
+		if s.took < time.Millisecond {
+			break
+		}
+		slowest = append(slowest, fmt.Sprintf("%s (%s)", s.test, s.took.Round(time.Millisecond)))
+	}
+	if len(slowest) > 0 {
+		fmt.Fprintf(&b, "\nleaktest: slowest to settle: %s", strings.Join(slowest, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package leaktest
+
+// Pause starts a section of the test whose goroutines are left out of the
+// check, such as a chaos phase that starts and kills goroutines on purpose,
+// until Resume is called. Goroutines started before Pause and after Resume
+// are checked as usual. Pausing again before Resume has no effect.
+func (c *Checker) Pause() {
+	if disabled || c.cfg.profilePolling {
+		return
+	}
+	c.mu.Lock()
+	paused := c.paused != nil
+	c.mu.Unlock()
+	if paused {
+		return
+	}
+	ids := map[uint64]bool{}
+	for _, g := range c.snapshot() {
+		ids[g.id] = true
+	}
+	c.mu.Lock()
+	c.paused = ids
+	c.mu.Unlock()
+}
+
+// Resume ends the section started by Pause: the goroutines started since
+// Pause are never reported as leaked, even if they're still running at
+// check time. A Checker still paused when checked is resumed first.
+func (c *Checker) Resume() {
+	c.mu.Lock()
+	paused := c.paused != nil
+	c.mu.Unlock()
+	if !paused {
+		return
+	}
+	// goroutines are visible as soon as the go statement starting them
+	// returns, so all those started during the pause are in this snapshot
+	gs := c.snapshot()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.excluded == nil {
+		c.excluded = map[uint64]bool{}
+	}
+	for _, g := range gs {
+		if !c.paused[g.id] && !c.orig[g.id] {
+			c.excluded[g.id] = true
+		}
+	}
+	c.paused = nil
+}
+
+// isExcluded reports whether g was started while the Checker was paused.
+func (c *Checker) isExcluded(g *goroutine) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.excluded[g.id]
+}
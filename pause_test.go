@@ -0,0 +1,49 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPauseResume(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := &testReporter{}
+	c := NewChecker(checker)
+	c.Pause()
+	started := make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+	c.Resume()
+	c.CheckTimeout(100 * time.Millisecond)
+	if checker.failed {
+		t.Fatalf("goroutine started while paused reported: %q", checker.msgs)
+	}
+
+	started = make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+	c.CheckTimeout(100 * time.Millisecond)
+	if !checker.failed || len(checker.msgs) == 0 {
+		t.Error("goroutine started after Resume not reported")
+	}
+}
+
+func TestPausedCheck(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := &testReporter{}
+	c := NewChecker(checker)
+	c.Pause()
+	started := make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+	c.CheckTimeout(100 * time.Millisecond)
+	if checker.failed {
+		t.Errorf("goroutine started while paused reported: %q", checker.msgs)
+	}
+}
@@ -0,0 +1,15 @@
+package leaktest
+
+import "bytes"
+
+// platformIgnored reports whether stack belongs to a goroutine that the
+// runtime of the target platform starts for its own use, as listed in the
+// platform's platformIgnores.
+func platformIgnored(stack []byte) bool {
+	for _, p := range platformIgnores {
+		if bytes.Contains(stack, []byte(p)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,5 @@
+//go:build !unix && !windows && !js && !wasip1
+
+package leaktest
+
+var platformIgnores []string
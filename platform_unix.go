@@ -0,0 +1,10 @@
+//go:build unix
+
+package leaktest
+
+// platformIgnores are the goroutines the runtime starts on Unix systems.
+var platformIgnores = []string{
+	// started, and locked to its thread, by the first signal.Notify to
+	// keep the signal mask up to date
+	"runtime.ensureSigM.",
+}
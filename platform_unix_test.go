@@ -0,0 +1,30 @@
+//go:build unix
+
+package leaktest
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPlatformIgnored(t *testing.T) {
+	stack := "goroutine 6 [select, locked to thread]:\nruntime.gopark()\n\t/usr/local/go/src/runtime/proc.go:435 +0xce\nruntime.ensureSigM.func1()\n\t/usr/local/go/src/runtime/signal_unix.go:1085 +0x192\ncreated by runtime.ensureSigM in goroutine 1\n\t/usr/local/go/src/runtime/signal_unix.go:1068 +0xc8"
+	if !platformIgnored([]byte(stack)) {
+		t.Error("signal mask goroutine not ignored")
+	}
+}
+
+func TestSignalNotify(t *testing.T) {
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, time.Second)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	defer signal.Stop(c)
+	snapshot()
+	if checker.failed {
+		t.Errorf("signal.Notify's goroutines reported as leaked: %q", checker.msgs)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build js || wasip1
+
+package leaktest
+
+import "runtime"
+
+// platformIgnores are the goroutines the js/wasm runtime uses to hand
+// control back and forth with the JavaScript event loop.
+var platformIgnores = []string{
+	"runtime.handleEvent(",
+	"runtime.handleAsyncEvent(",
+}
+
+// yield lets other goroutines run before each poll. WebAssembly has a
+// single thread, so goroutines that are on their way out only get to finish
+// while the checking goroutine is parked. Without this the fast check
+// nearly always sees them, and every check waits at least one tick.
+func yield() {
+	for i := 0; i < 10; i++ {
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,29 @@
+//go:build js || wasip1
+
+package leaktest
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPlatformIgnored(t *testing.T) {
+	if !platformIgnored([]byte("goroutine 2 [waiting]:\nruntime.handleEvent()\n\t/usr/local/go/src/runtime/lock_js.go:296 +0x2")) {
+		t.Error("js event handler goroutine not ignored")
+	}
+}
+
+func TestYieldLetsGoroutinesExit(t *testing.T) {
+	checker := &testReporter{}
+	c := NewChecker(checker)
+	done := make(chan struct{})
+	go close(done)
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	res := c.wait(context.Background(), timer.C)
+	<-done
+	if len(res.leaked) != 0 {
+		t.Errorf("exiting goroutine seen by the fast check: %v", res.leaked)
+	}
+}
@@ -0,0 +1,11 @@
+package leaktest
+
+// platformIgnores are the goroutines the runtime starts on Windows.
+var platformIgnores = []string{
+	// console control events, such as Ctrl-C, are delivered on a thread
+	// started by the system, which the runtime runs as a goroutine
+	"runtime.ctrlHandler(",
+	// callbacks from threads started by the system or a DLL, as created by
+	// syscall.NewCallback, which run as goroutines for as long as they last
+	"runtime.callbackasm1(",
+}
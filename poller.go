@@ -0,0 +1,102 @@
+package leaktest
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// pollResult is a snapshot of the interesting goroutines taken by the
+// poller, along with the errors parsing it.
+type pollResult struct {
+	all []*goroutine
+	err error
+}
+
+// poller takes one goroutine dump every pollInterval, give or take some
+// jitter, and hands it to every check that's waiting for leaked goroutines
+// to exit. Dumping every goroutine's stack is costly, so with many checks
+// waiting at once, as in big suites of parallel tests, sharing the dumps
+// keeps the checks themselves from eating the CPU. The jitter keeps the
+// dumps from lining up with periodic work in the code under test.
+type poller struct {
+	mu   sync.Mutex
+	subs map[chan pollResult]bool
+	// stop and done control the polling goroutine, which only runs while
+	// there are subscribers
+	stop chan struct{}
+	done chan struct{}
+}
+
+// sharedPoller is the process-wide poller used by all checks.
+var sharedPoller = &poller{subs: map[chan pollResult]bool{}}
+
+// subscribe returns a channel receiving each snapshot the poller takes, and
+// a func to unsubscribe. Snapshots the subscriber is too slow to receive
+// are replaced by newer ones.
+func (p *poller) subscribe() (<-chan pollResult, func()) {
+	ch := make(chan pollResult, 1)
+	p.mu.Lock()
+	p.subs[ch] = true
+	if p.stop == nil {
+		p.stop = make(chan struct{})
+		p.done = make(chan struct{})
+		go p.run(p.stop, p.done, pollInterval())
+	}
+	p.mu.Unlock()
+	return ch, func() { p.unsubscribe(ch) }
+}
+
+// unsubscribe removes ch and, if it was the last subscriber, stops polling
+// and waits for the polling goroutine to exit, so that it can't be mistaken
+// for a leak.
+func (p *poller) unsubscribe(ch chan pollResult) {
+	p.mu.Lock()
+	delete(p.subs, ch)
+	var done chan struct{}
+	if len(p.subs) == 0 && p.stop != nil {
+		close(p.stop)
+		done = p.done
+		p.stop, p.done = nil, nil
+	}
+	p.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (p *poller) run(stop, done chan struct{}, interval time.Duration) {
+	defer close(done)
+	timer := time.NewTimer(jitter(interval))
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		all, err := interestingGoroutines()
+		p.mu.Lock()
+		for ch := range p.subs {
+			// each subscriber gets its own copies, as checks annotate the
+			// goroutines they look at, such as with their fingerprints
+			cp := make([]*goroutine, len(all))
+			for i, g := range all {
+				g := *g
+				cp[i] = &g
+			}
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- pollResult{all: cp, err: err}
+		}
+		p.mu.Unlock()
+		timer.Reset(jitter(interval))
+	}
+}
+
+// jitter returns d give or take up to 20%.
+func jitter(d time.Duration) time.Duration {
+	return d - d/5 + time.Duration(rand.Int63n(int64(d)*2/5+1))
+}
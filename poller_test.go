@@ -0,0 +1,35 @@
+package leaktest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollerSharesSnapshots(t *testing.T) {
+	a, unsubscribeA := sharedPoller.subscribe()
+	b, unsubscribeB := sharedPoller.subscribe()
+	for _, ch := range []<-chan pollResult{a, b} {
+		select {
+		case <-ch:
+		case <-time.After(10 * TickerInterval):
+			t.Fatal("no snapshot received")
+		}
+	}
+	unsubscribeA()
+	unsubscribeB()
+
+	sharedPoller.mu.Lock()
+	running := sharedPoller.stop != nil
+	sharedPoller.mu.Unlock()
+	if running {
+		t.Error("poller not stopped after the last unsubscribe")
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := jitter(50 * time.Millisecond); d < 40*time.Millisecond || d > 60*time.Millisecond {
+			t.Fatalf("jitter(50ms) = %s; want within 20%%", d)
+		}
+	}
+}
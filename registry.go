@@ -0,0 +1,50 @@
+package leaktest
+
+import "sync"
+
+var (
+	registryMu sync.Mutex
+	// registry holds the Checkers created by Start, by test name
+	registry = map[string]*Checker{}
+)
+
+// Start snapshots the currently-running goroutines for the test t, to be
+// checked by a later call to Finish with the same t. Unlike Check, the
+// snapshot and the check needn't share a scope, so they can live in
+// separate setup and teardown helpers. The snapshot is keyed by t.Name(),
+// so t should be a testing.TB or have a Name method, and parallel tests
+// need distinct names.
+func Start(t ErrorReporter, opts ...Option) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	c := NewChecker(t, opts...)
+	c.enter(1)
+	name := testName(t)
+	registryMu.Lock()
+	_, dup := registry[name]
+	registry[name] = c
+	registryMu.Unlock()
+	if dup {
+		c.t.Errorf("leaktest: Start called twice for %q without Finish", name)
+	}
+}
+
+// Finish checks whether any goroutines leaked since Start was called for t,
+// waiting up to 5 seconds in error conditions.
+func Finish(t ErrorReporter) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	name := testName(t)
+	registryMu.Lock()
+	c, ok := registry[name]
+	delete(registry, name)
+	registryMu.Unlock()
+	if !ok {
+		orStderr(t).Errorf("leaktest: Finish called for %q without Start", name)
+		return
+	}
+	defer c.exit()
+	c.Check()
+}
@@ -0,0 +1,39 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartFinish(t *testing.T) {
+	setup := func(t *testing.T) { Start(t) }
+	teardown := func(t *testing.T) { Finish(t) }
+
+	setup(t)
+	done := make(chan struct{})
+	go close(done)
+	<-done
+	teardown(t)
+}
+
+func TestStartFinishLeak(t *testing.T) {
+	checker := &tbReporter{name: "TestStartFinishLeak", deadline: time.Now().Add(deadlineGrace + 100*time.Millisecond)}
+	Start(checker)
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+	Finish(checker)
+	if !checker.failed {
+		t.Error("didn't catch the leaked goroutine")
+	}
+}
+
+func TestFinishWithoutStart(t *testing.T) {
+	checker := &tbReporter{name: "TestFinishWithoutStart"}
+	Finish(checker)
+	if !checker.failed {
+		t.Error("Finish without Start didn't fail")
+	}
+}
@@ -0,0 +1,375 @@
+package leaktest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// report reports the leaked goroutines found by a check, along with any
+// extra diagnostics the config asks for.
+func (c *Checker) report(res waitResult) {
+	t, cfg := c.t, c.cfg
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	// parallel tests' output is interleaved, so say which test each
+	// message is from
+	var prefix string
+	if name := testName(t); name != "" {
+		prefix = name + ": "
+	}
+	sortLeaks(res.leaked, modulePath())
+	var warned []*goroutine
+	res.leaked, warned = c.partition(res.leaked)
+	for _, g := range warned {
+		warnf(t, "%sleaktest: warning: leaked goroutine%s: %v%s%s", prefix, c.describe(g), cfg.format(g), goStatement(g.createdBy, "it"), hint(g))
+		cfg.recordLeak(levelWarn, testName(t), g, res.reason)
+	}
+	for _, g := range res.leaked {
+		cfg.recordLeak(levelError, testName(t), g, res.reason)
+	}
+	if res.clean() {
+		return
+	}
+	recordAttrs(t, res.leaked)
+	var rest []*goroutine
+	if cfg.maxReported > 0 && len(res.leaked) > cfg.maxReported {
+		res.leaked, rest = res.leaked[:cfg.maxReported], res.leaked[cfg.maxReported:]
+	}
+
+	var msgs []string
+	add := func(format string, args ...interface{}) {
+		msgs = append(msgs, prefix+fmt.Sprintf(format, args...))
+	}
+	if cfg.singleReport {
+		add("%s", c.formatReport(res, rest))
+	} else {
+		add("leaktest: %v", res.reason)
+		if res.alreadyFailed {
+			add("leaktest: the test had already failed, the leaks below may be a consequence of that failure")
+		}
+		for _, g := range res.leaked {
+			add("leaktest: leaked goroutine%s: %v%s%s", c.describe(g), cfg.format(g), goStatement(g.createdBy, "it"), hint(g))
+		}
+		if len(rest) > 0 {
+			add("leaktest: %s", summarize(rest))
+		}
+		for _, group := range groupByCreator(res.leaked) {
+			if n := c.baseCreators[group[0].createdBy]; n > 0 {
+				add("leaktest: %d leaked, %d pre-existing from %s, which may be an unbounded pool", len(group), n, group[0].createdBy)
+			}
+		}
+		for _, delta := range c.subtestDeltas(res.leaked) {
+			add("leaktest: %s", delta)
+		}
+		for _, group := range blockingGroups(res.leaked) {
+			add("leaktest: %s", group)
+		}
+		if edges := waitGraph(res.leaked); len(edges) > 0 {
+			add("leaktest: among the leaked goroutines:\n\t%s", strings.Join(edges, "\n\t"))
+		}
+		if msg := c.handlesSince(res.leaked); msg != "" {
+			add("%s", msg)
+		}
+		for _, r := range res.running {
+			add("leaktest: goroutine expected to exit is still running (matches %q): %v", r.pattern, cfg.format(r.g))
+		}
+		for _, s := range res.stuck {
+			add("leaktest: goroutine %d, already running before the test, got stuck [%s]:\n%s", s.after.id, s.after.status, lineDiff(cfg.format(s.before), cfg.format(s.after)))
+		}
+		if len(res.samples) > 0 {
+			add("leaktest: goroutines over time: %s", formatSeries(res.samples))
+		}
+	}
+	if hint := reproduceHint(t); hint != "" {
+		add("%s", hint)
+	}
+	if hint := orderingHint(t); hint != "" {
+		add("%s", hint)
+	}
+	if msg := writeDump(t, cfg); msg != "" {
+		add("%s", msg)
+	}
+	if msg := c.writeHeapProfiles(); msg != "" {
+		add("%s", msg)
+	}
+	if msg := c.metricsDelta(); msg != "" {
+		add("%s", msg)
+	}
+
+	if cfg.singleReport {
+		t.Errorf("%s", strings.Join(msgs, "\n\n"))
+	} else {
+		for _, msg := range msgs {
+			t.Errorf("%s", msg)
+		}
+	}
+	if cfg.dumpAll {
+		dumpAll(t, cfg, c.orig, res.all)
+	}
+	if cfg.leakHook != nil && len(res.leaked) > 0 {
+		all := make([]*goroutine, 0, len(res.leaked)+len(rest))
+		cfg.leakHook(testName(t), newLeaksError(append(append(all, res.leaked...), rest...)).Leaks())
+	}
+	if cfg.abort != nil {
+		msg := fmt.Sprintf("leaktest: %d leaked goroutine(s)", len(res.leaked)+len(rest))
+		if len(res.running) > 0 {
+			msg += fmt.Sprintf(", %d goroutine(s) expected to exit still running", len(res.running))
+		}
+		if len(res.stuck) > 0 {
+			msg += fmt.Sprintf(", %d goroutine(s) stuck since the baseline", len(res.stuck))
+		}
+		cfg.abort(msg)
+	}
+}
+
+// recordAttrs records the number of leaked goroutines and their distinct
+// fingerprints, comma-separated, as the test attributes leaktest.leaks and
+// leaktest.fingerprints, if the reporter records attributes.
+func recordAttrs(t ErrorReporter, leaked []*goroutine) {
+	a, ok := t.(attrer)
+	if !ok || len(leaked) == 0 {
+		return
+	}
+	var fps []string
+	seen := map[string]bool{}
+	for _, g := range leaked {
+		if fp := g.fingerprint(); !seen[fp] {
+			seen[fp] = true
+			fps = append(fps, fp)
+		}
+	}
+	a.Attr("leaktest.leaks", strconv.Itoa(len(leaked)))
+	a.Attr("leaktest.fingerprints", strings.Join(fps, ","))
+}
+
+// partition splits leaks into those that fail the check and those that are
+// only reported as warnings, keeping their order.
+func (c *Checker) partition(leaked []*goroutine) (failing, warned []*goroutine) {
+	module := modulePath()
+	for _, g := range leaked {
+		switch {
+		case c.cfg.quarantined[g.fingerprint()], c.cfg.warnOnly(g):
+			warned = append(warned, g)
+		case c.cfg.dependencyWarnings && classify(g.createdBy, module) == ClassDependency:
+			warned = append(warned, g)
+		default:
+			failing = append(failing, g)
+		}
+	}
+	return failing, warned
+}
+
+// describe returns the tags shown after "leaked goroutine" for g: its class,
+// its fingerprint, whether it's quarantined, whether it waits on I/O and, if
+// there are checkpoints, the phase of the test it appeared in or, from
+// CheckMain, the test it appeared during, the subtest run by RunSubtest it
+// was started during, and the nested check it was started in the scope of.
+func (c *Checker) describe(g *goroutine) string {
+	desc := " [" + classify(g.createdBy, modulePath()).String() + ", fingerprint " + g.fingerprint()
+	if c.cfg.quarantined[g.fingerprint()] {
+		desc += ", quarantined"
+	}
+	if waitsOnIO(g) {
+		desc += ", likely an unclosed fd or socket"
+	}
+	desc += "]"
+	if phase := c.phase(g); phase != "" {
+		desc += " (" + phase + ")"
+	}
+	if during := c.attribution(g); during != "" {
+		desc += " (" + during + ")"
+	}
+	if sub := c.subtest(g); sub != "" {
+		desc += " (started during subtest " + sub + ")"
+	}
+	if site := c.nestedSite(g); site != "" {
+		desc += " (started in the scope of the nested check at " + site + ", which didn't report it)"
+	}
+	return desc
+}
+
+// formatReport formats the leaks found by a check as a single message, with
+// a header and the leaked goroutines grouped by creation site.
+func (c *Checker) formatReport(res waitResult, rest []*goroutine) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "leaktest: %d leaked goroutine(s): %v", len(res.leaked)+len(rest), res.reason)
+	if res.alreadyFailed {
+		b.WriteString("\nthe test had already failed, the leaks below may be a consequence of that failure")
+	}
+	if len(res.samples) > 0 {
+		fmt.Fprintf(&b, "\ngoroutines over time: %s", formatSeries(res.samples))
+	}
+	for _, group := range groupByCreator(res.leaked) {
+		site := "an unknown creator"
+		if group[0].createdBy.function != "" {
+			site = group[0].createdBy.String()
+		}
+		fmt.Fprintf(&b, "\n\n%d goroutine(s) [%s] created by %s", len(group), classify(group[0].createdBy, modulePath()), site)
+		if n := c.baseCreators[group[0].createdBy]; n > 0 {
+			fmt.Fprintf(&b, ", with %d pre-existing, which may be an unbounded pool", n)
+		}
+		fmt.Fprintf(&b, ":%s", goStatement(group[0].createdBy, "them"))
+		for _, g := range group {
+			b.WriteString("\n\n")
+			if phase := c.phase(g); phase != "" {
+				fmt.Fprintf(&b, "(%s)\n", phase)
+			}
+			b.WriteString(c.cfg.format(g))
+			b.WriteString(hint(g))
+		}
+	}
+	if len(rest) > 0 {
+		fmt.Fprintf(&b, "\n\n%s", summarize(rest))
+	}
+	if deltas := c.subtestDeltas(res.leaked); len(deltas) > 0 {
+		fmt.Fprintf(&b, "\n\n%s", strings.Join(deltas, "\n"))
+	}
+	for _, group := range blockingGroups(res.leaked) {
+		fmt.Fprintf(&b, "\n\n%s", group)
+	}
+	if edges := waitGraph(res.leaked); len(edges) > 0 {
+		fmt.Fprintf(&b, "\n\namong the leaked goroutines:\n\t%s", strings.Join(edges, "\n\t"))
+	}
+	if msg := c.handlesSince(res.leaked); msg != "" {
+		fmt.Fprintf(&b, "\n\n%s", strings.TrimPrefix(msg, "leaktest: "))
+	}
+	if len(res.running) > 0 {
+		fmt.Fprintf(&b, "\n\n%d goroutine(s) expected to exit are still running:", len(res.running))
+		for _, r := range res.running {
+			fmt.Fprintf(&b, "\n\n(matches %q)\n%s", r.pattern, c.cfg.format(r.g))
+		}
+	}
+	if len(res.stuck) > 0 {
+		fmt.Fprintf(&b, "\n\n%d goroutine(s) already running before the test got stuck:", len(res.stuck))
+		for _, s := range res.stuck {
+			fmt.Fprintf(&b, "\n\n%s", lineDiff(c.cfg.format(s.before), c.cfg.format(s.after)))
+		}
+	}
+	return b.String()
+}
+
+// reproduceHint returns a command that reruns the failing test a few times,
+// for those triaging a leak seen on CI, or "" if the reporter doesn't know
+// the test's name.
+func reproduceHint(t ErrorReporter) string {
+	name := testName(t)
+	if name == "" {
+		return ""
+	}
+	pkg := testPackage()
+	if pkg == "" {
+		pkg = "."
+	}
+	return fmt.Sprintf("leaktest: to reproduce, run: go test -run '%s' -count=5 %s", runPattern(name), pkg)
+}
+
+// goStatement returns a line pointing at the go statement at createdBy,
+// which starts with a "file:line:" token that IDEs and terminals turn into a
+// link to it, or "" if its location isn't known. started is what it started.
+func goStatement(createdBy frame, started string) string {
+	if createdBy.file == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n%s:%d: the go statement that started %s", createdBy.file, createdBy.line, started)
+}
+
+// summarize describes leaks that aren't printed in full, see
+// WithMaxReported.
+func summarize(rest []*goroutine) string {
+	counts := countFingerprints(rest)
+	parts := make([]string, 0, len(counts))
+	for _, fc := range counts {
+		part := fmt.Sprintf("%d × %s", fc.n, fc.fp)
+		if fc.creator.function != "" {
+			part += " created by " + fc.creator.function
+		}
+		parts = append(parts, part)
+	}
+	return fmt.Sprintf("and %d more with the same fingerprints: %s", len(rest), strings.Join(parts, ", "))
+}
+
+// sortLeaks sorts leaked goroutines into the order they're reported in,
+// which is stable from run to run. Goroutines started by the module under
+// test come first, as those are almost always the actionable ones, followed
+// by those started by test code, dependencies and the standard library, in
+// the order of the Class constants. Within each class, leaks are sorted by
+// creation site, then by count: of the goroutines started there, those
+// sharing a stack come together, the most numerous first. Ties are broken by
+// stack and finally by ID.
+func sortLeaks(leaked []*goroutine, module string) {
+	type key struct {
+		site  frame
+		stack string
+	}
+	keys := make(map[*goroutine]key, len(leaked))
+	counts := map[key]int{}
+	for _, g := range leaked {
+		k := key{g.createdBy, scrub(g.stack)}
+		keys[g] = k
+		counts[k]++
+	}
+	sort.SliceStable(leaked, func(i, j int) bool {
+		a, b := leaked[i], leaked[j]
+		ca, cb := classify(a.createdBy, module), classify(b.createdBy, module)
+		if ca != cb {
+			return ca < cb
+		}
+		if a.createdBy != b.createdBy {
+			return a.createdBy.less(b.createdBy)
+		}
+		ka, kb := keys[a], keys[b]
+		if na, nb := counts[ka], counts[kb]; na != nb {
+			return na > nb
+		}
+		if ka.stack != kb.stack {
+			return ka.stack < kb.stack
+		}
+		return a.id < b.id
+	})
+}
+
+// format returns the stack of g as it should be reported.
+func (c *config) format(g *goroutine) string {
+	if c.scrub {
+		return scrub(g.stack)
+	}
+	return g.stack
+}
+
+var (
+	// scrubIDs matches goroutine IDs in headers and "created by" lines
+	scrubIDs = regexp.MustCompile(`(goroutine )\d+`)
+	// scrubWait matches how long a goroutine has been waiting in its header,
+	// which may be followed by "locked to thread"
+	scrubWait = regexp.MustCompile(`, \d+ minutes([,\]])`)
+	// scrubOffsets matches the program counter offsets after file:line
+	scrubOffsets = regexp.MustCompile(` \+0x[0-9a-f]+`)
+	// scrubAddrs matches the pointers and other hex values in arguments
+	scrubAddrs = regexp.MustCompile(`0x[0-9a-f]+`)
+)
+
+// scrub removes the volatile parts of a goroutine's stack, which change from
+// run to run: goroutine IDs, wait durations, pc offsets and addresses.
+func scrub(stack string) string {
+	stack = scrubIDs.ReplaceAllString(stack, "${1}N")
+	stack = scrubWait.ReplaceAllString(stack, "$1")
+	stack = scrubOffsets.ReplaceAllString(stack, "")
+	return scrubAddrs.ReplaceAllString(stack, "0x?")
+}
+
+// groupByCreator splits leaks, which must already be sorted, into groups
+// sharing a creation site.
+func groupByCreator(leaked []*goroutine) [][]*goroutine {
+	var groups [][]*goroutine
+	for i, g := range leaked {
+		if i == 0 || g.createdBy != leaked[i-1].createdBy {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], g)
+	}
+	return groups
+}
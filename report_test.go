@@ -0,0 +1,271 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScrub(t *testing.T) {
+	stack := "goroutine 21 [chan receive, 3 minutes]:\n" +
+		"main.f(0xc000012345)\n\t/tmp/main.go:9 +0x19\n" +
+		"created by main.main in goroutine 1\n\t/tmp/main.go:5 +0x1d"
+	want := "goroutine N [chan receive]:\n" +
+		"main.f(0x?)\n\t/tmp/main.go:9\n" +
+		"created by main.main in goroutine N\n\t/tmp/main.go:5"
+	if got := scrub(stack); got != want {
+		t.Errorf("scrub =\n%s\nwant\n%s", got, want)
+	}
+
+	stack = "goroutine 21 [chan receive, 5 minutes, locked to thread]:\nmain.f()\n\t/tmp/main.go:9 +0x19"
+	want = "goroutine N [chan receive, locked to thread]:\nmain.f()\n\t/tmp/main.go:9"
+	if got := scrub(stack); got != want {
+		t.Errorf("scrub =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSortLeaks(t *testing.T) {
+	leaked := []*goroutine{
+		{id: 3, stack: "b", createdBy: frame{function: "pkg.b"}},
+		{id: 2, stack: "a", createdBy: frame{function: "pkg.a", line: 20}},
+		{id: 4, stack: "a", createdBy: frame{function: "pkg.a", line: 10}},
+		{id: 1, stack: "a", createdBy: frame{function: "pkg.a", line: 10}},
+	}
+	sortLeaks(leaked, "")
+	var ids []uint64
+	for _, g := range leaked {
+		ids = append(ids, g.id)
+	}
+	if want := []uint64{1, 4, 2, 3}; !equalIDs(ids, want) {
+		t.Errorf("sorted IDs = %v; want %v", ids, want)
+	}
+
+	leaked = []*goroutine{
+		{id: 1, createdBy: frame{function: "net/http.(*Server).Serve"}},
+		{id: 2, createdBy: frame{function: "github.com/other/dep.Start"}},
+		{id: 3},
+		{id: 4, createdBy: frame{function: "example.com/mod/pkg.Start"}},
+	}
+	sortLeaks(leaked, "example.com/mod")
+	ids = ids[:0]
+	for _, g := range leaked {
+		ids = append(ids, g.id)
+	}
+	if want := []uint64{4, 2, 1, 3}; !equalIDs(ids, want) {
+		t.Errorf("sorted IDs = %v; want %v", ids, want)
+	}
+
+	// within a creation site, the stack shared by the most goroutines
+	// comes first
+	site := frame{function: "pkg.a", line: 10}
+	leaked = []*goroutine{
+		{id: 1, stack: "a", createdBy: site},
+		{id: 3, stack: "z", createdBy: site},
+		{id: 2, stack: "z", createdBy: site},
+	}
+	sortLeaks(leaked, "")
+	ids = ids[:0]
+	for _, g := range leaked {
+		ids = append(ids, g.id)
+	}
+	if want := []uint64{2, 3, 1}; !equalIDs(ids, want) {
+		t.Errorf("sorted IDs = %v; want %v", ids, want)
+	}
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWithScrubbedOutput(t *testing.T) {
+	run := func() []string {
+		// the goroutines leaked by the first run mustn't be part of the
+		// second run's baseline, which would report them as pre-existing
+		block := make(chan struct{})
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		defer close(block)
+		wg.Add(3)
+		checker := &testReporter{}
+		snapshot := CheckTimeout(checker, 100*time.Millisecond, WithScrubbedOutput())
+		for i := 0; i < 2; i++ {
+			go func() { defer wg.Done(); <-block }()
+		}
+		go func() { defer wg.Done(); <-block }()
+		snapshot()
+		return checker.msgs
+	}
+	first, second := run(), run()
+	if strings.Join(first, "\n") != strings.Join(second, "\n") {
+		t.Errorf("output differs between runs:\n%s\n\n%s", strings.Join(first, "\n"), strings.Join(second, "\n"))
+	}
+}
+
+func TestWithSingleReport(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond, WithSingleReport())
+	for i := 0; i < 2; i++ {
+		go func() { <-block }()
+	}
+	go func() { <-block }()
+	snapshot()
+
+	if len(checker.msgs) != 1 {
+		t.Fatalf("got %d messages; want 1:\n%s", len(checker.msgs), strings.Join(checker.msgs, "\n"))
+	}
+	msg := checker.msg
+	if !strings.HasPrefix(msg, "leaktest: 3 leaked goroutine(s): context deadline exceeded") {
+		t.Errorf("unexpected header in %q", msg)
+	}
+	if n := strings.Count(msg, " goroutine(s) [test-code] created by "); n != 2 {
+		t.Errorf("got %d groups; want 2:\n%s", n, msg)
+	}
+	if !strings.Contains(msg, "\n\n2 goroutine(s) [test-code] created by github.com/fortytw2/leaktest.TestWithSingleReport") {
+		t.Errorf("missing group of 2 in:\n%s", msg)
+	}
+}
+
+func TestWithDependencyWarnings(t *testing.T) {
+	leaked := []*goroutine{
+		{id: 1, createdBy: frame{function: "github.com/other/dep.Start"}},
+		{id: 2, createdBy: frame{function: "net/http.(*Server).Serve"}},
+	}
+	c := &Checker{cfg: newConfig([]Option{WithDependencyWarnings()})}
+	failing, warned := c.partition(leaked)
+	if len(failing) != 1 || failing[0].id != 2 {
+		t.Errorf("failing = %v; want goroutine 2", failing)
+	}
+	if len(warned) != 1 || warned[0].id != 1 {
+		t.Errorf("warned = %v; want goroutine 1", warned)
+	}
+
+	c = &Checker{cfg: newConfig(nil)}
+	if failing, _ := c.partition(leaked); len(failing) != 2 {
+		t.Errorf("without the option, got %d failing leaks; want 2", len(failing))
+	}
+
+	// without Logf, the warnings go to standard error rather than Errorf
+	g, err := interestingGoroutine("goroutine 7 [chan receive]:\ngithub.com/other/dep.worker()\n\t/src/dep/worker.go:10 +0x1\ncreated by github.com/other/dep.Start in goroutine 1\n\t/src/dep/worker.go:5 +0x2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := &testReporter{}
+	c = &Checker{t: checker, cfg: newConfig([]Option{WithDependencyWarnings()})}
+	c.report(waitResult{leaked: []*goroutine{g}, reason: context.DeadlineExceeded})
+	if checker.failed {
+		t.Errorf("dependency leak failed a check without Logf: %q", checker.msgs)
+	}
+}
+
+func TestGoStatementLink(t *testing.T) {
+	checker := &tbReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+	snapshot()
+
+	link := regexp.MustCompile(`(?m)^/\S+/report_test\.go:\d+: the go statement that started it$`)
+	if !link.MatchString(strings.Join(checker.msgs, "\n")) {
+		t.Errorf("no file:line link to the go statement in %q", checker.msgs)
+	}
+}
+
+func TestReproduceHint(t *testing.T) {
+	if hint := reproduceHint(&testReporter{}); hint != "" {
+		t.Errorf("got hint %q for a reporter without a name", hint)
+	}
+	want := "leaktest: to reproduce, run: go test -run '^TestFoo$/^case_1$' -count=5 github.com/fortytw2/leaktest"
+	if hint := reproduceHint(&tbReporter{name: "TestFoo/case_1"}); hint != want {
+		t.Errorf("reproduceHint = %q; want %q", hint, want)
+	}
+}
+
+func TestTestNamePrefix(t *testing.T) {
+	checker := &tbReporter{name: "TestFoo"}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+	snapshot()
+
+	if len(checker.msgs) == 0 {
+		t.Fatal("didn't catch the leaked goroutine")
+	}
+	for _, msg := range checker.msgs {
+		if !strings.HasPrefix(msg, "TestFoo: leaktest: ") {
+			t.Errorf("message not prefixed with the test name: %q", msg)
+		}
+	}
+}
+
+func TestReportPreexisting(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	startWorker := func() {
+		started := make(chan struct{})
+		go blockedGoroutine(started, block)
+		<-started
+	}
+	for i := 0; i < 2; i++ {
+		startWorker()
+	}
+
+	checker := &testReporter{}
+	check := CheckTimeout(checker, 100*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		startWorker()
+	}
+	check()
+	var found bool
+	for _, msg := range checker.msgs {
+		if strings.HasPrefix(msg, "leaktest: 3 leaked, 2 pre-existing from github.com/fortytw2/leaktest.TestReportPreexisting.func1 (") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("pre-existing goroutines not counted: %q", checker.msgs)
+	}
+
+	single := &testReporter{}
+	check = CheckTimeout(single, 100*time.Millisecond, WithSingleReport())
+	startWorker()
+	check()
+	if len(single.msgs) != 1 || !strings.Contains(single.msgs[0], ", with 5 pre-existing, which may be an unbounded pool:") {
+		t.Errorf("pre-existing goroutines not counted: %q", single.msgs)
+	}
+}
+
+func TestOrderingHint(t *testing.T) {
+	if hint := formatOrderingHint("", "TestFoo"); hint != "" {
+		t.Errorf("got hint %q without shuffling", hint)
+	}
+	for _, name := range []string{"TestOrderA", "TestOrderB/case", "TestOrderC"} {
+		noteTest(name)
+	}
+	hint := formatOrderingHint("42", "TestOrderC/sub")
+	if !strings.Contains(hint, "tests ran shuffled with seed 42") ||
+		!strings.Contains(hint, "TestOrderC was test ") || !strings.Contains(hint, "TestOrderA, TestOrderB;") ||
+		!strings.Contains(hint, "go test -shuffle=42 -count=1 github.com/fortytw2/leaktest") {
+		t.Errorf("unexpected hint %q", hint)
+	}
+	if hint := formatOrderingHint("on", "TestOrderC"); !strings.Contains(hint, "-shuffle=SEED") {
+		t.Errorf("unexpected hint %q", hint)
+	}
+}
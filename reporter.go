@@ -0,0 +1,154 @@
+package leaktest
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// The interfaces below are optional capabilities of an ErrorReporter. A
+// testing.TB implements all of them, on recent enough Go versions, so
+// passing a *testing.T or *testing.B to a Check* function enables the
+// corresponding behaviour automatically, while minimal reporters that only
+// implement Errorf keep working.
+
+// tHelper is implemented by reporters that can mark functions as test
+// helpers, such as testing.T, so leaks are reported at the caller's line.
+type tHelper interface {
+	Helper()
+}
+
+// logger is implemented by reporters that can log without failing.
+type logger interface {
+	Logf(format string, args ...interface{})
+}
+
+// cleanuper is implemented by reporters that can run a function when the
+// test finishes.
+type cleanuper interface {
+	Cleanup(func())
+}
+
+// namer is implemented by reporters that know the name of the running test.
+type namer interface {
+	Name() string
+}
+
+// deadliner is implemented by reporters that know when the test binary will
+// be killed by the -timeout flag.
+type deadliner interface {
+	Deadline() (time.Time, bool)
+}
+
+// failer is implemented by reporters that know whether the test has
+// already failed.
+type failer interface {
+	Failed() bool
+}
+
+// tempDirer is implemented by reporters that can provide a per-test
+// temporary directory.
+type tempDirer interface {
+	TempDir() string
+}
+
+// attrer is implemented by reporters that record structured attributes of
+// the test in its output, as testing.TB does since Go 1.25, for tools such
+// as test2json to pick up.
+type attrer interface {
+	Attr(key, value string)
+}
+
+// artifactDirer is implemented by reporters that provide a directory for
+// the test's output files, as testing.TB does since Go 1.26, which is kept
+// when running with -artifacts.
+type artifactDirer interface {
+	ArtifactDir() string
+}
+
+// deadlineGrace is how long before the test binary's deadline a leak check
+// gives up waiting, so that leaks are reported before the binary panics.
+const deadlineGrace = time.Second
+
+// stderrReporter reports to standard error. It's used when a Check*
+// function is given a nil ErrorReporter, as is typical outside of tests.
+type stderrReporter struct{}
+
+func (stderrReporter) Errorf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// orStderr returns t, or a reporter writing to standard error if t is nil.
+func orStderr(t ErrorReporter) ErrorReporter {
+	if t == nil {
+		return stderrReporter{}
+	}
+	return t
+}
+
+// onCleanup makes fn safe to call more than once and, if the reporter
+// supports it, registers fn to run when the test finishes. This catches the
+// easy to make mistake of writing "defer leaktest.Check(t)" without the
+// trailing call.
+func onCleanup(t ErrorReporter, fn func()) func() {
+	var once sync.Once
+	check := func() {
+		if h, ok := t.(tHelper); ok {
+			h.Helper()
+		}
+		once.Do(fn)
+	}
+	if c, ok := t.(cleanuper); ok {
+		c.Cleanup(check)
+	}
+	return check
+}
+
+// testDeadline returns a channel that fires shortly before the test
+// binary's deadline, if the reporter knows about one, and a func to release
+// the underlying timer.
+func testDeadline(t ErrorReporter) (<-chan time.Time, func()) {
+	if d, ok := t.(deadliner); ok {
+		if deadline, ok := d.Deadline(); ok {
+			timer := time.NewTimer(time.Until(deadline.Add(-deadlineGrace)))
+			return timer.C, func() { timer.Stop() }
+		}
+	}
+	return nil, func() {}
+}
+
+// testName returns the name of the running test, or "" if the reporter
+// doesn't know it.
+func testName(t ErrorReporter) string {
+	if n, ok := t.(namer); ok {
+		return n.Name()
+	}
+	return ""
+}
+
+// logf logs informational output through the reporter's Logf if it has one,
+// falling back to Errorf otherwise.
+func logf(t ErrorReporter, format string, args ...interface{}) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	if l, ok := t.(logger); ok {
+		l.Logf(format, args...)
+		return
+	}
+	t.Errorf(format, args...)
+}
+
+// warnf logs a warning through the reporter's Logf if it has one, and
+// writes it to standard error otherwise, so that it never fails the test.
+func warnf(t ErrorReporter, format string, args ...interface{}) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	if l, ok := t.(logger); ok {
+		l.Logf(format, args...)
+		return
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
@@ -0,0 +1,12 @@
+//go:build go1.26
+
+package leaktest
+
+import "testing"
+
+// testing.TB gained these on the Go versions below, which leaktest relies
+// on without requiring them.
+var (
+	_ attrer        = testing.TB(nil) // Go 1.25
+	_ artifactDirer = testing.TB(nil) // Go 1.26
+)
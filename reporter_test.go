@@ -0,0 +1,182 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tbReporter is a testReporter with the optional capabilities of a
+// testing.TB.
+type tbReporter struct {
+	testReporter
+	name     string
+	deadline time.Time
+	cleanups []func()
+	logs     []string
+}
+
+func (tr *tbReporter) Name() string { return tr.name }
+func (tr *tbReporter) Failed() bool { return tr.failed }
+func (tr *tbReporter) Cleanup(f func()) {
+	tr.cleanups = append(tr.cleanups, f)
+}
+func (tr *tbReporter) Deadline() (time.Time, bool) {
+	return tr.deadline, !tr.deadline.IsZero()
+}
+func (tr *tbReporter) Logf(format string, args ...interface{}) {
+	tr.logs = append(tr.logs, fmt.Sprintf(format, args...))
+}
+
+// checkLogs returns the logs other than warnings about a dirty baseline,
+// which the goroutines TestCheck leaks on purpose set off in every check
+// once they've been blocked for a minute, such as with -count.
+func (tr *tbReporter) checkLogs() []string {
+	var logs []string
+	for _, l := range tr.logs {
+		if !strings.Contains(l, "already running when the check started look leaked") {
+			logs = append(logs, l)
+		}
+	}
+	return logs
+}
+
+func (tr *tbReporter) runCleanups() {
+	for i := len(tr.cleanups) - 1; i >= 0; i-- {
+		tr.cleanups[i]()
+	}
+}
+
+func TestCheckRegistersCleanup(t *testing.T) {
+	checker := &tbReporter{name: "TestCleanup"}
+	// deliberately not calling the returned function
+	CheckTimeout(checker, 100*time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+
+	checker.runCleanups()
+	if !checker.failed {
+		t.Error("cleanup didn't catch blocked goroutine")
+	}
+}
+
+func TestCheckRunsOnce(t *testing.T) {
+	checker := &tbReporter{name: "TestRunsOnce"}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+
+	snapshot()
+	n := len(checker.msgs)
+	checker.runCleanups()
+	if len(checker.msgs) != n {
+		t.Errorf("check ran again from cleanup: %d messages, want %d", len(checker.msgs), n)
+	}
+}
+
+func TestCheckHonoursTestDeadline(t *testing.T) {
+	checker := &tbReporter{deadline: time.Now().Add(deadlineGrace + 100*time.Millisecond)}
+	snapshot := CheckTimeout(checker, time.Minute)
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+
+	start := time.Now()
+	snapshot()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("check took %s; want it bounded by the test deadline", elapsed)
+	}
+	if !checker.failed {
+		t.Error("didn't catch blocked goroutine")
+	}
+}
+
+func TestCheckNotesEarlierFailure(t *testing.T) {
+	checker := &tbReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond)
+	checker.Errorf("some earlier failure")
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+	snapshot()
+
+	var found bool
+	for _, msg := range checker.msgs {
+		found = found || strings.Contains(msg, "had already failed")
+	}
+	if !found {
+		t.Errorf("earlier failure not mentioned in %q", checker.msgs)
+	}
+}
+
+// modernReporter is a tbReporter with the test attributes and artifact
+// directory of recent testing.TB versions.
+type modernReporter struct {
+	tbReporter
+	attrs map[string]string
+	dir   string
+}
+
+func (mr *modernReporter) Attr(key, value string) {
+	if mr.attrs == nil {
+		mr.attrs = map[string]string{}
+	}
+	mr.attrs[key] = value
+}
+
+func (mr *modernReporter) ArtifactDir() string { return mr.dir }
+
+func TestAttrsAndArtifacts(t *testing.T) {
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(block)
+		wg.Wait()
+	}()
+	check := func(opts ...Option) *modernReporter {
+		checker := &modernReporter{tbReporter: tbReporter{name: "TestModern"}, dir: t.TempDir()}
+		snapshot := CheckTimeout(checker, 100*time.Millisecond, opts...)
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-block
+			}()
+		}
+		snapshot()
+		if !checker.failed {
+			t.Fatal("didn't catch the leaked goroutines")
+		}
+		return checker
+	}
+	dumps := func(checker *modernReporter) []string {
+		dumps, err := filepath.Glob(filepath.Join(checker.dir, "leaktest-TestModern-*.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dumps
+	}
+
+	checker := check()
+	if n := checker.attrs["leaktest.leaks"]; n != "2" {
+		t.Errorf("leaktest.leaks = %q; want 2", n)
+	}
+	if fps := checker.attrs["leaktest.fingerprints"]; fps == "" || strings.Contains(fps, ",") {
+		t.Errorf("leaktest.fingerprints = %q; want the one fingerprint", fps)
+	}
+	if d := dumps(checker); !keepArtifacts() && len(d) != 0 {
+		t.Errorf("dump written without WithDumpDir or -artifacts: %v", d)
+	}
+
+	checker = check(WithDumpDir(""))
+	if d := dumps(checker); len(d) != 1 {
+		t.Errorf("want a dump in the artifact directory, got %v", d)
+	}
+}
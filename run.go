@@ -0,0 +1,107 @@
+package leaktest
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TB is the part of *testing.T and *testing.B that Run and Isolated use,
+// Sub being the type itself, as its subtests are run with. It's spelled out
+// so that leaktest doesn't import testing, which binaries built with the
+// leaktest_off tag then only link in if they use it themselves.
+type TB[Sub any] interface {
+	ErrorReporter
+	Helper()
+	Name() string
+	Run(name string, f func(t Sub)) bool
+}
+
+// Run runs f as a subtest of t called name, like t.Run, and checks that f
+// leaks no goroutines, waiting up to 5 seconds in error conditions. It
+// reports whether f succeeded. t is a *testing.T or a *testing.B.
+//
+// The baseline is taken inside the subtest, right before f is called, and f
+// is run as with WithLabelScope, so that the goroutines of parallel sibling
+// subtests aren't blamed on f. Without goroutine labels in stack traces
+// (see WithLabelScope) parallel subtests may see each other's goroutines.
+func Run[Sub TB[Sub]](t Sub, name string, f func(t Sub), opts ...Option) bool {
+	t.Helper()
+	opts = append([]Option{WithLabelScope()}, opts...)
+	return t.Run(name, func(t Sub) {
+		t.Helper()
+		CheckFunc(t, func() { f(t) }, opts...)
+	})
+}
+
+// RunSubtest runs f as a subtest of t called name, like t.Run, noting the
+// goroutines started during it that are still running once it's done. A
+// single Checker created by the parent test can then tell, when checked,
+// which subtests left goroutines behind, without each subtest having a
+// check of its own:
+//
+//	c := leaktest.NewChecker(t)
+//	defer c.Check()
+//	for _, tc := range cases {
+//		leaktest.RunSubtest(c, t, tc.name, func(t *testing.T) { ... })
+//	}
+//
+// It's a function rather than a method of Checker as it's generic over t,
+// a *testing.T or a *testing.B, see TB. Goroutines still running when a
+// subtest is done may yet exit, so they're only reported if they're still
+// running when c is checked. Parallel subtests are only done, as far as
+// RunSubtest can tell, once they pause, so use Run for those.
+func RunSubtest[Sub TB[Sub]](c *Checker, t Sub, name string, f func(t Sub)) bool {
+	t.Helper()
+	before := map[uint64]bool{}
+	for _, g := range c.snapshot() {
+		before[g.id] = true
+	}
+	var sub string
+	ok := t.Run(name, func(t Sub) {
+		sub = t.Name()
+		f(t)
+	})
+	after := c.snapshot()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subtests == nil {
+		c.subtests = map[uint64]string{}
+	}
+	for _, g := range after {
+		if !before[g.id] && !c.orig[g.id] {
+			c.subtests[g.id] = sub
+		}
+	}
+	return ok
+}
+
+// subtest returns the subtest run by RunSubtest that g was started during,
+// or "".
+func (c *Checker) subtest(g *goroutine) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subtests[g.id]
+}
+
+// subtestDeltas describes, for each subtest run by RunSubtest that some of
+// leaked were started during, how many, in the order of the subtests' names.
+func (c *Checker) subtestDeltas(leaked []*goroutine) []string {
+	counts := map[string]int{}
+	var names []string
+	for _, g := range leaked {
+		sub := c.subtest(g)
+		if sub == "" {
+			continue
+		}
+		if counts[sub] == 0 {
+			names = append(names, sub)
+		}
+		counts[sub]++
+	}
+	sort.Strings(names)
+	deltas := make([]string, len(names))
+	for i, name := range names {
+		deltas[i] = fmt.Sprintf("subtest %s left %d goroutine(s) running", name, counts[name])
+	}
+	return deltas
+}
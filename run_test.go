@@ -0,0 +1,57 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	Run(t, "no leak", func(t *testing.T) {
+		done := make(chan struct{})
+		go close(done)
+		<-done
+	})
+
+	for _, name := range []string{"parallel a", "parallel b"} {
+		Run(t, name, func(t *testing.T) {
+			t.Parallel()
+			done := make(chan struct{})
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				close(done)
+			}()
+			<-done
+		})
+	}
+}
+
+func TestRunSubtest(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := &testReporter{}
+	c := NewChecker(checker)
+	RunSubtest(c, t, "clean", func(t *testing.T) {
+		done := make(chan struct{})
+		go close(done)
+		<-done
+	})
+	RunSubtest(c, t, "leaky", func(t *testing.T) {
+		started := make(chan struct{})
+		go blockedGoroutine(started, block)
+		<-started
+	})
+	c.CheckTimeout(100 * time.Millisecond)
+
+	msgs := strings.Join(checker.msgs, "\n")
+	if !strings.Contains(msgs, "subtest TestRunSubtest/leaky left 1 goroutine(s) running") ||
+		!strings.Contains(msgs, "(started during subtest TestRunSubtest/leaky)") {
+		t.Errorf("leak not attributed to its subtest: %q", checker.msgs)
+	}
+	if strings.Contains(msgs, "TestRunSubtest/clean") {
+		t.Errorf("subtest that didn't leak reported: %q", checker.msgs)
+	}
+}
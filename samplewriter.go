@@ -0,0 +1,58 @@
+package leaktest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// sampleWriter writes out goroutine count samples as they're taken.
+type sampleWriter interface {
+	WriteSample(s sample) error
+	Flush() error
+}
+
+type csvSampleWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVSampleWriter(w io.Writer) *csvSampleWriter {
+	return &csvSampleWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvSampleWriter) WriteSample(s sample) error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write([]string{"time", "goroutines"}); err != nil {
+			return err
+		}
+	}
+	return c.w.Write([]string{s.time.Format(time.RFC3339Nano), strconv.Itoa(s.n)})
+}
+
+func (c *csvSampleWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonSampleWriter struct {
+	enc *json.Encoder
+}
+
+func newNDJSONSampleWriter(w io.Writer) *ndjsonSampleWriter {
+	return &ndjsonSampleWriter{enc: json.NewEncoder(w)}
+}
+
+func (n *ndjsonSampleWriter) WriteSample(s sample) error {
+	return n.enc.Encode(struct {
+		Time       time.Time `json:"time"`
+		Goroutines int       `json:"goroutines"`
+	}{s.time, s.n})
+}
+
+func (n *ndjsonSampleWriter) Flush() error {
+	return nil
+}
@@ -0,0 +1,55 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithSampleCSV(t *testing.T) {
+	var buf bytes.Buffer
+	checker := &testReporter{}
+	c := NewChecker(checker, WithSampling(5*time.Millisecond), WithSampleCSV(&buf))
+	time.Sleep(30 * time.Millisecond)
+	c.CheckTimeout(time.Second)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) < 2 || lines[0] != "time,goroutines" {
+		t.Fatalf("unexpected CSV output:\n%s", buf.String())
+	}
+	fields := strings.Split(lines[1], ",")
+	if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+		t.Errorf("bad timestamp: %s", err)
+	}
+}
+
+func TestWithSampleNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	checker := &testReporter{}
+	c := NewChecker(checker, WithSampling(5*time.Millisecond), WithSampleNDJSON(&buf))
+	time.Sleep(30 * time.Millisecond)
+	c.CheckTimeout(time.Second)
+
+	dec := json.NewDecoder(&buf)
+	var n int
+	for dec.More() {
+		var v struct {
+			Time       time.Time
+			Goroutines int
+		}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Goroutines == 0 || v.Time.IsZero() {
+			t.Errorf("unexpected sample %+v", v)
+		}
+		n++
+	}
+	if n < 2 {
+		t.Errorf("got %d samples; want at least 2", n)
+	}
+}
@@ -0,0 +1,223 @@
+// Package sarif writes the leaks found by leaktest.CheckMain as a SARIF
+// log, the format code scanning dashboards such as GitHub's take static
+// analysis results in, so that leaks can be tracked like other findings:
+//
+//	func TestMain(m *testing.M) {
+//		leaktest.CheckMain(m, leaktest.WithNotifier(&sarif.Notifier{
+//			Path: "leaks.sarif",
+//			Root: "../..",
+//		}))
+//	}
+//
+// There's one result per fingerprint, located at the go statement that
+// started the leaked goroutines.
+package sarif
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fortytw2/leaktest"
+)
+
+// RuleID is the ID of the rule every result is for.
+const RuleID = "goroutine-leak"
+
+// Notifier writes leak reports to the file at Path, replacing it. It does
+// nothing if Path is empty.
+type Notifier struct {
+	Path string
+	// Root, if set, is the directory file locations are made relative to,
+	// usually the root of the repository, as code scanning expects.
+	// Otherwise they're absolute file URIs.
+	Root string
+}
+
+// Notify writes the log for r to n.Path.
+func (n *Notifier) Notify(r leaktest.SuiteReport) error {
+	if n.Path == "" {
+		return nil
+	}
+	root := n.Root
+	if root != "" {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		root = abs
+	}
+	b, err := json.MarshalIndent(NewLog(r, root), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(n.Path, b, 0o644)
+}
+
+// Log is a SARIF 2.1.0 log, with only the properties used here.
+type Log struct {
+	Schema  string `json:"$schema"`
+	Version string `json:"version"`
+	Runs    []Run  `json:"runs"`
+}
+
+// Run, Tool, Driver, Rule, Message, Result, Location, PhysicalLocation,
+// ArtifactLocation and Region are the SARIF objects of the same names.
+type Run struct {
+	Tool    Tool     `json:"tool"`
+	Results []Result `json:"results"`
+}
+
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+type Driver struct {
+	Name           string `json:"name"`
+	InformationURI string `json:"informationUri"`
+	Rules          []Rule `json:"rules"`
+}
+
+type Rule struct {
+	ID               string  `json:"id"`
+	ShortDescription Message `json:"shortDescription"`
+	FullDescription  Message `json:"fullDescription"`
+}
+
+type Message struct {
+	Text string `json:"text"`
+}
+
+type Result struct {
+	RuleID    string     `json:"ruleId"`
+	Level     string     `json:"level"`
+	Message   Message    `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	// PartialFingerprints hold the leak's fingerprint, which tells code
+	// scanning which results of different runs are the same finding
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+	Properties          Properties        `json:"properties"`
+}
+
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           Region           `json:"region"`
+}
+
+type ArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type Region struct {
+	StartLine int `json:"startLine"`
+}
+
+// Properties are the details of a result that SARIF has no property for.
+type Properties struct {
+	Count    int      `json:"count"`
+	Class    string   `json:"class"`
+	Category string   `json:"category"`
+	Tests    []string `json:"tests,omitempty"`
+	Stack    string   `json:"stack"`
+}
+
+// NewLog builds the log for r, with file locations relative to root, or
+// absolute file URIs if root is empty.
+func NewLog(r leaktest.SuiteReport, root string) Log {
+	run := Run{
+		Tool: Tool{Driver: Driver{
+			Name:           "leaktest",
+			InformationURI: "https://github.com/fortytw2/leaktest",
+			Rules: []Rule{{
+				ID:               RuleID,
+				ShortDescription: Message{Text: "Leaked goroutine"},
+				FullDescription:  Message{Text: "A goroutine started by the tests, or the code they run, was still running once they were done."},
+			}},
+		}},
+		Results: []Result{},
+	}
+	index := map[string]int{}
+	var createdBy []string
+	for _, l := range r.Leaks {
+		i, ok := index[l.Fingerprint]
+		if !ok {
+			i = len(run.Results)
+			index[l.Fingerprint] = i
+			res := Result{
+				RuleID:              RuleID,
+				Level:               "error",
+				PartialFingerprints: map[string]string{"leaktest/v1": l.Fingerprint},
+				Properties: Properties{
+					Class:    l.Class.String(),
+					Category: l.Category.String(),
+					Stack:    l.Stack,
+				},
+			}
+			if l.File != "" {
+				res.Locations = []Location{{PhysicalLocation: PhysicalLocation{
+					ArtifactLocation: ArtifactLocation{URI: uri(l.File, root)},
+					Region:           Region{StartLine: l.Line},
+				}}}
+			}
+			run.Results = append(run.Results, res)
+			createdBy = append(createdBy, l.CreatedBy)
+		}
+		p := &run.Results[i].Properties
+		p.Count++
+		p.Tests = appendNew(p.Tests, r.Tests[l.ID]...)
+	}
+	for i := range run.Results {
+		run.Results[i].Message.Text = message(r.Binary, createdBy[i], run.Results[i].Properties)
+	}
+	return Log{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []Run{run},
+	}
+}
+
+// message describes the leaks of a result.
+func message(binary, createdBy string, p Properties) string {
+	msg := fmt.Sprintf("%d goroutine(s) leaked by %s", p.Count, binary)
+	if createdBy != "" {
+		msg += ", started by " + createdBy
+	}
+	if len(p.Tests) > 0 {
+		msg += ", during " + strings.Join(p.Tests, ", ")
+	}
+	if p.Category != leaktest.CategoryUnknown.String() {
+		msg += " (" + p.Category + ")"
+	}
+	return msg
+}
+
+// uri returns the URI of file relative to root if it's inside it, or its
+// absolute file URI.
+func uri(file, root string) string {
+	if root != "" {
+		if rel, err := filepath.Rel(root, file); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return "file://" + filepath.ToSlash(file)
+}
+
+// appendNew appends the elements of vs that aren't in s yet.
+func appendNew(s []string, vs ...string) []string {
+outer:
+	for _, v := range vs {
+		for _, have := range s {
+			if have == v {
+				continue outer
+			}
+		}
+		s = append(s, v)
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+package sarif
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fortytw2/leaktest"
+)
+
+func TestNotify(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "leaks.sarif")
+	n := &Notifier{Path: path, Root: root}
+	err := n.Notify(leaktest.SuiteReport{
+		Binary: "pkg.test",
+		Leaks: []leaktest.Leak{
+			{ID: 7, Fingerprint: "a", CreatedBy: "pkg.f", File: filepath.Join(root, "pkg", "f.go"), Line: 12, Category: leaktest.CategoryTicker},
+			{ID: 8, Fingerprint: "a", CreatedBy: "pkg.f", File: filepath.Join(root, "pkg", "f.go"), Line: 12, Category: leaktest.CategoryTicker},
+			{ID: 9, Fingerprint: "b", File: "/elsewhere/g.go", Line: 3},
+			{ID: 10, Fingerprint: "c"},
+		},
+		Tests: map[uint64][]string{7: {"TestA"}, 8: {"TestA", "TestB"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log Log
+	if err := json.Unmarshal(b, &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || log.Runs[0].Tool.Driver.Rules[0].ID != RuleID {
+		t.Fatalf("unexpected log %s", b)
+	}
+	res := log.Runs[0].Results
+	if len(res) != 3 {
+		t.Fatalf("want 3 results, one per fingerprint, got %d", len(res))
+	}
+	if res[0].Properties.Count != 2 || res[0].PartialFingerprints["leaktest/v1"] != "a" {
+		t.Errorf("unexpected result %+v", res[0])
+	}
+	if want := "2 goroutine(s) leaked by pkg.test, started by pkg.f, during TestA, TestB (ticker)"; res[0].Message.Text != want {
+		t.Errorf("message = %q; want %q", res[0].Message.Text, want)
+	}
+	if loc := res[0].Locations[0].PhysicalLocation; loc.ArtifactLocation.URI != "pkg/f.go" || loc.Region.StartLine != 12 {
+		t.Errorf("location = %+v; want pkg/f.go:12", loc)
+	}
+	if uri := res[1].Locations[0].PhysicalLocation.ArtifactLocation.URI; uri != "file:///elsewhere/g.go" {
+		t.Errorf("location outside the root = %q", uri)
+	}
+	if len(res[2].Locations) != 0 {
+		t.Errorf("leak without a location has %+v", res[2].Locations)
+	}
+}
+
+func TestNotifyWithoutPath(t *testing.T) {
+	if err := (&Notifier{}).Notify(leaktest.SuiteReport{}); err != nil {
+		t.Errorf("Notify without a Path = %v", err)
+	}
+}
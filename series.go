@@ -0,0 +1,209 @@
+package leaktest
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sample is the number of goroutines at a point in time, relative to when
+// sampling started.
+type sample struct {
+	at   time.Duration
+	time time.Time
+	n    int
+}
+
+// sampler records runtime.NumGoroutine at a fixed interval in the background,
+// which is cheap enough to do throughout a test.
+type sampler struct {
+	stop chan struct{}
+	done chan struct{}
+	// w, if set, has every sample written to it as it's taken
+	w sampleWriter
+
+	mu      sync.Mutex
+	samples []sample
+	err     error
+}
+
+func startSampler(interval time.Duration, w sampleWriter) *sampler {
+	s := &sampler{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+		w:    w,
+	}
+	start := time.Now()
+	s.record(sample{time: start, n: runtime.NumGoroutine()})
+	go s.run(start, interval)
+	return s
+}
+
+// record adds a sample and writes it out, if there is a sampleWriter.
+func (s *sampler) record(smp sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples = append(s.samples, smp)
+	if s.w != nil && s.err == nil {
+		s.err = s.w.WriteSample(smp)
+	}
+}
+
+func (s *sampler) run(start time.Time, interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.record(sample{at: now.Sub(start), time: now, n: runtime.NumGoroutine()})
+		}
+	}
+}
+
+// Stop stops sampling, waiting for the sampling goroutine to exit so that it
+// can't be mistaken for a leak, and returns the samples recorded along with
+// the first error writing them out. It's safe to call more than once.
+func (s *sampler) Stop() ([]sample, error) {
+	s.mu.Lock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w != nil && s.err == nil {
+		s.err = s.w.Flush()
+	}
+	return s.samples, s.err
+}
+
+// sparkBlocks are the characters used to draw sparklines, lowest first.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// maxSparkWidth is the maximum number of characters in a sparkline.
+const maxSparkWidth = 40
+
+// formatSeries summarizes samples as a sparkline, the first and last counts
+// and the biggest jump between two consecutive samples, such as
+//
+//	▁▁▁▅▅▅▅▅ 4 → 9 (biggest jump +5 at 1.2s)
+func formatSeries(samples []sample) string {
+	if len(samples) == 0 {
+		return ""
+	}
+	min, max := samples[0].n, samples[0].n
+	jump, jumpAt := 0, time.Duration(0)
+	for i, s := range samples {
+		if s.n < min {
+			min = s.n
+		}
+		if s.n > max {
+			max = s.n
+		}
+		if i > 0 && s.n-samples[i-1].n > jump {
+			jump, jumpAt = s.n-samples[i-1].n, s.at
+		}
+	}
+
+	// downsample to at most maxSparkWidth buckets, keeping each bucket's
+	// highest count so that short spikes stay visible
+	width := len(samples)
+	if width > maxSparkWidth {
+		width = maxSparkWidth
+	}
+	var b strings.Builder
+	for i := 0; i < width; i++ {
+		lo, hi := i*len(samples)/width, (i+1)*len(samples)/width
+		n := samples[lo].n
+		for _, s := range samples[lo:hi] {
+			if s.n > n {
+				n = s.n
+			}
+		}
+		level := 0
+		if max > min {
+			level = (n - min) * (len(sparkBlocks) - 1) / (max - min)
+		}
+		b.WriteRune(sparkBlocks[level])
+	}
+
+	fmt.Fprintf(&b, " %d → %d", samples[0].n, samples[len(samples)-1].n)
+	if jump > 0 {
+		fmt.Fprintf(&b, " (biggest jump +%d at %s)", jump, jumpAt.Round(time.Millisecond))
+	}
+	return b.String()
+}
+
+// minTrendSamples is the fewest samples a trend is fitted to.
+const minTrendSamples = 10
+
+// significantT is the t-statistic above which the slope of a trend is
+// considered significant, which for 10 samples or more is p < 0.01.
+const significantT = 3.4
+
+// sustainedGrowth fits a line to the samples taken over the last window,
+// and describes the growth if it's significant and amounts to at least one
+// goroutine over the window, or returns "" otherwise.
+func sustainedGrowth(samples []sample, window time.Duration) string {
+	if len(samples) == 0 {
+		return ""
+	}
+	from := samples[len(samples)-1].at - window
+	i := len(samples)
+	for i > 0 && samples[i-1].at >= from {
+		i--
+	}
+	samples = samples[i:]
+	slope, t := trend(samples)
+	if len(samples) < minTrendSamples || slope <= 0 || t < significantT || slope*window.Seconds() < 1 {
+		return ""
+	}
+	return fmt.Sprintf("goroutines grew steadily over the last %s, by %.2f a second (t = %.1f): %s",
+		window, slope, t, formatSeries(samples))
+}
+
+// trend returns the slope, in goroutines per second, of the least-squares
+// line through samples, and its t-statistic, which is infinite if the
+// samples lie exactly on a rising line.
+func trend(samples []sample) (slope, t float64) {
+	n := float64(len(samples))
+	if n < 3 {
+		return 0, 0
+	}
+	var mx, my float64
+	for _, s := range samples {
+		mx += s.at.Seconds()
+		my += float64(s.n)
+	}
+	mx, my = mx/n, my/n
+	var sxx, sxy float64
+	for _, s := range samples {
+		dx := s.at.Seconds() - mx
+		sxx += dx * dx
+		sxy += dx * (float64(s.n) - my)
+	}
+	if sxx == 0 {
+		return 0, 0
+	}
+	slope = sxy / sxx
+	var rss float64
+	for _, s := range samples {
+		r := float64(s.n) - my - slope*(s.at.Seconds()-mx)
+		rss += r * r
+	}
+	se := math.Sqrt(rss / (n - 2) / sxx)
+	if se == 0 {
+		return slope, math.Copysign(math.Inf(1), slope)
+	}
+	return slope, slope / se
+}
@@ -0,0 +1,115 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFormatSeries(t *testing.T) {
+	samples := []sample{
+		{at: 0, n: 4},
+		{at: 100 * time.Millisecond, n: 4},
+		{at: 200 * time.Millisecond, n: 9},
+		{at: 300 * time.Millisecond, n: 10},
+	}
+	want := "▁▁▆█ 4 → 10 (biggest jump +5 at 200ms)"
+	if got := formatSeries(samples); got != want {
+		t.Errorf("formatSeries = %q; want %q", got, want)
+	}
+
+	var many []sample
+	for i := 0; i < 1000; i++ {
+		many = append(many, sample{at: time.Duration(i) * time.Millisecond, n: 3})
+	}
+	got := formatSeries(many)
+	if want := strings.Repeat("▁", maxSparkWidth) + " 3 → 3"; got != want {
+		t.Errorf("formatSeries = %q; want %q", got, want)
+	}
+}
+
+func TestWithSampling(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := &testReporter{}
+	c := NewChecker(checker, WithSampling(5*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		go func() { <-block }()
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.CheckTimeout(100 * time.Millisecond)
+
+	var series string
+	for _, msg := range checker.msgs {
+		if strings.HasPrefix(msg, "leaktest: goroutines over time: ") {
+			series = msg
+		}
+	}
+	if !strings.Contains(series, "biggest jump +") {
+		t.Errorf("series = %q; want a jump", series)
+	}
+	if n := strings.Count(strings.Join(checker.msgs, "\n"), "leaked goroutine"); n != 3 {
+		t.Errorf("got %d leaked goroutines; want 3, the sampler mustn't be reported", n)
+	}
+}
+
+func TestSustainedGrowth(t *testing.T) {
+	series := func(n func(i int) int) []sample {
+		var samples []sample
+		for i := 0; i < 40; i++ {
+			samples = append(samples, sample{at: time.Duration(i) * 100 * time.Millisecond, n: n(i)})
+		}
+		return samples
+	}
+	tests := []struct {
+		name    string
+		samples []sample
+		grows   bool
+	}{
+		{"flat", series(func(i int) int { return 5 }), false},
+		{"steady", series(func(i int) int { return 5 + i/4 }), true},
+		{"noisy", series(func(i int) int { return 5 + i%3 }), false},
+		{"settled", series(func(i int) int {
+			if i < 20 {
+				return 5 + i
+			}
+			return 25
+		}), false},
+		{"too few", series(func(i int) int { return i })[:5], false},
+	}
+	for _, tt := range tests {
+		msg := sustainedGrowth(tt.samples, 2*time.Second)
+		if grows := msg != ""; grows != tt.grows {
+			t.Errorf("%s: sustainedGrowth = %q; want growth %t", tt.name, msg, tt.grows)
+		}
+	}
+}
+
+func TestWithGrowthDetection(t *testing.T) {
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	// let the goroutines exit before the next test takes its baseline
+	defer wg.Wait()
+	defer close(block)
+	checker := &testReporter{}
+	check := CheckTimeout(checker, 50*time.Millisecond, WithGrowthDetection(200*time.Millisecond))
+	for i := 0; i < 30; i++ {
+		started := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blockedGoroutine(started, block)
+		}()
+		<-started
+		time.Sleep(10 * time.Millisecond)
+	}
+	check()
+	if !strings.Contains(strings.Join(checker.msgs, "\n"), "goroutines grew steadily over the last 200ms") {
+		t.Errorf("growth not reported: %q", checker.msgs)
+	}
+}
@@ -0,0 +1,93 @@
+package leaktest
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	orderMu sync.Mutex
+	// testOrder are the top-level tests checks were created for, in the
+	// order they first were
+	testOrder []string
+	testSeen  = map[string]bool{}
+)
+
+// noteTest records that a check was created for the test called name, for
+// orderingHint.
+func noteTest(name string) {
+	if name == "" {
+		return
+	}
+	top, _, _ := strings.Cut(name, "/")
+	orderMu.Lock()
+	defer orderMu.Unlock()
+	if !testSeen[top] {
+		testSeen[top] = true
+		testOrder = append(testOrder, top)
+	}
+}
+
+// shuffleSeed returns the value of the -test.shuffle flag, which is the
+// seed or "on", or "" if tests aren't shuffled.
+func shuffleSeed() string {
+	f := flag.Lookup("test.shuffle")
+	if f == nil {
+		return ""
+	}
+	if v := f.Value.String(); v != "off" {
+		return v
+	}
+	return ""
+}
+
+// orderingHint returns, when tests run shuffled, the seed and where the
+// failing test ran among those checked, as leaks often depend on the order
+// tests run in, along with a command that replays that order. Otherwise it
+// returns "".
+func orderingHint(t ErrorReporter) string {
+	return formatOrderingHint(shuffleSeed(), testName(t))
+}
+
+func formatOrderingHint(seed, name string) string {
+	if seed == "" || name == "" {
+		return ""
+	}
+	top, _, _ := strings.Cut(name, "/")
+	orderMu.Lock()
+	var before []string
+	for _, test := range testOrder {
+		if test == top {
+			break
+		}
+		before = append(before, test)
+	}
+	orderMu.Unlock()
+
+	pkg := testPackage()
+	if pkg == "" {
+		pkg = "."
+	}
+	var b strings.Builder
+	b.WriteString("leaktest: tests ran shuffled")
+	if seed != "on" {
+		fmt.Fprintf(&b, " with seed %s", seed)
+	}
+	fmt.Fprintf(&b, ", and leaks often depend on the order tests run in: %s was test %d of those checked", top, len(before)+1)
+	if len(before) > 0 {
+		const shown = 3
+		if len(before) > shown {
+			fmt.Fprintf(&b, ", after ..., %s", strings.Join(before[len(before)-shown:], ", "))
+		} else {
+			fmt.Fprintf(&b, ", after %s", strings.Join(before, ", "))
+		}
+	}
+	if seed == "on" {
+		fmt.Fprintf(&b, "; to replay the order, run: go test -shuffle=SEED -count=1 %s, with the SEED go test printed as -test.shuffle at the start of the run", pkg)
+	} else {
+		fmt.Fprintf(&b, "; to replay the order, run: go test -shuffle=%s -count=1 %s", seed, pkg)
+	}
+	return b.String()
+}
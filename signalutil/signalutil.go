@@ -0,0 +1,70 @@
+// Package signalutil wraps signal.Notify and signal.Stop to keep track of
+// the channels signals are relayed to, so that tests can check they stopped
+// relaying signals to every channel they registered:
+//
+//	func TestServe(t *testing.T) {
+//		defer signalutil.CheckSignals(t)()
+//		...
+//	}
+//
+// The goroutine relaying signals is started by the runtime and ignored by
+// Check, so channels left registered are otherwise never reported.
+package signalutil
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/fortytw2/leaktest"
+)
+
+var (
+	// tracker tracks the channels registered through this package.
+	tracker leaktest.Tracker
+
+	mu         sync.Mutex
+	registered = map[chan<- os.Signal]*leaktest.Handle{}
+)
+
+// CheckSignals returns a func that reports every channel registered
+// through this package since CheckSignals was called that signals are still
+// relayed to, waiting up to 5 seconds for them to be stopped. Channels
+// registered by tests running in parallel are reported too.
+func CheckSignals(t leaktest.ErrorReporter) func() {
+	return leaktest.CheckTracked(t, &tracker)
+}
+
+// Notify relays the given signals to c, as signal.Notify does.
+func Notify(c chan<- os.Signal, sig ...os.Signal) {
+	mu.Lock()
+	if registered[c] == nil {
+		registered[c] = tracker.Acquire("signal.Notify channel", "")
+	}
+	mu.Unlock()
+	signal.Notify(c, sig...)
+}
+
+// Stop stops relaying signals to c, as signal.Stop does.
+func Stop(c chan<- os.Signal) {
+	signal.Stop(c)
+	mu.Lock()
+	if h := registered[c]; h != nil {
+		h.Release()
+		delete(registered, c)
+	}
+	mu.Unlock()
+}
+
+// NotifyContext returns a copy of ctx that's canceled when one of the given
+// signals arrives, as signal.NotifyContext does. Signals stop being relayed
+// once stop is called.
+func NotifyContext(ctx context.Context, sig ...os.Signal) (context.Context, context.CancelFunc) {
+	h := tracker.Acquire("signal.NotifyContext context", "")
+	ctx, stop := signal.NotifyContext(ctx, sig...)
+	return ctx, func() {
+		h.Release()
+		stop()
+	}
+}
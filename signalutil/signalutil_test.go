@@ -0,0 +1,43 @@
+//go:build !leaktest_off
+
+package signalutil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+)
+
+type reporter struct {
+	failed bool
+	msgs   []string
+}
+
+func (r *reporter) Errorf(format string, args ...interface{}) {
+	r.failed = true
+	r.msgs = append(r.msgs, fmt.Sprintf(format, args...))
+}
+
+func TestCheckSignals(t *testing.T) {
+	var r reporter
+	check := leaktest.CheckTrackedTimeout(&r, &tracker, 100*time.Millisecond)
+	leaked := make(chan os.Signal, 1)
+	Notify(leaked, os.Interrupt)
+	Notify(leaked, os.Kill)
+	stopped := make(chan os.Signal, 1)
+	Notify(stopped, os.Interrupt)
+	Stop(stopped)
+	_, stop := NotifyContext(context.Background(), os.Interrupt)
+	stop()
+	check()
+	Stop(leaked)
+
+	if len(r.msgs) != 1 || !strings.Contains(r.msgs[0], "signal.Notify channel was never released") || !strings.Contains(r.msgs[0], "signalutil.TestCheckSignals") {
+		t.Errorf("want the leaked channel reported once, got %q", r.msgs)
+	}
+}
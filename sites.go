@@ -0,0 +1,136 @@
+package leaktest
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// siteCounts counts the goroutines by the function they were started with,
+// such as "example.com/mod.worker", from the goroutine profile. That's much
+// cheaper to take than a full dump, as no stack is formatted, see
+// WithProfilePolling.
+func siteCounts() map[string]int {
+	var records []runtime.StackRecord
+	for {
+		n, ok := runtime.GoroutineProfile(records)
+		if ok {
+			records = records[:n]
+			break
+		}
+		// leave room for goroutines started in the meantime
+		records = make([]runtime.StackRecord, n+n/10+10)
+	}
+	counts := map[string]int{}
+	for _, r := range records {
+		counts[entryFunction(r.Stack())]++
+	}
+	return counts
+}
+
+// entryFunction returns the name of the outermost function of a stack,
+// which is the function the goroutine was started with, or "" if it isn't
+// known.
+func entryFunction(stack []uintptr) string {
+	for i := len(stack) - 1; i >= 0; i-- {
+		fn := runtime.FuncForPC(stack[i] - 1)
+		if fn == nil || fn.Name() == "runtime.goexit" {
+			continue
+		}
+		return fn.Name()
+	}
+	return ""
+}
+
+// grown returns how many more goroutines were started with each function
+// in now than in base, leaving out those with no more.
+func grown(base, now map[string]int) map[string]int {
+	growth := map[string]int{}
+	for fn, n := range now {
+		if n > base[fn] {
+			growth[fn] = n - base[fn]
+		}
+	}
+	return growth
+}
+
+// waitSites is wait for WithProfilePolling: it polls the goroutine counts by
+// entry function until none is above the baseline's, and only takes a full
+// dump when one is, to tell whether the goroutines behind the growth are
+// ones the check reports, and which.
+func (c *Checker) waitSites(ctx context.Context, timeout <-chan time.Time) waitResult {
+	var res waitResult
+	poll := func() bool {
+		yield()
+		growth := grown(c.baseSites, siteCounts())
+		if len(growth) == 0 {
+			res.all, res.leaked = nil, nil
+			return true
+		}
+		all, err := interestingGoroutines()
+		res.errs = unjoin(err)
+		res.all = all
+		res.leaked = c.siteLeaks(all, growth)
+		return len(res.leaked) == 0
+	}
+	if poll() {
+		return res
+	}
+	if c.cfg.noRetry {
+		res.reason = errNoRetry
+		return res
+	}
+	deadline, stop := testDeadline(c.t)
+	defer stop()
+	exhausted, charge, ok := waitBudget.start()
+	defer charge()
+	if !ok {
+		res.reason = errBudget
+		return res
+	}
+	for {
+		tick, stopTick := c.cfg.timer(pollInterval())
+		select {
+		case <-tick:
+			if poll() {
+				return res
+			}
+			continue
+		case <-ctx.Done():
+			res.reason = ctx.Err()
+		case <-timeout:
+			res.reason = context.DeadlineExceeded
+		case <-deadline:
+			res.reason = errDeadline
+		case <-exhausted:
+			res.reason = errBudget
+		}
+		stopTick()
+		if poll() {
+			res.reason = nil
+		}
+		return res
+	}
+}
+
+// siteLeaks picks out the goroutines to report from all, given how many more
+// goroutines were started with each function than at the baseline: the
+// newest ones started with that function, as goroutine IDs increase, that
+// the check would report.
+func (c *Checker) siteLeaks(all []*goroutine, growth map[string]int) []*goroutine {
+	var leaked []*goroutine
+	for i := len(all) - 1; i >= 0; i-- {
+		g := all[i]
+		fns := stackFunctions(g.stack)
+		if len(fns) == 0 || !c.reportable(g) {
+			continue
+		}
+		if fn := fns[len(fns)-1]; growth[fn] > 0 {
+			growth[fn]--
+			leaked = append(leaked, g)
+		}
+	}
+	sort.Sort(goroutineByID(leaked))
+	return leaked
+}
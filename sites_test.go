@@ -0,0 +1,117 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithProfilePolling(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	running := make(chan struct{})
+	go blockedGoroutine(running, block)
+	<-running
+
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, 100*time.Millisecond, WithProfilePolling())
+	started := make(chan struct{})
+	go blockedGoroutine(started, block)
+	<-started
+	exited := make(chan struct{})
+	go func() { close(exited) }()
+	<-exited
+	snapshot()
+
+	var leaks int
+	for _, msg := range checker.msgs {
+		if strings.Contains(msg, "leaktest.blockedGoroutine") {
+			leaks++
+		}
+	}
+	if leaks != 1 {
+		t.Errorf("want the blocked goroutine started during the test reported alone, got %q", checker.msgs)
+	}
+}
+
+func TestWithProfilePollingNoLeak(t *testing.T) {
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, time.Second, WithProfilePolling())
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(done)
+	}()
+	snapshot()
+	<-done
+	if checker.failed {
+		t.Errorf("goroutine that exited reported: %q", checker.msgs)
+	}
+}
+
+func TestWithProfilePollingIgnored(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	for _, opt := range []Option{
+		IgnoreTopFunction("github.com/fortytw2/leaktest.blockedGoroutine"),
+		WithLeakStates(StateSelect),
+	} {
+		checker := &testReporter{}
+		snapshot := CheckTimeout(checker, 5*time.Second, WithProfilePolling(), opt)
+		started := make(chan struct{})
+		go blockedGoroutine(started, block)
+		<-started
+		start := time.Now()
+		snapshot()
+		if checker.failed {
+			t.Errorf("goroutine the check ignores reported: %q", checker.msgs)
+		}
+		if took := time.Since(start); took > time.Second {
+			t.Errorf("check waited %s for a goroutine it ignores", took)
+		}
+	}
+}
+
+func TestWithProfilePollingClock(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	// the goroutine driving the clock must predate the baseline
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				clock.Advance(time.Minute)
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+
+	checker := &testReporter{}
+	snapshot := CheckTimeout(checker, time.Hour, WithProfilePolling(), WithClock(clock))
+	started := make(chan struct{})
+	// not blockedGoroutine, as those other tests leave may still be exiting
+	go func() {
+		close(started)
+		<-block
+	}()
+	<-started
+	start := time.Now()
+	snapshot()
+	if !checker.failed {
+		t.Error("leak not reported")
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("check took %s, not timed by the clock", took)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build go1.21
+
+package leaktest
+
+import (
+	"context"
+	"log/slog"
+)
+
+// WithSlog emits the check's progress and findings to l as structured
+// records, as well as reporting them as usual: each poll at debug level,
+// how long the goroutines took to settle at info level, and each leaked
+// goroutine at error level, or at warn level if it only warns. Records
+// carry attributes such as test, goroutines, poll and fingerprint. It needs
+// Go 1.21 or later.
+func WithSlog(l *slog.Logger) Option {
+	return func(c *config) {
+		c.slog = func(level logLevel, msg string, args ...interface{}) {
+			l.Log(context.Background(), slog.Level(level), msg, args...)
+		}
+	}
+}
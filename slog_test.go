@@ -0,0 +1,40 @@
+//go:build go1.21 && !leaktest_off
+
+package leaktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestWithSlog(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	checker := &testReporter{}
+	started, block := make(chan struct{}), make(chan struct{})
+	defer close(block)
+	check := CheckTimeout(checker, 100*time.Millisecond, WithSlog(l))
+	go blockedGoroutine(started, block)
+	<-started
+	check()
+	CheckTimeout(checker, time.Second, WithSlog(l))()
+
+	counts := map[string]int{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var rec map[string]interface{}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			t.Fatalf("bad record %q: %s", line, err)
+		}
+		msg, _ := rec["msg"].(string)
+		counts[msg]++
+		if msg == "leaktest: leaked goroutine" && (rec["level"] != "ERROR" || rec["fingerprint"] == "" || rec["reason"] == nil) {
+			t.Errorf("unexpected leak record %q", line)
+		}
+	}
+	if counts["leaktest: poll"] < 2 || counts["leaktest: leaked goroutine"] != 1 || counts["leaktest: settled"] != 1 {
+		t.Errorf("unexpected records %v:\n%s", counts, buf.Bytes())
+	}
+}
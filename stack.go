@@ -0,0 +1,260 @@
+package leaktest
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// maxStackDump is the largest goroutine dump stackDump takes.
+var maxStackDump = 256 << 20
+
+// stackDump returns the stacks of all goroutines, as runtime.Stack does,
+// doubling buf until the whole dump fits. A truncated dump would cut the
+// last goroutine's stack short, losing its "created by" trailer, and miss
+// the goroutines past the cutoff altogether. The returned slice may share
+// buf's memory, or be a new larger buffer. If the dump still fills a buffer
+// of maxStackDump bytes, the truncated dump is returned along with an
+// *errTruncated.
+func stackDump(buf []byte) ([]byte, error) {
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n], nil
+		}
+		if len(buf) >= maxStackDump {
+			return buf[:n], &errTruncated{size: n}
+		}
+		size := 2 * len(buf)
+		if size > maxStackDump {
+			size = maxStackDump
+		}
+		buf = make([]byte, size)
+	}
+}
+
+// errTruncated is returned by stackDump when even its largest buffer was
+// filled, so that goroutines may be missing from the dump.
+type errTruncated struct {
+	size int
+}
+
+func (e *errTruncated) Error() string {
+	return fmt.Sprintf("the goroutine dump was cut off at %d bytes, so goroutines past that point weren't checked", e.size)
+}
+
+// dumpScanner splits a goroutine dump, as taken by stackDump, into records
+// of one goroutine each, without copying them:
+//
+//	s := dumpScanner{dump: dump}
+//	for s.Scan() {
+//		record := s.Record()
+//		...
+//	}
+type dumpScanner struct {
+	dump   []byte
+	record []byte
+}
+
+// Scan advances to the next goroutine's record, returning false once there
+// are none left.
+func (s *dumpScanner) Scan() bool {
+	if len(s.dump) == 0 {
+		return false
+	}
+	if i := bytes.Index(s.dump, []byte("\n\n")); i >= 0 {
+		s.record, s.dump = s.dump[:i], s.dump[i+2:]
+	} else {
+		s.record, s.dump = s.dump, nil
+	}
+	return true
+}
+
+// Record returns the current goroutine's record, which shares the dump's
+// memory.
+func (s *dumpScanner) Record() []byte {
+	return s.record
+}
+
+// ParseDump returns the goroutines of a goroutine dump that checks don't
+// ignore, as leaks, such as the dump printed by a test binary that timed
+// out or got SIGQUIT, or taken by runtime.Stack. Lines around the dump, such
+// as a panic message, are skipped. Package cmd/leaktest-report renders
+// dumps this way.
+func ParseDump(dump []byte) []Leak {
+	var gs []*goroutine
+	s := dumpScanner{dump: dump}
+	for s.Scan() {
+		record := trimRecord(s.Record())
+		if record == nil {
+			continue
+		}
+		if g, err := interestingRecord(record); err == nil && g != nil {
+			gs = append(gs, g)
+		}
+	}
+	return newLeaksError(gs).Leaks()
+}
+
+// trimRecord returns the lines of a record from its goroutine header up to
+// the end of its stack, or nil if it isn't a goroutine's.
+func trimRecord(record []byte) []byte {
+	record = bytes.TrimLeft(record, "\r\n")
+	if !bytes.HasPrefix(record, []byte("goroutine ")) {
+		return nil
+	}
+	end := bytes.IndexByte(record, '\n')
+	if end < 0 {
+		return record
+	}
+	for end < len(record) {
+		next := bytes.IndexByte(record[end+1:], '\n')
+		line := record[end+1:]
+		if next >= 0 {
+			line = line[:next]
+		}
+		// a stack is made of function lines, tab-indented file lines, its
+		// "created by" line and notes such as "...additional frames
+		// elided..."
+		if !bytes.HasPrefix(line, []byte("\t")) && !bytes.Contains(line, []byte("(")) &&
+			!bytes.HasPrefix(line, []byte("created by ")) && !bytes.HasPrefix(line, []byte("...")) {
+			break
+		}
+		if next < 0 {
+			return record
+		}
+		end += 1 + next
+	}
+	return record[:end]
+}
+
+// frame is a function along with the file and line it was at.
+type frame struct {
+	function string
+	file     string
+	line     int
+}
+
+func (f frame) String() string {
+	if f.file == "" {
+		return f.function
+	}
+	return f.function + " (" + f.file + ":" + strconv.Itoa(f.line) + ")"
+}
+
+// less orders frames by function, then file and line.
+func (f frame) less(o frame) bool {
+	if f.function != o.function {
+		return f.function < o.function
+	}
+	if f.file != o.file {
+		return f.file < o.file
+	}
+	return f.line < o.line
+}
+
+// parseCreatedBy parses the "created by" trailer of a goroutine's stack,
+// which looks like
+//
+//	created by net/http.(*Server).Serve in goroutine 7
+//		/usr/local/go/src/net/http/server.go:3285 +0x4b4
+//
+// The " in goroutine N" suffix was added in Go 1.21. It returns the zero
+// frame if there is no such trailer, as for the main goroutine.
+func parseCreatedBy(stack string) frame {
+	lines := createdByTrailer(stack)
+	if lines == nil {
+		return frame{}
+	}
+	var f frame
+	f.function = lines[0]
+	if j := strings.Index(f.function, " in goroutine "); j >= 0 {
+		f.function = f.function[:j]
+	}
+	if len(lines) > 1 {
+		f.file, f.line = parseFileLine(lines[1])
+	}
+	return f
+}
+
+// parseParentID returns the ID of the goroutine that started the goroutine
+// with stack, from the " in goroutine N" suffix of its "created by"
+// trailer, or 0 if it isn't shown.
+func parseParentID(stack string) uint64 {
+	lines := createdByTrailer(stack)
+	if lines == nil {
+		return 0
+	}
+	j := strings.Index(lines[0], " in goroutine ")
+	if j < 0 {
+		return 0
+	}
+	id, _ := strconv.ParseUint(lines[0][j+len(" in goroutine "):], 10, 64)
+	return id
+}
+
+// createdByTrailer returns the lines of the "created by" trailer of a
+// goroutine's stack, starting after "created by ", or nil if there is none.
+// Only the first trailer counts: with GODEBUG=tracebackancestors=N, the
+// stacks of the goroutine's ancestors follow, with trailers of their own.
+func createdByTrailer(stack string) []string {
+	const prefix = "created by "
+	i := strings.Index(stack, "\n"+prefix)
+	switch {
+	case strings.HasPrefix(stack, prefix):
+		i = 0
+	case i < 0:
+		return nil
+	default:
+		i++
+	}
+	return strings.SplitN(stack[i+len(prefix):], "\n", 3)
+}
+
+// parseFileLine parses a stack trace location line such as
+//
+//	/usr/local/go/src/net/http/server.go:3285 +0x4b4
+func parseFileLine(s string) (string, int) {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndex(s, " +0x"); i >= 0 {
+		s = s[:i]
+	}
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return s, 0
+	}
+	line, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return s, 0
+	}
+	return s[:i], line
+}
+
+// stackFunctions returns the names of the functions in a goroutine's stack,
+// innermost first, without their arguments. The header line and the
+// "created by" trailer are skipped.
+func stackFunctions(stack string) []string {
+	lines := strings.Split(stack, "\n")
+	var fns []string
+	for _, line := range lines[1:] {
+		if line == "" || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " ") {
+			continue
+		}
+		if strings.HasPrefix(line, "created by ") {
+			break
+		}
+		if strings.HasPrefix(line, "...") {
+			// "...N frames elided..." in the middle of stacks deeper than
+			// 100 frames, or "...additional frames elided..." at the end
+			// before Go 1.21
+			continue
+		}
+		if i := strings.LastIndex(line, "("); i > 0 {
+			line = line[:i]
+		}
+		fns = append(fns, line)
+	}
+	return fns
+}
@@ -0,0 +1,147 @@
+package leaktest
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCreatedBy(t *testing.T) {
+	cases := []struct {
+		stack string
+		want  frame
+	}{
+		{"goroutine 1 [running]:\nmain.main()\n\t/tmp/main.go:5 +0x1d", frame{}},
+		{
+			"goroutine 8 [chan receive]:\nmain.f()\n\t/tmp/main.go:9 +0x19\ncreated by main.main in goroutine 1\n\t/tmp/main.go:5 +0x1d",
+			frame{function: "main.main", file: "/tmp/main.go", line: 5},
+		},
+		{
+			"goroutine 8 [chan receive]:\nmain.f()\n\t/tmp/main.go:9 +0x19\ncreated by main.main\n\t/tmp/main.go:5",
+			frame{function: "main.main", file: "/tmp/main.go", line: 5},
+		},
+	}
+	for _, c := range cases {
+		if got := parseCreatedBy(c.stack); got != c.want {
+			t.Errorf("parseCreatedBy(%q) = %+v; want %+v", c.stack, got, c.want)
+		}
+	}
+}
+
+// dumpStacks returns the goroutine stacks in the dumps in testdata/stacks,
+// which come from real programs.
+func dumpStacks(t testing.TB) []string {
+	files, err := filepath.Glob(filepath.Join("testdata", "stacks", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stacks []string
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stacks = append(stacks, strings.Split(strings.TrimSpace(string(b)), "\n\n")...)
+	}
+	return stacks
+}
+
+func TestParseParentID(t *testing.T) {
+	cases := []struct {
+		stack string
+		want  uint64
+	}{
+		{"goroutine 1 [running]:\nmain.main()\n\t/tmp/main.go:5 +0x1d", 0},
+		{"goroutine 8 [chan receive]:\nmain.f()\n\t/tmp/main.go:9 +0x19\ncreated by main.main in goroutine 12\n\t/tmp/main.go:5 +0x1d", 12},
+		{"goroutine 8 [chan receive]:\nmain.f()\n\t/tmp/main.go:9 +0x19\ncreated by main.main\n\t/tmp/main.go:5", 0},
+	}
+	for _, c := range cases {
+		if got := parseParentID(c.stack); got != c.want {
+			t.Errorf("parseParentID(%q) = %d; want %d", c.stack, got, c.want)
+		}
+	}
+}
+
+func TestParseElidedAndAncestors(t *testing.T) {
+	want := frame{function: "main.main", file: "/src/example/main.go", line: 19}
+	for _, file := range []string{"elided.txt", "ancestors.txt"} {
+		b, err := os.ReadFile(filepath.Join("testdata", "stacks", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// goroutine 7 recurses 150 frames deep
+		deep := strings.Split(string(b), "\n\n")[1]
+		if got := parseCreatedBy(deep); got != want {
+			t.Errorf("%s: parseCreatedBy = %+v; want %+v", file, got, want)
+		}
+		fns := stackFunctions(deep)
+		if len(fns) != 100 {
+			t.Errorf("%s: got %d functions; want the 100 printed", file, len(fns))
+		}
+		for _, fn := range fns {
+			if fn != "runtime.gopark" && fn != "runtime.chanrecv" && fn != "runtime.chanrecv1" && fn != "main.deep" {
+				t.Errorf("%s: unexpected function %q", file, fn)
+			}
+		}
+	}
+}
+
+func FuzzParseStack(f *testing.F) {
+	for _, stack := range dumpStacks(f) {
+		f.Add(stack)
+	}
+	f.Fuzz(func(t *testing.T, stack string) {
+		created := parseCreatedBy(stack)
+		if strings.Contains(created.function, "\n") || strings.Contains(created.file, "\n") {
+			t.Errorf("parseCreatedBy(%q) = %+v spans lines", stack, created)
+		}
+		for _, fn := range stackFunctions(stack) {
+			if strings.Contains(fn, "\n") || strings.HasPrefix(fn, "...") {
+				t.Errorf("stackFunctions(%q) includes %q", stack, fn)
+			}
+		}
+		g, err := interestingGoroutine(stack)
+		if err == nil && g != nil {
+			g.fingerprint()
+		}
+	})
+}
+
+func TestStackDumpTruncated(t *testing.T) {
+	defer func(max int) { maxStackDump = max }(maxStackDump)
+	maxStackDump = 64
+	dump, err := stackDump(make([]byte, 16))
+	var truncated *errTruncated
+	if !errors.As(err, &truncated) || len(dump) != 64 {
+		t.Fatalf("stackDump = %d bytes, %v; want 64 bytes, errTruncated", len(dump), err)
+	}
+	if !strings.Contains(err.Error(), "cut off at 64 bytes") {
+		t.Errorf("unexpected error %q", err)
+	}
+
+	maxStackDump = 1 << 30
+	if dump, err := stackDump(make([]byte, 16)); err != nil || !bytes.HasPrefix(dump, []byte("goroutine ")) {
+		t.Errorf("stackDump = %q, %v", dump, err)
+	}
+}
+
+func TestDumpScanner(t *testing.T) {
+	for dump, want := range map[string][]string{
+		"":                          nil,
+		"goroutine 1 [running]:\na": {"goroutine 1 [running]:\na"},
+		"goroutine 1 [running]:\na\n\ngoroutine 2 [select]:\nb\n": {"goroutine 1 [running]:\na", "goroutine 2 [select]:\nb\n"},
+	} {
+		var got []string
+		s := dumpScanner{dump: []byte(dump)}
+		for s.Scan() {
+			got = append(got, string(s.Record()))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("records of %q = %q; want %q", dump, got, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package leaktest
+
+import (
+	"runtime"
+	"sync"
+)
+
+// stressMu serializes stress, so that concurrent checks don't leave
+// GOMAXPROCS at one of the values they switch it to.
+var stressMu sync.Mutex
+
+// stress perturbs the scheduler n times, see WithStress.
+func stress(n int) {
+	stressMu.Lock()
+	defer stressMu.Unlock()
+	procs := runtime.GOMAXPROCS(0)
+	for i := 0; i < n; i++ {
+		// Alternate between running everything on one thread and on more
+		// threads than usual, to shake out different interleavings.
+		if i%2 == 0 {
+			runtime.GOMAXPROCS(1)
+		} else {
+			runtime.GOMAXPROCS(2 * procs)
+		}
+		for j := 0; j < 100; j++ {
+			runtime.Gosched()
+		}
+		runtime.GOMAXPROCS(procs)
+		runtime.GC()
+	}
+}
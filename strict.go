@@ -0,0 +1,95 @@
+package leaktest
+
+import (
+	"strings"
+)
+
+// stuckBaseline is a baseline goroutine that got stuck during the test, see
+// WithStrictBaseline.
+type stuckBaseline struct {
+	before, after *goroutine
+}
+
+// stuck reports whether g is blocked in a way that looks permanent: on a
+// lock, a WaitGroup, a Cond, a nil channel or a select with no cases,
+// rather than on a channel or a timer that may well fire.
+func stuck(g *goroutine) bool {
+	switch g.state {
+	case StateMutexLock, StateWaitGroupWait, StateCondWait, StateSemacquire:
+		return true
+	}
+	return blockedForever(g) != ""
+}
+
+// blockedForever describes why g can never be unblocked, if it's provably
+// so: it's operating on a nil channel, or in a select with no cases.
+// Otherwise it returns "". A goroutine locking a mutex it already holds is
+// just as stuck, but mutexes have no owner, so that can't be told from its
+// stack.
+func blockedForever(g *goroutine) string {
+	switch {
+	case g.state == StateChanReceive && g.nilChan:
+		return "it's receiving from a nil channel"
+	case g.state == StateChanSend && g.nilChan:
+		return "it's sending on a nil channel"
+	case g.state == StateSelect && strings.Contains(g.status, "(no cases)"):
+		return "it's in a select with no cases"
+	}
+	return ""
+}
+
+// stuckSince returns the baseline goroutines in all that weren't stuck at
+// the baseline but are now, see WithStrictBaseline.
+func (c *Checker) stuckSince(all []*goroutine) []stuckBaseline {
+	if c.origStacks == nil {
+		return nil
+	}
+	var found []stuckBaseline
+	for _, g := range all {
+		before, ok := c.origStacks[g.id]
+		if ok && !stuck(before) && stuck(g) {
+			found = append(found, stuckBaseline{before: before, after: g})
+		}
+	}
+	return found
+}
+
+// lineDiff returns a diff of the lines of a and b, each line prefixed with
+// "-" if it's only in a, "+" if it's only in b and " " if it's in both.
+func lineDiff(a, b string) string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			switch {
+			case x[i] == y[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var out []string
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			out = append(out, " "+x[i])
+			i, j = i+1, j+1
+		case j == len(y) || (i < len(x) && lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "-"+x[i])
+			i++
+		default:
+			out = append(out, "+"+y[j])
+			j++
+		}
+	}
+	return strings.Join(out, "\n")
+}
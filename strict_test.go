@@ -0,0 +1,111 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLineDiff(t *testing.T) {
+	got := lineDiff("a\nb\nc", "a\nx\nc\nd")
+	want := " a\n-b\n+x\n c\n+d"
+	if got != want {
+		t.Errorf("lineDiff = %q, want %q", got, want)
+	}
+}
+
+//go:noinline
+func lockOnceWorking(started chan<- struct{}, work chan struct{}, mu *sync.Mutex) {
+	close(started)
+	<-work
+	mu.Lock()
+	mu.Unlock()
+}
+
+// anyStuck reports whether one of gs with fn in its stack is stuck.
+func anyStuck(gs []*goroutine, fn string) bool {
+	for _, g := range gs {
+		if strings.Contains(g.stack, fn) && stuck(g) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWithStrictBaseline(t *testing.T) {
+	var mu sync.Mutex
+	mu.Lock()
+	started, work := make(chan struct{}), make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		lockOnceWorking(started, work, &mu)
+	}()
+	defer wg.Wait()
+	defer mu.Unlock()
+	<-started
+
+	checker := &testReporter{}
+	c := NewChecker(checker, WithStrictBaseline())
+	close(work)
+	// the goroutine must be stuck by the time the check first polls, or
+	// it passes
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		gs, _ := interestingGoroutines()
+		if anyStuck(gs, "leaktest.lockOnceWorking") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("goroutine never got stuck")
+		}
+	}
+	c.CheckTimeout(100 * time.Millisecond)
+
+	if !checker.failed {
+		t.Fatal("baseline goroutine that got stuck not reported")
+	}
+	msg := strings.Join(checker.msgs, "\n")
+	if !strings.Contains(msg, "already running before the test, got stuck [sync.Mutex.Lock]") ||
+		!strings.Contains(msg, "\n-") || !strings.Contains(msg, "\n+sync.(*Mutex).Lock") {
+		t.Errorf("unexpected report %q", msg)
+	}
+}
+
+func TestBlockedForever(t *testing.T) {
+	for _, tt := range []struct {
+		header, want string
+	}{
+		{"goroutine 7 [chan receive (nil chan)]:", "it's receiving from a nil channel"},
+		{"goroutine 7 [chan send (nil chan), 2 minutes]:", "it's sending on a nil channel"},
+		{"goroutine 7 [select (no cases)]:", "it's in a select with no cases"},
+		{"goroutine 7 [chan receive]:", ""},
+		{"goroutine 7 [select]:", ""},
+	} {
+		g, err := interestingRecord([]byte(tt.header + "\nmain.f()\n\t/src/main.go:10 +0x1d\ncreated by main.main in goroutine 1\n\t/src/main.go:5 +0x1a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := blockedForever(g); got != tt.want {
+			t.Errorf("blockedForever(%q) = %q; want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCheckerBlockedForever(t *testing.T) {
+	stuck, err := interestingRecord([]byte("goroutine 7 [select (no cases)]:\nmain.f()\n\t/src/main.go:10 +0x1d\ncreated by main.main in goroutine 1\n\t/src/main.go:5 +0x1a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewChecker(&testReporter{})
+	if err := c.blockedForever([]*goroutine{stuck}); err == nil || !strings.Contains(err.Error(), "goroutine 7 can never exit") {
+		t.Errorf("blockedForever = %v", err)
+	}
+	c = NewChecker(&testReporter{}, WithWarnOnly("main.f"))
+	if err := c.blockedForever([]*goroutine{stuck}); err != nil {
+		t.Errorf("blockedForever = %v for a goroutine only warned about", err)
+	}
+}
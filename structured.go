@@ -0,0 +1,35 @@
+package leaktest
+
+// logLevel is the level of a structured record, with the values of the
+// matching log/slog levels.
+type logLevel int
+
+const (
+	levelDebug logLevel = -4
+	levelInfo  logLevel = 0
+	levelWarn  logLevel = 4
+	levelError logLevel = 8
+)
+
+// record emits a structured record with the key-value pairs in args, if
+// WithSlog was given.
+func (c *config) record(level logLevel, msg string, args ...interface{}) {
+	if c.slog != nil {
+		c.slog(level, msg, args...)
+	}
+}
+
+// recordLeak emits a structured record of the leak of g.
+func (c *config) recordLeak(level logLevel, test string, g *goroutine, reason error) {
+	if c.slog == nil {
+		return
+	}
+	args := []interface{}{"test", test, "goroutine", g.id, "fingerprint", g.fingerprint(), "state", g.state.String(), "category", categorize(g).String()}
+	if g.createdBy.function != "" {
+		args = append(args, "created_by", g.createdBy.String())
+	}
+	if reason != nil {
+		args = append(args, "reason", reason.Error())
+	}
+	c.record(level, "leaktest: leaked goroutine", args...)
+}
@@ -0,0 +1,71 @@
+package leaktest
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// CheckTempFiles notes the files and directories in the temporary
+// directory, or in dirs if any are given, and returns a func that reports
+// every one created since and still there, which is usually a test
+// forgetting to remove what it created with os.CreateTemp or os.MkdirTemp:
+//
+//	defer leaktest.CheckTempFiles(t)()
+//
+// Only the top level of each directory is compared. The reporter's TempDir,
+// if it has one, is created beforehand so that it, and everything in it, is
+// left alone, as it's removed when the test finishes. Files created by tests
+// running in parallel are reported too.
+func CheckTempFiles(t ErrorReporter, dirs ...string) func() {
+	if disabled {
+		return func() {}
+	}
+	t = orStderr(t)
+	if len(dirs) == 0 {
+		dirs = []string{os.TempDir()}
+	}
+	if d, ok := t.(tempDirer); ok {
+		d.TempDir()
+	}
+	before := make([]map[string]bool, len(dirs))
+	for i, dir := range dirs {
+		before[i] = map[string]bool{}
+		names, err := dirNames(dir)
+		if err != nil {
+			t.Errorf("leaktest: %s", err)
+		}
+		for _, name := range names {
+			before[i][name] = true
+		}
+	}
+	return onCleanup(t, func() {
+		if h, ok := t.(tHelper); ok {
+			h.Helper()
+		}
+		for i, dir := range dirs {
+			names, err := dirNames(dir)
+			if err != nil {
+				t.Errorf("leaktest: %s", err)
+				continue
+			}
+			for _, name := range names {
+				if !before[i][name] {
+					t.Errorf("leaktest: temporary file left behind: %s", filepath.Join(dir, name))
+				}
+			}
+		}
+	})
+}
+
+// dirNames returns the sorted names of the entries in dir.
+func dirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	sort.Strings(names)
+	return names, err
+}
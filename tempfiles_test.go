@@ -0,0 +1,57 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "existing"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	checker := &testReporter{}
+	check := CheckTempFiles(checker, dir)
+	f, err := os.CreateTemp(dir, "leaked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	removed, err := os.MkdirTemp(dir, "removed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(removed)
+	check()
+
+	if len(checker.msgs) != 1 || !strings.Contains(checker.msgs[0], "temporary file left behind: "+f.Name()) {
+		t.Errorf("want %s reported, got %q", f.Name(), checker.msgs)
+	}
+}
+
+// tempDirReporter is a reporter whose TempDir is created on first use, as a
+// testing.T's is.
+type tempDirReporter struct {
+	testReporter
+	dir string
+}
+
+func (r *tempDirReporter) TempDir() string {
+	os.MkdirAll(r.dir, 0o700)
+	return r.dir
+}
+
+func TestCheckTempFilesTempDir(t *testing.T) {
+	dir := t.TempDir()
+	checker := &tempDirReporter{dir: filepath.Join(dir, "TestFoo")}
+	check := CheckTempFiles(checker, dir)
+	os.WriteFile(filepath.Join(checker.TempDir(), "kept"), nil, 0o600)
+	check()
+	if checker.failed {
+		t.Errorf("files in the test's TempDir reported: %q", checker.msgs)
+	}
+}
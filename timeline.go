@@ -0,0 +1,323 @@
+package leaktest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeline records, while a test suite runs, which tests were running when
+// each goroutine was first seen, so that goroutines leaked over the whole
+// suite can be attributed to a test, see CheckMain. With a grace period it
+// also records the goroutines that outlived the tests they appeared during
+// by longer than that, see AutoCheckMain.
+type timeline struct {
+	stop  chan struct{}
+	done  chan struct{}
+	grace time.Duration
+
+	mu sync.Mutex
+	// firstSeen holds, for each live goroutine, the tests that were running
+	// when it was first seen
+	firstSeen map[uint64]*sighting
+	// running is the set of tests running at the last sample
+	running map[string]bool
+	// finished holds when each test that isn't running was last seen
+	// running
+	finished map[string]time.Time
+	// outlived are the goroutines that outlived their tests by more than
+	// grace
+	outlived []outlived
+	// onOutlived, if set, is called with each goroutine found to outlive
+	// its tests, as it's found
+	onOutlived func(outlived)
+	// count is the number of interesting goroutines at the last sample
+	count int
+	// samples are the samples in which the count or the running tests
+	// changed
+	samples []Sample
+	// growth holds, for each test seen running, how many more goroutines
+	// there were once it finished than before it started
+	growth map[string]*growth
+}
+
+// growth is the change in the number of goroutines over a test's run.
+type growth struct {
+	// before is the number of goroutines before the test started, while
+	// it's running
+	before int
+	net    int
+}
+
+// sighting is the tests running when a goroutine was first seen.
+type sighting struct {
+	tests []string
+	// outlived is set once the goroutine was found to outlive its tests
+	outlived bool
+}
+
+// outlived is a goroutine that outlived the tests it appeared during.
+type outlived struct {
+	g     *goroutine
+	tests []string
+}
+
+// startTimeline starts recording a timeline, sampling every interval. If
+// grace is 0, goroutines outliving their tests aren't looked for, otherwise
+// onOutlived, if not nil, is called with each one as it's found.
+func startTimeline(interval, grace time.Duration, onOutlived func(outlived)) *timeline {
+	tl := newTimeline(grace)
+	tl.onOutlived = onOutlived
+	go tl.run(interval)
+	return tl
+}
+
+func newTimeline(grace time.Duration) *timeline {
+	return &timeline{
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		grace:     grace,
+		firstSeen: map[uint64]*sighting{},
+		running:   map[string]bool{},
+		finished:  map[string]time.Time{},
+		growth:    map[string]*growth{},
+	}
+}
+
+func (tl *timeline) run(interval time.Duration) {
+	defer close(tl.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	buf := make([]byte, 2<<20)
+	for {
+		select {
+		case <-tl.stop:
+			return
+		case <-ticker.C:
+			// a truncated dump is reported by the checks themselves
+			dump, _ := stackDump(buf)
+			buf = dump[:cap(dump)]
+			found := tl.record(dump, time.Now())
+			if tl.onOutlived != nil {
+				for _, o := range found {
+					tl.onOutlived(o)
+				}
+			}
+		}
+	}
+}
+
+// record notes the tests running in a goroutine dump taken at now against
+// the goroutines that appear in it for the first time, and forgets the
+// goroutines that have exited. It returns the goroutines newly found to
+// outlive their tests.
+func (tl *timeline) record(dump []byte, now time.Time) []outlived {
+	var tests []string
+	var gs []*goroutine
+	s := dumpScanner{dump: dump}
+	for s.Scan() {
+		g := s.Record()
+		if bytes.Contains(g, []byte("testing.tRunner(")) {
+			if name := testFunc(string(g)); name != "" {
+				tests = append(tests, name)
+			}
+			continue
+		}
+		if gr, err := interestingRecord(g); err == nil && gr != nil {
+			gs = append(gs, gr)
+		}
+	}
+	sort.Strings(tests)
+	tests = dedupe(tests)
+
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	running := make(map[string]bool, len(tests))
+	for _, test := range tests {
+		running[test] = true
+		delete(tl.finished, test)
+		if !tl.running[test] {
+			// the test started since the last sample, which is the last
+			// count from before it did
+			if tl.growth[test] == nil {
+				tl.growth[test] = &growth{}
+			}
+			tl.growth[test].before = tl.count
+		}
+	}
+	for test := range tl.running {
+		if !running[test] {
+			tl.finished[test] = now
+			tl.growth[test].net += len(gs) - tl.growth[test].before
+		}
+	}
+	if n := len(tl.samples); n == 0 || len(gs) != tl.count || !equal(tests, tl.samples[n-1].Tests) {
+		tl.samples = append(tl.samples, Sample{Time: now, Goroutines: len(gs), Tests: tests})
+	}
+	tl.running = running
+	tl.count = len(gs)
+
+	live := make(map[uint64]*sighting, len(gs))
+	var found []outlived
+	for _, g := range gs {
+		seen, ok := tl.firstSeen[g.id]
+		if !ok {
+			seen = &sighting{tests: tests}
+		}
+		live[g.id] = seen
+		if tl.grace > 0 && !seen.outlived && tl.outlives(seen.tests, now) {
+			seen.outlived = true
+			found = append(found, outlived{g: g, tests: seen.tests})
+		}
+	}
+	tl.firstSeen = live
+	tl.outlived = append(tl.outlived, found...)
+	return found
+}
+
+// outlives reports whether all of tests finished more than the grace period
+// before now.
+func (tl *timeline) outlives(tests []string, now time.Time) bool {
+	if len(tests) == 0 {
+		return false
+	}
+	for _, test := range tests {
+		end, ok := tl.finished[test]
+		if !ok || now.Sub(end) <= tl.grace {
+			return false
+		}
+	}
+	return true
+}
+
+// Outlived returns the goroutines found to outlive the tests they appeared
+// during by more than the grace period.
+func (tl *timeline) Outlived() []outlived {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	return tl.outlived
+}
+
+// Samples returns the samples in which the number of goroutines or the
+// running tests changed, oldest first.
+func (tl *timeline) Samples() []Sample {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	return tl.samples
+}
+
+// Growth describes the tests whose run changed the number of goroutines
+// the most, up to n of them, most growth first, each on a line of its own
+// such as "\t+3\tTestFoo", or returns "" if none did. Tests running in
+// parallel share each other's growth, and tests shorter than the sampling
+// interval may not be seen at all.
+func (tl *timeline) Growth(n int) string {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	var tests []string
+	for test, g := range tl.growth {
+		if g.net != 0 {
+			tests = append(tests, test)
+		}
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		gi, gj := tl.growth[tests[i]].net, tl.growth[tests[j]].net
+		if gi != gj {
+			return gi > gj
+		}
+		return tests[i] < tests[j]
+	})
+	if len(tests) > n {
+		tests = tests[:n]
+	}
+	var b strings.Builder
+	for _, test := range tests {
+		fmt.Fprintf(&b, "\n\t%+d\t%s", tl.growth[test].net, test)
+	}
+	return b.String()
+}
+
+// Stop stops recording, waiting for the recording goroutine to exit so that
+// it can't be mistaken for a leak. It's safe to call more than once.
+func (tl *timeline) Stop() {
+	tl.mu.Lock()
+	select {
+	case <-tl.stop:
+	default:
+		close(tl.stop)
+	}
+	tl.mu.Unlock()
+	<-tl.done
+}
+
+// during returns the tests that were running when the goroutine with the
+// given ID was first seen, and whether it was seen at all.
+func (tl *timeline) during(id uint64) ([]string, bool) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	seen, ok := tl.firstSeen[id]
+	if !ok {
+		return nil, false
+	}
+	return seen.tests, true
+}
+
+// testFunc returns the name of the top-level test run by a testing.tRunner
+// goroutine, or "" if it's a parallel test that's paused rather than
+// running.
+func testFunc(g string) string {
+	if strings.Contains(g, "testing.(*T).Parallel(") {
+		return ""
+	}
+	lines := strings.Split(g, "\n")
+	for i, line := range lines {
+		// the test function is the frame right above tRunner, each frame
+		// being a function line followed by a file:line line
+		if !strings.HasPrefix(line, "testing.tRunner(") || i < 2 {
+			continue
+		}
+		fn := lines[i-2]
+		if paren := strings.LastIndex(fn, "("); paren > 0 {
+			fn = fn[:paren]
+		}
+		pkg := funcPackage(fn)
+		if pkg == "testing" {
+			// the main goroutine runs tRunner to start the tests
+			return ""
+		}
+		name := strings.TrimPrefix(fn, pkg+".")
+		// subtests run closures such as TestFoo.func1
+		if dot := strings.Index(name, "."); dot >= 0 {
+			name = name[:dot]
+		}
+		return name
+	}
+	return ""
+}
+
+// equal reports whether a and b hold the same strings in the same order.
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// dedupe removes adjacent duplicates from a sorted slice.
+func dedupe(s []string) []string {
+	out := s[:0]
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+// Package timeutil wraps the timers and tickers of package time to keep
+// track of those that are still pending, so that tests can check they
+// stopped every one they started:
+//
+//	func TestPoller(t *testing.T) {
+//		defer timeutil.CheckTimers(t)()
+//		p := newPoller(timeutil.NewTicker(time.Second))
+//		...
+//	}
+//
+// A ticker that's never stopped keeps whatever reads from it busy, and is
+// only seen by Check if a goroutine is left waiting on it.
+package timeutil
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+)
+
+// tracker tracks the pending timers and tickers started through this
+// package.
+var tracker leaktest.Tracker
+
+// CheckTimers returns a func that reports every ticker started through this
+// package since CheckTimers was called and not yet stopped, and every timer
+// that has neither fired nor been stopped, waiting up to 5 seconds for them
+// to be. Timers and tickers started by tests running in parallel are
+// reported too.
+func CheckTimers(t leaktest.ErrorReporter) func() {
+	return leaktest.CheckTracked(t, &tracker)
+}
+
+// Ticker is a time.Ticker whose Stop marks it as stopped.
+type Ticker struct {
+	C <-chan time.Time
+	t *time.Ticker
+	h *leaktest.Handle
+}
+
+// NewTicker returns a new Ticker, as time.NewTicker does.
+func NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(d)
+	return &Ticker{C: t.C, t: t, h: tracker.Acquire("ticker", "")}
+}
+
+// Stop turns off the ticker, as time.Ticker's Stop does.
+func (t *Ticker) Stop() {
+	t.h.Release()
+	t.t.Stop()
+}
+
+// Reset changes the ticker's period, as time.Ticker's Reset does.
+func (t *Ticker) Reset(d time.Duration) {
+	t.t.Reset(d)
+}
+
+// Timer is a time.Timer that's marked as done once it fires or is stopped.
+type Timer struct {
+	C <-chan time.Time
+	t *time.Timer
+
+	mu sync.Mutex
+	h  *leaktest.Handle
+}
+
+// NewTimer returns a new Timer, as time.NewTimer does.
+func NewTimer(d time.Duration) *Timer {
+	c := make(chan time.Time, 1)
+	t := &Timer{C: c}
+	t.h = tracker.Acquire("timer", "")
+	t.t = time.AfterFunc(d, func() {
+		select {
+		case c <- time.Now():
+		default:
+		}
+		t.done()
+	})
+	return t
+}
+
+// AfterFunc calls f in its own goroutine once d has elapsed, as
+// time.AfterFunc does.
+func AfterFunc(d time.Duration, f func()) *Timer {
+	t := &Timer{}
+	t.h = tracker.Acquire("AfterFunc timer", "")
+	t.t = time.AfterFunc(d, func() {
+		t.done()
+		f()
+	})
+	return t
+}
+
+// Stop prevents the timer from firing, as time.Timer's Stop does.
+func (t *Timer) Stop() bool {
+	t.done()
+	return t.t.Stop()
+}
+
+// Reset changes the timer to fire after d, as time.Timer's Reset does. The
+// timer's pending again, even if it had fired or been stopped.
+func (t *Timer) Reset(d time.Duration) bool {
+	t.mu.Lock()
+	if t.h == nil {
+		t.h = tracker.Acquire("timer", "")
+	}
+	t.mu.Unlock()
+	return t.t.Reset(d)
+}
+
+// done marks the timer as no longer pending.
+func (t *Timer) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.h != nil {
+		t.h.Release()
+		t.h = nil
+	}
+}
@@ -0,0 +1,54 @@
+//go:build !leaktest_off
+
+package timeutil
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+)
+
+type reporter struct {
+	failed bool
+	msgs   []string
+}
+
+func (r *reporter) Errorf(format string, args ...interface{}) {
+	r.failed = true
+	r.msgs = append(r.msgs, fmt.Sprintf(format, args...))
+}
+
+func TestCheckTimers(t *testing.T) {
+	var r reporter
+	check := leaktest.CheckTrackedTimeout(&r, &tracker, 100*time.Millisecond)
+	leaked := NewTicker(time.Hour)
+	stopped := NewTicker(time.Hour)
+	stopped.Stop()
+	fired := NewTimer(time.Millisecond)
+	AfterFunc(time.Millisecond, func() {})
+	NewTimer(time.Hour).Stop()
+	check()
+	leaked.Stop()
+	<-fired.C
+
+	if len(r.msgs) != 1 || !strings.Contains(r.msgs[0], "ticker was never released") || !strings.Contains(r.msgs[0], "timeutil.TestCheckTimers") {
+		t.Errorf("want the leaked ticker reported, got %q", r.msgs)
+	}
+}
+
+func TestTimerReset(t *testing.T) {
+	var r reporter
+	check := leaktest.CheckTrackedTimeout(&r, &tracker, 100*time.Millisecond)
+	timer := NewTimer(time.Millisecond)
+	<-timer.C
+	timer.Reset(time.Hour)
+	check()
+	timer.Stop()
+
+	if len(r.msgs) != 1 || !strings.Contains(r.msgs[0], "timer was never released") {
+		t.Errorf("want the reset timer reported, got %q", r.msgs)
+	}
+}
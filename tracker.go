@@ -0,0 +1,171 @@
+package leaktest
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracker keeps track of resources that must be released once acquired,
+// such as connections, files or subscriptions, so that tests can check none
+// were forgotten, just as Check does for goroutines:
+//
+//	conn := dial()
+//	h := tracker.Acquire("redis conn", "")
+//	defer h.Release()
+//
+// and in the test:
+//
+//	defer leaktest.CheckTracked(t, tracker)()
+//
+// The zero Tracker is ready to use, and a Tracker is safe for concurrent use.
+type Tracker struct {
+	mu     sync.Mutex
+	nextID uint64
+	held   map[uint64]*Handle
+	// released is closed and replaced whenever a handle is released
+	released chan struct{}
+}
+
+// Handle is a resource acquired from a Tracker.
+type Handle struct {
+	tr    *Tracker
+	id    uint64
+	kind  string
+	stack string
+}
+
+// Acquire records that a resource of the given kind, such as "redis conn",
+// was acquired, with the stack to show if it's never released. If stack is
+// empty, the stack of Acquire's caller is recorded.
+func (tr *Tracker) Acquire(kind, stack string) *Handle {
+	if disabled {
+		return &Handle{tr: tr, kind: kind, stack: stack}
+	}
+	if stack == "" {
+		stack = callerStack(1)
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.held == nil {
+		tr.held = map[uint64]*Handle{}
+	}
+	tr.nextID++
+	h := &Handle{tr: tr, id: tr.nextID, kind: kind, stack: stack}
+	tr.held[h.id] = h
+	return h
+}
+
+// Release records that the resource was released. Releasing it again has no
+// effect.
+func (h *Handle) Release() {
+	tr := h.tr
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if _, ok := tr.held[h.id]; !ok {
+		return
+	}
+	delete(tr.held, h.id)
+	if tr.released != nil {
+		close(tr.released)
+		tr.released = nil
+	}
+}
+
+// Kind returns the kind of resource passed to Acquire.
+func (h *Handle) Kind() string { return h.kind }
+
+// Stack returns the stack the resource was acquired at.
+func (h *Handle) Stack() string { return h.stack }
+
+// Held returns the resources acquired and not yet released, in the order
+// they were acquired.
+func (tr *Tracker) Held() []*Handle {
+	held, _ := tr.heldSince(0)
+	return held
+}
+
+// heldSince returns the resources acquired after the one with ID since and
+// not yet released, and a channel closed as soon as any resource is
+// released.
+func (tr *Tracker) heldSince(since uint64) ([]*Handle, <-chan struct{}) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	var held []*Handle
+	for id, h := range tr.held {
+		if id > since {
+			held = append(held, h)
+		}
+	}
+	sort.Slice(held, func(i, j int) bool { return held[i].id < held[j].id })
+	if tr.released == nil {
+		tr.released = make(chan struct{})
+	}
+	return held, tr.released
+}
+
+// CheckTracked notes the resources held by tr and returns a func that
+// checks whether any resource acquired since was not released, waiting up
+// to 5 seconds for them to be, and reports each one with the stack it was
+// acquired at.
+func CheckTracked(t ErrorReporter, tr *Tracker) func() {
+	return CheckTrackedTimeout(t, tr, defaultTimeout())
+}
+
+// CheckTrackedTimeout is the same as CheckTracked, but with a configurable
+// timeout.
+func CheckTrackedTimeout(t ErrorReporter, tr *Tracker, dur time.Duration) func() {
+	if disabled {
+		return func() {}
+	}
+	t = orStderr(t)
+	tr.mu.Lock()
+	since := tr.nextID
+	tr.mu.Unlock()
+	return onCleanup(t, func() {
+		if h, ok := t.(tHelper); ok {
+			h.Helper()
+		}
+		timer := time.NewTimer(dur)
+		defer timer.Stop()
+		for {
+			held, released := tr.heldSince(since)
+			if len(held) == 0 {
+				return
+			}
+			select {
+			case <-released:
+				continue
+			case <-timer.C:
+			}
+			held, _ = tr.heldSince(since)
+			for _, h := range held {
+				t.Errorf("leaktest: %s was never released, it was acquired at:\n%s", h.kind, h.stack)
+			}
+			return
+		}
+	})
+}
+
+// callerStack formats the stack of the caller skip frames above
+// callerStack's caller, one "function\n\tfile:line" pair per frame.
+func callerStack(skip int) string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var b strings.Builder
+	for {
+		f, more := frames.Next()
+		if strings.HasPrefix(f.Function, "runtime.") || strings.HasPrefix(f.Function, "testing.") {
+			break
+		}
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
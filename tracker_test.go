@@ -0,0 +1,49 @@
+//go:build !leaktest_off
+
+package leaktest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTracked(t *testing.T) {
+	var tr Tracker
+	before := tr.Acquire("pool conn", "")
+	defer before.Release()
+
+	checker := &testReporter{}
+	check := CheckTrackedTimeout(checker, &tr, 100*time.Millisecond)
+	tr.Acquire("redis conn", "")
+	released := tr.Acquire("file", "")
+	released.Release()
+	released.Release()
+	check()
+
+	if !checker.failed || len(checker.msgs) != 1 {
+		t.Fatalf("want 1 unreleased resource reported, got %q", checker.msgs)
+	}
+	msg := checker.msgs[0]
+	if !strings.Contains(msg, "redis conn was never released") || !strings.Contains(msg, "leaktest.TestCheckTracked") {
+		t.Errorf("unexpected report %q", msg)
+	}
+}
+
+func TestCheckTrackedWaits(t *testing.T) {
+	var tr Tracker
+	checker := &testReporter{}
+	check := CheckTrackedTimeout(checker, &tr, time.Second)
+	h := tr.Acquire("conn", "custom stack")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		h.Release()
+	}()
+	check()
+	if checker.failed {
+		t.Errorf("resource released asynchronously reported: %q", checker.msgs)
+	}
+	if held := tr.Held(); len(held) != 0 {
+		t.Errorf("Held() = %v after release", held)
+	}
+}
@@ -0,0 +1,126 @@
+// Package webhook posts the leaks found by leaktest.CheckMain to a URL, so
+// that nightly soak jobs can page a channel when goroutines leak:
+//
+//	func TestMain(m *testing.M) {
+//		leaktest.CheckMain(m, leaktest.WithNotifier(&webhook.Notifier{
+//			URL: os.Getenv("LEAK_WEBHOOK_URL"),
+//		}))
+//	}
+//
+// The payload is a JSON object whose "text" field summarizes the leaks, as
+// chat incoming webhooks expect, alongside the leaks themselves, grouped by
+// fingerprint.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/fortytw2/leaktest"
+)
+
+// Notifier posts leak reports to URL. It does nothing if URL is empty, so
+// that it can be left in place on machines without one.
+type Notifier struct {
+	URL string
+	// Client is the client used to post, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// Payload is the JSON body posted for a report.
+type Payload struct {
+	Text   string `json:"text"`
+	Binary string `json:"binary"`
+	Leaks  []Leak `json:"leaks"`
+}
+
+// Leak is the goroutines that leaked from the same place for the same
+// reason.
+type Leak struct {
+	Fingerprint string   `json:"fingerprint"`
+	Count       int      `json:"count"`
+	CreatedBy   string   `json:"created_by,omitempty"`
+	Class       string   `json:"class"`
+	Category    string   `json:"category"`
+	Tests       []string `json:"tests,omitempty"`
+	// Stack is the stack of the first of the goroutines
+	Stack string `json:"stack"`
+}
+
+// NewPayload builds the payload for r.
+func NewPayload(r leaktest.SuiteReport) Payload {
+	p := Payload{Binary: r.Binary}
+	index := map[string]int{}
+	for _, l := range r.Leaks {
+		i, ok := index[l.Fingerprint]
+		if !ok {
+			i = len(p.Leaks)
+			index[l.Fingerprint] = i
+			p.Leaks = append(p.Leaks, Leak{
+				Fingerprint: l.Fingerprint,
+				CreatedBy:   l.CreatedBy,
+				Class:       l.Class.String(),
+				Category:    l.Category.String(),
+				Stack:       l.Stack,
+			})
+		}
+		p.Leaks[i].Count++
+		p.Leaks[i].Tests = appendNew(p.Leaks[i].Tests, r.Tests[l.ID]...)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s leaked %d goroutine(s):", r.Binary, len(r.Leaks))
+	for _, l := range p.Leaks {
+		fmt.Fprintf(&b, "\n%d× %s", l.Count, l.Fingerprint)
+		if l.CreatedBy != "" {
+			fmt.Fprintf(&b, " created by %s", l.CreatedBy)
+		}
+		if len(l.Tests) > 0 {
+			fmt.Fprintf(&b, " during %s", strings.Join(l.Tests, ", "))
+		}
+	}
+	p.Text = b.String()
+	return p
+}
+
+// Notify posts the payload for r to n.URL.
+func (n *Notifier) Notify(r leaktest.SuiteReport) error {
+	if n.URL == "" {
+		return nil
+	}
+	body, err := json.Marshal(NewPayload(r))
+	if err != nil {
+		return err
+	}
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook: posting to %s: %s", n.URL, resp.Status)
+	}
+	return nil
+}
+
+// appendNew appends the elements of vs that aren't in s yet.
+func appendNew(s []string, vs ...string) []string {
+outer:
+	for _, v := range vs {
+		for _, have := range s {
+			if have == v {
+				continue outer
+			}
+		}
+		s = append(s, v)
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/leaktest"
+)
+
+func TestNotify(t *testing.T) {
+	var got Payload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding payload: %s", err)
+		}
+	}))
+	defer srv.Close()
+	defer srv.Client().CloseIdleConnections()
+
+	n := &Notifier{URL: srv.URL, Client: srv.Client()}
+	err := n.Notify(leaktest.SuiteReport{
+		Binary: "pkg.test",
+		Leaks: []leaktest.Leak{
+			{ID: 7, Fingerprint: "a", CreatedBy: "pkg.f"},
+			{ID: 8, Fingerprint: "a", CreatedBy: "pkg.f"},
+			{ID: 9, Fingerprint: "b"},
+		},
+		Tests: map[uint64][]string{7: {"TestA"}, 8: {"TestA", "TestB"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Leaks) != 2 || got.Leaks[0].Count != 2 || strings.Join(got.Leaks[0].Tests, ",") != "TestA,TestB" {
+		t.Errorf("unexpected payload %+v", got)
+	}
+	if !strings.HasPrefix(got.Text, "pkg.test leaked 3 goroutine(s):\n2× a created by pkg.f during TestA, TestB\n1× b") {
+		t.Errorf("unexpected text %q", got.Text)
+	}
+}
+
+func TestNotifyStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	defer srv.Client().CloseIdleConnections()
+
+	n := &Notifier{URL: srv.URL, Client: srv.Client()}
+	if err := n.Notify(leaktest.SuiteReport{}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Notify = %v; want a 403 error", err)
+	}
+	if err := (&Notifier{}).Notify(leaktest.SuiteReport{}); err != nil {
+		t.Errorf("Notify without a URL = %v", err)
+	}
+}